@@ -0,0 +1,286 @@
+package admin
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/arthben/http_jwt_crud/internal/lockout"
+	"github.com/arthben/http_jwt_crud/internal/logging"
+	res "github.com/arthben/http_jwt_crud/internal/response"
+	"github.com/jmoiron/sqlx"
+)
+
+type AdminService struct {
+	cfg     *config.EnvParams
+	clients *clients.Manager
+	locks   *lockout.Lockout
+}
+
+func NewAdminService(db *sqlx.DB, cfg *config.EnvParams, locks *lockout.Lockout) *AdminService {
+	return &AdminService{cfg: cfg, clients: clients.NewManager(db, cfg), locks: locks}
+}
+
+// Enabled report whether admin token is configured
+func (a *AdminService) Enabled() bool {
+	return len(a.cfg.Admin.TokenHash) > 0
+}
+
+// Authorize serve next only to request with admin token, ex: expvar metrics
+func (a *AdminService) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+			res.Write(w).AbortWithJSON(errCode)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CreateClient register new client. The generated secret is only shown on this response
+func (a *AdminService) CreateClient(w http.ResponseWriter, r *http.Request) (*ClientResponse, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	var payload CreateClientRequest
+	if errCode := validateBody(w, r, &payload); errCode != nil {
+		return nil, errCode
+	}
+
+	client, err := a.clients.Create(r.Context(), payload.Scopes, payload.PublicKey, payload.SignatureMethod)
+	if err != nil {
+		return nil, clientError(r, "CreateClient", err)
+	}
+
+	return toResponse(client), nil
+}
+
+func (a *AdminService) ListClients(w http.ResponseWriter, r *http.Request) (*ClientListResponse, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	list, err := a.clients.List(r.Context())
+	if err != nil {
+		return nil, clientError(r, "ListClients", err)
+	}
+
+	resp := &ClientListResponse{
+		ResponseCode:    "200" + ServiceCode + "00",
+		ResponseMessage: "Success",
+		Clients:         []*ClientResponse{},
+	}
+	for _, client := range list {
+		resp.Clients = append(resp.Clients, toResponse(client))
+	}
+
+	return resp, nil
+}
+
+// SetClientStatus enable or disable client given on path
+func (a *AdminService) SetClientStatus(w http.ResponseWriter, r *http.Request, status string) (*ClientResponse, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	client, err := a.clients.SetStatus(r.Context(), r.PathValue("clientKey"), status)
+	if err != nil {
+		return nil, clientError(r, "SetClientStatus", err)
+	}
+
+	return toResponse(client), nil
+}
+
+// RotateSecret generate new HMAC secret. The secret is only shown on this response
+func (a *AdminService) RotateSecret(w http.ResponseWriter, r *http.Request) (*ClientResponse, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	client, err := a.clients.RotateSecret(r.Context(), r.PathValue("clientKey"))
+	if err != nil {
+		return nil, clientError(r, "RotateSecret", err)
+	}
+
+	return toResponse(client), nil
+}
+
+func (a *AdminService) SetPublicKey(w http.ResponseWriter, r *http.Request) (*ClientResponse, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	var payload PublicKeyRequest
+	if errCode := validateBody(w, r, &payload); errCode != nil {
+		return nil, errCode
+	}
+
+	client, err := a.clients.SetPublicKey(r.Context(), r.PathValue("clientKey"), payload.PublicKey)
+	if err != nil {
+		return nil, clientError(r, "SetPublicKey", err)
+	}
+
+	return toResponse(client), nil
+}
+
+// SetSignatureMethod switch service signature of client between hmac and asymmetric
+func (a *AdminService) SetSignatureMethod(w http.ResponseWriter, r *http.Request) (*ClientResponse, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	var payload SignatureMethodRequest
+	if errCode := validateBody(w, r, &payload); errCode != nil {
+		return nil, errCode
+	}
+
+	client, err := a.clients.SetSignatureMethod(r.Context(), r.PathValue("clientKey"), payload.SignatureMethod)
+	if err != nil {
+		return nil, clientError(r, "SetSignatureMethod", err)
+	}
+
+	return toResponse(client), nil
+}
+
+// SetSignatureComponents replace components which message signature (RFC 9421) of client must cover
+func (a *AdminService) SetSignatureComponents(w http.ResponseWriter, r *http.Request) (*ClientResponse, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	var payload SignatureComponentsRequest
+	if errCode := validateBody(w, r, &payload); errCode != nil {
+		return nil, errCode
+	}
+
+	client, err := a.clients.SetSignatureComponents(r.Context(), r.PathValue("clientKey"), payload.SignatureComponents)
+	if err != nil {
+		return nil, clientError(r, "SetSignatureComponents", err)
+	}
+
+	return toResponse(client), nil
+}
+
+// SetCertificate map client certificate (mTLS) to client, token endpoint authenticate client
+// by the certificate instead of, or in addition to X-Signature
+func (a *AdminService) SetCertificate(w http.ResponseWriter, r *http.Request) (*ClientResponse, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	var payload CertificateRequest
+	if errCode := validateBody(w, r, &payload); errCode != nil {
+		return nil, errCode
+	}
+
+	client, err := a.clients.SetCertificate(r.Context(), r.PathValue("clientKey"), payload.TLSAuth,
+		payload.CertificateFingerprint, payload.CertificateSubject)
+	if err != nil {
+		return nil, clientError(r, "SetCertificate", err)
+	}
+
+	return toResponse(client), nil
+}
+
+// Unlock clear failed authentication counter and lockout of client key and / or source IP
+func (a *AdminService) Unlock(w http.ResponseWriter, r *http.Request) (*res.Message, *res.Message) {
+	if errCode := validateHeader(r, a.cfg.Admin.TokenHash); errCode != nil {
+		return nil, errCode
+	}
+
+	var payload UnlockRequest
+	if errCode := validateBody(w, r, &payload); errCode != nil {
+		return nil, errCode
+	}
+
+	var keys []string
+	if payload.ClientKey != "" {
+		keys = append(keys, lockout.ClientKey(payload.ClientKey))
+	}
+	if payload.IP != "" {
+		keys = append(keys, lockout.IP(payload.IP))
+	}
+
+	if len(keys) == 0 {
+		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field clientKey")
+	}
+
+	if err := a.locks.Reset(r.Context(), keys...); err != nil {
+		if logger, _ := logging.FromContext(r.Context()); logger != nil {
+			logger.Error("Unlock", slog.String("error", err.Error()))
+		}
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	if logger, _ := logging.FromContext(r.Context()); logger != nil {
+		logger.Info("Security Event", slog.String("event", "unlock"), slog.String("clientKey", payload.ClientKey), slog.String("ip", payload.IP))
+	}
+
+	return &res.Message{
+		HttpStatus:      http.StatusOK,
+		ResponseCode:    "200" + ServiceCode + "00",
+		ResponseMessage: "Success",
+	}, nil
+}
+
+// clientError map error of client manager to response
+func clientError(r *http.Request, action string, err error) *res.Message {
+	switch {
+	case errors.Is(err, clients.ErrNotFound):
+		return res.BadResponse(http.StatusNotFound, ServiceCode, "00", "Client Not Found")
+
+	case errors.Is(err, clients.ErrInvalidScope):
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format scopes")
+
+	case errors.Is(err, clients.ErrInvalidPublicKey):
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format publicKey")
+
+	case errors.Is(err, clients.ErrInvalidSignatureMethod):
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format signatureMethod")
+
+	case errors.Is(err, clients.ErrInvalidComponents):
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format signatureComponents")
+
+	case errors.Is(err, clients.ErrInvalidTLSAuth):
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format tlsAuth")
+
+	case errors.Is(err, clients.ErrInvalidFingerprint):
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format certificateFingerprint")
+
+	case errors.Is(err, clients.ErrCertificateRequired):
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field certificateFingerprint")
+
+	case errors.Is(err, clients.ErrPublicKeyRequired):
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field publicKey")
+
+	case errors.Is(err, clients.ErrEncryptionNotConfigured):
+		// client secret is only stored encrypted, server need Encryption.MasterKeys
+		return res.BadResponse(http.StatusServiceUnavailable, ServiceCode, "01", "Service Unavailable. Encryption Not Configured")
+
+	default:
+		if logger, _ := logging.FromContext(r.Context()); logger != nil {
+			logger.Error(action, slog.String("error", err.Error()))
+		}
+		return res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+}
+
+func toResponse(client *clients.Client) *ClientResponse {
+	return &ClientResponse{
+		ResponseCode:           "200" + ServiceCode + "00",
+		ResponseMessage:        "Success",
+		ClientKey:              client.Key,
+		ClientSecret:           client.Secret,
+		Status:                 client.Status,
+		Scopes:                 client.Scopes,
+		PublicKey:              client.PublicKey,
+		SignatureMethod:        client.SignatureMethod,
+		SignatureComponents:    client.SignatureComponents,
+		TLSAuth:                client.TLSAuth,
+		CertificateFingerprint: client.CertificateFingerprint,
+		CertificateSubject:     client.CertificateSubject,
+	}
+}
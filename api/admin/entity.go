@@ -0,0 +1,70 @@
+package admin
+
+type RequestHeader struct {
+	ContentType   string `header:"Content-Type"`
+	Authorization string `header:"Authorization" validate:"required"`
+}
+
+type CreateClientRequest struct {
+	// space separated allowed scopes, todo:read and / or todo:write. Empty allow both
+	Scopes string `json:"scopes" validate:"max=512"`
+	// optional, PEM encoded public key
+	PublicKey string `json:"publicKey" validate:"max=4096"`
+	// optional, hmac (default) or asymmetric. asymmetric require publicKey
+	SignatureMethod string `json:"signatureMethod" validate:"omitempty,oneof=hmac asymmetric"`
+}
+
+type PublicKeyRequest struct {
+	PublicKey string `json:"publicKey" validate:"required,max=4096"`
+}
+
+type SignatureMethodRequest struct {
+	// hmac or asymmetric
+	SignatureMethod string `json:"signatureMethod" validate:"required,oneof=hmac asymmetric"`
+}
+
+type SignatureComponentsRequest struct {
+	// space separated components which message signature must cover, empty reset to default
+	SignatureComponents string `json:"signatureComponents" validate:"max=512"`
+}
+
+type CertificateRequest struct {
+	// none, certificate (instead of X-Signature) or both
+	TLSAuth string `json:"tlsAuth" validate:"required,oneof=none certificate both"`
+	// hex SHA-256 of client certificate, colon separator is allowed
+	CertificateFingerprint string `json:"certificateFingerprint" validate:"max=128"`
+	// subject DN of client certificate, ex: CN=partner,O=Bank
+	CertificateSubject string `json:"certificateSubject" validate:"max=512"`
+}
+
+type UnlockRequest struct {
+	// client key to unlock, optional when ip is given
+	ClientKey string `json:"clientKey" validate:"max=64"`
+	// source IP to unlock, optional when clientKey is given
+	IP string `json:"ip" validate:"omitempty,ip"`
+}
+
+type ClientResponse struct {
+	ResponseCode    string `json:"responseCode"`
+	ResponseMessage string `json:"responseMessage"`
+	ClientKey       string `json:"clientKey"`
+	// only returned once, on create and rotate secret
+	ClientSecret string `json:"clientSecret,omitempty"`
+	Status       string `json:"status"`
+	Scopes       string `json:"scopes"`
+	PublicKey    string `json:"publicKey"`
+	// hmac or asymmetric
+	SignatureMethod string `json:"signatureMethod"`
+	// space separated components which message signature must cover, empty is default
+	SignatureComponents string `json:"signatureComponents"`
+	// none, certificate or both
+	TLSAuth                string `json:"tlsAuth"`
+	CertificateFingerprint string `json:"certificateFingerprint"`
+	CertificateSubject     string `json:"certificateSubject"`
+}
+
+type ClientListResponse struct {
+	ResponseCode    string            `json:"responseCode"`
+	ResponseMessage string            `json:"responseMessage"`
+	Clients         []*ClientResponse `json:"clients"`
+}
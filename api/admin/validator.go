@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	res "github.com/arthben/http_jwt_crud/internal/response"
+	bindhttp "github.com/arthben/http_jwt_crud/pkg/bind_http"
+	"github.com/go-playground/validator/v10"
+)
+
+const ServiceCode = "90"
+
+// validateHeader authenticate admin with bearer token, compared to sha256 of token on config.
+// Content-Type is only required on request other than GET
+func validateHeader(r *http.Request, tokenHash string) *res.Message {
+	var header RequestHeader
+
+	if err := bindhttp.BindHeader(r.Header, &header); err != nil {
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(&header); err != nil {
+		// check if struct is nill
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			return res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+		}
+
+		for _, ve := range err.(validator.ValidationErrors) {
+			switch ve.Field() {
+			case "Authorization":
+				return res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field Authorization")
+
+			default:
+				return res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+			}
+		}
+	}
+
+	// validate content-type, GET has no body so it does not need one
+	if r.Method != http.MethodGet {
+		if len(header.ContentType) == 0 {
+			return res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field Content-Type")
+		}
+
+		if header.ContentType != "application/json" {
+			return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format Content-Type")
+		}
+	}
+
+	token, ok := strings.CutPrefix(header.Authorization, "Bearer ")
+	if !ok || len(strings.TrimSpace(token)) == 0 {
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format Authorization")
+	}
+
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(tokenHash))) != 1 {
+		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Invalid Admin Token")
+	}
+
+	return nil
+}
+
+func validateBody(w http.ResponseWriter, r *http.Request, payload any) *res.Message {
+	if err := bindhttp.BindBody(w, r, payload); err != nil {
+		return res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(payload); err != nil {
+		// check if the struct is nill
+		if _, ok := err.(*validator.InvalidValidationError); ok {
+			return res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+		}
+
+		for _, ve := range err.(validator.ValidationErrors) {
+			if ve.Tag() == "required" {
+				return res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field "+ve.Field())
+			}
+			return res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format "+ve.Field())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateHeader(t *testing.T) {
+	sum := sha256.Sum256([]byte("secret-admin-token"))
+	tokenHash := hex.EncodeToString(sum[:])
+
+	for _, ts := range []struct {
+		name          string
+		method        string
+		contentType   string
+		authorization string
+		responseCode  string
+	}{
+		{"Failed. Without Authorization", http.MethodGet, "application/json", "", "4009002"},
+		{"Failed. Without Content-Type", http.MethodPost, "", "Bearer secret-admin-token", "4009002"},
+		{"Failed. Invalid Content-Type", http.MethodPost, "text/plain", "Bearer secret-admin-token", "4009001"},
+		{"Failed. Not Bearer", http.MethodGet, "application/json", "Basic secret-admin-token", "4009001"},
+		{"Failed. Invalid Admin Token", http.MethodGet, "application/json", "Bearer invalid", "4019000"},
+		{"Success", http.MethodPost, "application/json", "Bearer secret-admin-token", ""},
+		{"Success. GET Without Content-Type", http.MethodGet, "", "Bearer secret-admin-token", ""},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			r := httptest.NewRequest(ts.method, "/admin/v1.0/clients", nil)
+			if ts.contentType != "" {
+				r.Header.Set("Content-Type", ts.contentType)
+			}
+			if ts.authorization != "" {
+				r.Header.Set("Authorization", ts.authorization)
+			}
+
+			errCode := validateHeader(r, tokenHash)
+			switch {
+			case ts.responseCode == "" && errCode != nil:
+				t.Errorf("Expected success, got %s", errCode.ResponseCode)
+			case ts.responseCode != "" && (errCode == nil || errCode.ResponseCode != ts.responseCode):
+				t.Errorf("Expected response code %s, got %v", ts.responseCode, errCode)
+			}
+		})
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	for _, ts := range []struct {
+		name         string
+		body         string
+		payload      any
+		responseCode string
+	}{
+		{"Failed. Invalid JSON", `{"signatureMethod":`, &CreateClientRequest{}, "4009000"},
+		{"Failed. Unknown Signature Method", `{"signatureMethod":"rsa"}`, &CreateClientRequest{}, "4009001"},
+		{"Failed. Missing Signature Method", `{}`, &SignatureMethodRequest{}, "4009002"},
+		{"Failed. Unknown TLS Auth", `{"tlsAuth":"always"}`, &CertificateRequest{}, "4009001"},
+		{"Failed. Invalid IP", `{"ip":"not-an-ip"}`, &UnlockRequest{}, "4009001"},
+		{"Success", `{"scopes":"todo:read","signatureMethod":"hmac"}`, &CreateClientRequest{}, ""},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/admin/v1.0/clients", strings.NewReader(ts.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			errCode := validateBody(w, r, ts.payload)
+			switch {
+			case ts.responseCode == "" && errCode != nil:
+				t.Errorf("Expected success, got %s", errCode.ResponseCode)
+			case ts.responseCode != "" && (errCode == nil || errCode.ResponseCode != ts.responseCode):
+				t.Errorf("Expected response code %s, got %v", ts.responseCode, errCode)
+			}
+		})
+	}
+}
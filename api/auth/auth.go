@@ -1,31 +1,104 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/arthben/http_jwt_crud/internal/clientip"
+	"github.com/arthben/http_jwt_crud/internal/clients"
 	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/arthben/http_jwt_crud/internal/lockout"
+	"github.com/arthben/http_jwt_crud/internal/logging"
+	"github.com/arthben/http_jwt_crud/internal/refresh"
+	"github.com/arthben/http_jwt_crud/internal/replay"
 	res "github.com/arthben/http_jwt_crud/internal/response"
+	"github.com/arthben/http_jwt_crud/internal/revocation"
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
 type AuthService struct {
-	cfg *config.EnvParams
+	cfg           *config.EnvParams
+	clients       clients.Store
+	keys          *keySet
+	revoked       revocation.Store
+	refreshTokens refresh.Store
+	replay        *replay.Guard
+	locks         *lockout.Lockout
+	trusted       trustedIssuers
+	clientIP      *clientip.Resolver
 }
 
-func NewAuthService(cfg *config.EnvParams) *AuthService {
-	return &AuthService{cfg: cfg}
+func NewAuthService(
+	cfg *config.EnvParams,
+	clientStore clients.Store,
+	revoked revocation.Store,
+	refreshTokens refresh.Store,
+	guard *replay.Guard,
+	locks *lockout.Lockout,
+) *AuthService {
+	return &AuthService{
+		cfg:           cfg,
+		clients:       clientStore,
+		keys:          newKeySet(cfg),
+		revoked:       revoked,
+		refreshTokens: refreshTokens,
+		replay:        guard,
+		locks:         locks,
+		trusted:       newTrustedIssuers(cfg),
+		clientIP:      clientip.New(cfg),
+	}
+}
+
+// Run start background refresh of trusted issuer JWKS until ctx is done
+func (a *AuthService) Run(ctx context.Context) {
+	interval, _ := strconv.Atoi(a.cfg.TrustedIssuers.RefreshInterval)
+	a.trusted.run(ctx, time.Duration(interval)*time.Second)
 }
 
-func (a *AuthService) ValidateAccessToken(accessToken string, serviceCode string) *res.Message {
-	pubKey := []byte(a.cfg.Server.PublicKey)
-	if errCode := validateToken(a.cfg.Token.Issuer, accessToken, serviceCode, pubKey); errCode != nil {
-		return errCode
+// VerifyAccessToken verify access token, make sure it was issued to clientKey and not revoked,
+// and return the principal of the token without Client.
+// Certificate-bound token is only accepted with the client certificate of the given thumbprint
+func (a *AuthService) VerifyAccessToken(ctx context.Context, accessToken string, clientKey string, thumbprint string, serviceCode string) (*Principal, *res.Message) {
+	claims, errCode := a.validateToken(ctx, accessToken, serviceCode)
+	if errCode != nil {
+		return nil, errCode
 	}
 
-	return nil
+	if claims["sub"] != clientKey || !matchThumbprint(claims, thumbprint) {
+		return nil, res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
+	}
+
+	jti, _ := claims["jti"].(string)
+	revoked, err := a.revoked.Revoked(ctx, jti)
+	if err != nil {
+		return nil, res.BadResponse(http.StatusInternalServerError, serviceCode, "00", "Error Internal Server")
+	}
+
+	if revoked {
+		return nil, res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
+	}
+
+	// scopes are checked by the route, see RequireScope
+	scope, _ := claims["scope"].(string)
+	return &Principal{ClientID: clientKey, Scopes: strings.Fields(scope), TokenID: jti}, nil
+}
+
+// JWKS return public keys which can verify access token
+func (a *AuthService) JWKS() *JWKSResponse {
+	return &JWKSResponse{Keys: a.keys.jwks()}
 }
 
 func (a *AuthService) GetAccessToken(w http.ResponseWriter, r *http.Request) (*TokenResponse, *res.Message) {
@@ -34,38 +107,145 @@ func (a *AuthService) GetAccessToken(w http.ResponseWriter, r *http.Request) (*T
 		return nil, errHeader
 	}
 
-	_, errBody := validateBody(w, r)
+	payload, errBody := validateBody(w, r)
 	if errBody != nil {
 		return nil, errBody
 	}
 
-	// validate client key
-	if a.cfg.Client.Key != header.ClientKey {
-		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unathorized. Unknown Client")
+	// refresh token alone does not authenticate, client is authenticated on every grant
+	client, errClient := a.authenticateClient(w, r, header, payload)
+	if errClient != nil {
+		return nil, errClient
 	}
 
-	pubKey := []byte(a.cfg.Client.PublicKey)
-	strToSign := strings.Join([]string{a.cfg.Client.Key, header.Timestamp}, "|")
-	if errSignature := validateSignature(header, strToSign, pubKey); errSignature != nil {
-		return nil, errSignature
+	if payload.GrantType == GrantTypeRefresh {
+		return a.refreshAccessToken(r, client, payload)
 	}
 
-	// generate access token
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(a.cfg.Server.PrivateKey))
+	scope, ok := grantScopes(payload.Scope, client.AllowedScopes())
+	if !ok {
+		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format scope")
+	}
+
+	return a.issueToken(r.Context(), client, nil, scope, CertificateThumbprint(r))
+}
+
+// refreshAccessToken redeem refresh token of authenticated client for new access token and new refresh token.
+// Reused refresh token revoke the whole family, including access tokens issued with it
+func (a *AuthService) refreshAccessToken(r *http.Request, client *clients.Client, payload *TokenRequest) (*TokenResponse, *res.Message) {
+	ctx := r.Context()
+	thumbprint := CertificateThumbprint(r)
+
+	// token is validated before it is marked as used, so rejected request does not burn the token
+	var errCode *res.Message
+	token, err := a.refreshTokens.Use(ctx, hashToken(payload.RefreshToken), func(token *refresh.Token) bool {
+		errCode = checkRefreshToken(token, client, thumbprint)
+		return errCode == nil
+	})
 	if err != nil {
-		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Signature")
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	// used token is not checked by Use, reuse by other client must not revoke the family
+	if token == nil || token.ClientKey != client.Key || time.Now().After(token.Expired) {
+		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "01", "Unauthorized. Invalid Refresh Token")
+	}
+
+	if token.Used {
+		if logger, _ := logging.FromContext(ctx); logger != nil {
+			logger.Warn("Refresh Token Reused", slog.String("clientKey", token.ClientKey), slog.String("family", token.Family))
+		}
+
+		if err := a.revokeFamily(ctx, token.Family); err != nil {
+			return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+		}
+		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "01", "Unauthorized. Invalid Refresh Token")
+	}
+
+	if errCode != nil {
+		return nil, errCode
+	}
+
+	// scope can only be narrowed, and scope which no longer allowed for client is dropped
+	var allowed []string
+	for _, scope := range strings.Fields(token.Scope) {
+		if slices.Contains(client.AllowedScopes(), scope) {
+			allowed = append(allowed, scope)
+		}
+	}
+
+	scope, ok := grantScopes(payload.Scope, allowed)
+	if !ok {
+		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format scope")
+	}
+
+	return a.issueToken(ctx, client, token, scope, token.Thumbprint)
+}
+
+// checkRefreshToken validate unused refresh token against the client of the request
+func checkRefreshToken(token *refresh.Token, client *clients.Client, thumbprint string) *res.Message {
+	if token.ClientKey != client.Key || time.Now().After(token.Expired) {
+		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "01", "Unauthorized. Invalid Refresh Token")
+	}
+
+	// certificate-bound family stay bound, refresh is only accepted with the same certificate
+	if token.Thumbprint != "" && subtle.ConstantTimeCompare([]byte(token.Thumbprint), []byte(thumbprint)) != 1 {
+		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Client Certificate")
+	}
+
+	return nil
+}
+
+// revokeFamily mark every refresh token of the family as used and revoke their access token
+func (a *AuthService) revokeFamily(ctx context.Context, family string) error {
+	tokens, err := a.refreshTokens.UseFamily(ctx, family)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, token := range tokens {
+		if now.After(token.AccessExpired) {
+			continue
+		}
+
+		if err := a.revoked.Revoke(ctx, token.AccessJTI, token.AccessExpired); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// issueToken sign access token of granted scope for client. Refresh token is issued when enabled,
+// nil parent start a new family, rotated refresh token keep family and expiry of parent.
+// Token is bound to client certificate (RFC 8705) when thumbprint is given
+func (a *AuthService) issueToken(ctx context.Context, client *clients.Client, parent *refresh.Token, scope string, thumbprint string) (*TokenResponse, *res.Message) {
+	kid, signingKey, err := a.keys.signer()
+	if err != nil {
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
 	}
 
 	claims := make(jwt.MapClaims)
 	expTime, _ := strconv.Atoi(a.cfg.Token.Expire)
 	now := time.Now()
-	exp := time.Duration(expTime) * time.Second
+	exp := now.Add(time.Duration(expTime) * time.Second)
+	jti := uuid.New().String()
 	claims["iat"] = now.Unix()
 	claims["iss"] = a.cfg.Token.Issuer
-	claims["exp"] = now.Add(exp).Unix()
+	claims["exp"] = exp.Unix()
+	claims["sub"] = client.Key
+	claims["client_id"] = client.Key
+	claims["aud"] = a.cfg.Token.Audience
+	claims["jti"] = jti
+	claims["scope"] = scope
+	if thumbprint != "" {
+		claims["cnf"] = map[string]string{ThumbprintClaim: thumbprint}
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	strToken, err := token.SignedString(privateKey)
+	token := jwt.NewWithClaims(signingKey.Method, claims)
+	token.Header["kid"] = kid
+	strToken, err := token.SignedString(signingKey.Private)
 	if err != nil {
 		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Signature")
 	}
@@ -76,6 +256,248 @@ func (a *AuthService) GetAccessToken(w http.ResponseWriter, r *http.Request) (*T
 		AccessToken:     strToken,
 		TokenType:       "Bearer",
 		ExpiresIn:       a.cfg.Token.Expire,
+		Scope:           scope,
+	}
+
+	refreshExpire, _ := strconv.Atoi(a.cfg.Token.RefreshExpire)
+	if refreshExpire == 0 {
+		return resp, nil
 	}
+
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	// rotation never extend the family, leaked refresh token can not be refreshed forever
+	family := uuid.New().String()
+	expired := now.Add(time.Duration(refreshExpire) * time.Second)
+	if parent != nil {
+		family = parent.Family
+		expired = parent.Expired
+	}
+
+	err = a.refreshTokens.Add(ctx, &refresh.Token{
+		Hash:          hashToken(refreshToken),
+		Family:        family,
+		ClientKey:     client.Key,
+		Scope:         scope,
+		Thumbprint:    thumbprint,
+		AccessJTI:     jti,
+		AccessExpired: exp,
+		Expired:       expired,
+	})
+	if err != nil {
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	resp.RefreshToken = refreshToken
+	resp.RefreshExpiresIn = strconv.Itoa(int(expired.Sub(now).Seconds()))
 	return resp, nil
 }
+
+// RevokeToken add access token to denylist until it expires (RFC 7009).
+// Client can only revoke its own token, invalid or expired token is ignored
+func (a *AuthService) RevokeToken(w http.ResponseWriter, r *http.Request) (*res.Message, *res.Message) {
+	header, errHeader := validateHeader(r)
+	if errHeader != nil {
+		return nil, errHeader
+	}
+
+	payload, errBody := validateTokenBody(w, r)
+	if errBody != nil {
+		return nil, errBody
+	}
+
+	client, errClient := a.authenticateClient(w, r, header, payload)
+	if errClient != nil {
+		return nil, errClient
+	}
+
+	resp := &res.Message{
+		HttpStatus:      http.StatusOK,
+		ResponseCode:    "200" + ServiceCode + "00",
+		ResponseMessage: "Success",
+	}
+
+	claims, errCode := a.validateToken(r.Context(), payload.Token, ServiceCode)
+	if errCode != nil {
+		return resp, nil
+	}
+
+	if claims["sub"] != client.Key {
+		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "01", "Unauthorized. Invalid Token")
+	}
+
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	if err := a.revoked.Revoke(r.Context(), jti, time.Unix(int64(exp), 0)); err != nil {
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	return resp, nil
+}
+
+// IntrospectToken return state of access token (RFC 7662).
+// Token issued to other client is reported as inactive
+func (a *AuthService) IntrospectToken(w http.ResponseWriter, r *http.Request) (*IntrospectResponse, *res.Message) {
+	header, errHeader := validateHeader(r)
+	if errHeader != nil {
+		return nil, errHeader
+	}
+
+	payload, errBody := validateTokenBody(w, r)
+	if errBody != nil {
+		return nil, errBody
+	}
+
+	client, errClient := a.authenticateClient(w, r, header, payload)
+	if errClient != nil {
+		return nil, errClient
+	}
+
+	resp := &IntrospectResponse{
+		ResponseCode:    "200" + ServiceCode + "00",
+		ResponseMessage: "Success",
+	}
+
+	claims, errCode := a.validateToken(r.Context(), payload.Token, ServiceCode)
+	if errCode != nil || claims["sub"] != client.Key {
+		return resp, nil
+	}
+
+	jti, _ := claims["jti"].(string)
+	revoked, err := a.revoked.Revoked(r.Context(), jti)
+	if err != nil {
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	if revoked {
+		return resp, nil
+	}
+
+	iat, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	resp.Active = true
+	resp.Scope, _ = claims["scope"].(string)
+	resp.ClientID = client.Key
+	resp.Subject = client.Key
+	resp.TokenType = "Bearer"
+	resp.Issuer, _ = claims["iss"].(string)
+	resp.Audience = a.cfg.Token.Audience
+	if issuer, ok := a.trusted[resp.Issuer]; ok {
+		resp.Audience = issuer.Audience
+	}
+	resp.IssuedAt = int64(iat)
+	resp.ExpiresAt = int64(exp)
+	resp.JTI = jti
+	if thumbprint := boundThumbprint(claims); thumbprint != "" {
+		resp.Cnf = map[string]string{ThumbprintClaim: thumbprint}
+	}
+
+	return resp, nil
+}
+
+// authenticateClient verify client key and the asymmetric signature of client key + timestamp,
+// and / or the client certificate when client authenticate with mTLS.
+// Request is only accepted once within the timestamp window.
+// Client key and source IP are locked out after repeated unknown client or invalid signature.
+// payload is the decoded body, only used as nonce of request without signature
+func (a *AuthService) authenticateClient(w http.ResponseWriter, r *http.Request, header *TokenHeader, payload any) (*clients.Client, *res.Message) {
+	ctx := r.Context()
+
+	// failures are counted per client key and per source IP, so guessing is slowed down on both
+	lockKeys := []string{lockout.ClientKey(header.ClientKey), lockout.IP(a.clientIP.IP(r))}
+	locked, err := a.locks.Check(ctx, lockKeys...)
+	if err != nil {
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	if locked > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.Seconds()))))
+		return nil, res.BadResponse(http.StatusTooManyRequests, ServiceCode, "01", "Too Many Failed Attempts")
+	}
+
+	// format already checked by validateHeader
+	ts, _ := ParseTimestamp(header.Timestamp)
+	if err := a.replay.CheckTimestamp(ts); err != nil {
+		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Invalid Timestamp")
+	}
+
+	client, err := a.clients.Get(ctx, header.ClientKey)
+	if err != nil && !errors.Is(err, clients.ErrNotFound) {
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	if client == nil || !client.Active() {
+		a.fail(ctx, lockKeys)
+		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unathorized. Unknown Client")
+	}
+
+	// client certificate (mTLS) replace or complement X-Signature, see clients.TLSAuthCertificate
+	if client.CertificateRequired() && !client.MatchCertificate(peerCertificate(r)) {
+		a.fail(ctx, lockKeys)
+		return nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Client Certificate")
+	}
+
+	if client.SignatureRequired() {
+		if len(header.Signature) == 0 {
+			return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field X-SIGNATURE")
+		}
+
+		pubKey := []byte(client.PublicKey)
+		strToSign := strings.Join([]string{client.Key, header.Timestamp}, "|")
+		if errSignature := validateSignature(header, strToSign, pubKey); errSignature != nil {
+			a.fail(ctx, lockKeys)
+			return nil, errSignature
+		}
+	}
+
+	// source IP is not reset, one valid client must not clear guessing of others behind the same address
+	if err := a.locks.Reset(ctx, lockout.ClientKey(client.Key)); err != nil {
+		if logger, _ := logging.FromContext(ctx); logger != nil {
+			logger.Warn("Lockout Reset", slog.String("error", err.Error()))
+		}
+	}
+
+	// X-External-ID is not signed, so the signature is the nonce.
+	// Request authenticated by certificate only use its content, so only identical request is rejected
+	nonce := header.Signature
+	if nonce == "" {
+		body, _ := json.Marshal(payload)
+		nonce = strings.Join([]string{r.Method, r.URL.RequestURI(), string(body), header.Timestamp}, "\n")
+	}
+
+	if err := a.replay.Check(ctx, client.Key, nonce); err != nil {
+		if errors.Is(err, replay.ErrReplayed) {
+			return nil, res.BadResponse(http.StatusConflict, ServiceCode, "00", "Conflict. Duplicate Request")
+		}
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	return client, nil
+}
+
+// fail count failed authentication, counter error must not hide the authentication error
+func (a *AuthService) fail(ctx context.Context, lockKeys []string) {
+	if err := a.locks.Fail(ctx, lockKeys...); err != nil {
+		if logger, _ := logging.FromContext(ctx); logger != nil {
+			logger.Warn("Lockout Fail", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// generateRefreshToken return random opaque token
+func generateRefreshToken() (string, error) {
+	buff := make([]byte, 32)
+	if _, err := rand.Read(buff); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buff), nil
+}
+
+// hashToken return sha256 hex of refresh token, only the hash is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
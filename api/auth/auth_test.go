@@ -0,0 +1,375 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/clientip"
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/arthben/http_jwt_crud/internal/lockout"
+	"github.com/arthben/http_jwt_crud/internal/refresh"
+	"github.com/arthben/http_jwt_crud/internal/replay"
+	res "github.com/arthben/http_jwt_crud/internal/response"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+func TestTokenBoundToClient(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a := newTestService(map[string][]byte{"2024": encodePrivate(t, key)}, nil, "2024", "")
+	accessToken := issueFor(t, a, "client-a")
+
+	principal, errCode := a.VerifyAccessToken(context.Background(), accessToken, "client-a", "", "24")
+	if errCode != nil || principal.ClientID != "client-a" {
+		t.Errorf("Expected token valid for client-a, got %v", errCode)
+	}
+
+	// X-Client-Key of other client
+	if _, errCode := a.VerifyAccessToken(context.Background(), accessToken, "client-b", "", "24"); errCode == nil || errCode.ResponseCode != "4012401" {
+		t.Errorf("Expected token of client-a is rejected for client-b, got %v", errCode)
+	}
+}
+
+func TestTokenAudience(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := map[string][]byte{"2024": encodePrivate(t, key)}
+	a := newTestService(keys, nil, "2024", "")
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = "2024"
+		accessToken, _ := token.SignedString(key)
+		return accessToken
+	}
+	claims := func(aud any) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": a.cfg.Token.Issuer,
+			"sub": "client",
+			"exp": time.Now().Add(time.Minute).Unix(),
+			"jti": "jti",
+		}
+		if aud != nil {
+			c["aud"] = aud
+		}
+		return c
+	}
+
+	for _, ts := range []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"Success", sign(claims(a.cfg.Token.Audience)), true},
+		{"Success. Audience On List", sign(claims([]string{"other", a.cfg.Token.Audience})), true},
+		{"Failed. Wrong Audience", sign(claims("other-service")), false},
+		{"Failed. Without Audience", sign(claims(nil)), false},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			_, errCode := a.VerifyAccessToken(context.Background(), ts.token, "client", "", "24")
+			if ts.valid && errCode != nil {
+				t.Errorf("Expected token valid, got %s", errCode.ResponseMessage)
+			}
+			if !ts.valid && errCode == nil {
+				t.Errorf("Expected token is rejected")
+			}
+		})
+	}
+
+	// token issued for other audience by the same signing key
+	other := newTestService(keys, nil, "2024", "")
+	other.cfg.Token.Audience = "other-service"
+	if _, errCode := a.VerifyAccessToken(context.Background(), issue(t, other), "client", "", "24"); errCode == nil {
+		t.Errorf("Expected token of other audience is rejected")
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a := newTestService(map[string][]byte{"2024": encodePrivate(t, key)}, nil, "2024", "")
+	a.cfg.Token.RefreshExpire = "3600"
+	store := refresh.NewMemoryStore()
+	a.refreshTokens = store
+	client := &clients.Client{Key: "client", Scopes: "todo:read todo:write"}
+
+	withCertificate := func(raw string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", nil)
+		cert := &x509.Certificate{Raw: []byte(raw)}
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return r
+	}
+	// stored return refresh token as it is stored, the token stay unused
+	stored := func(refreshToken string) *refresh.Token {
+		token, _ := store.Use(context.Background(), hashToken(refreshToken), func(*refresh.Token) bool { return false })
+		if token == nil {
+			t.Fatalf("refresh token is not stored")
+		}
+		return token
+	}
+
+	thumbprint := CertificateThumbprint(withCertificate("partner"))
+	first, errCode := a.issueToken(context.Background(), client, nil, "todo:read todo:write", thumbprint)
+	if errCode != nil {
+		t.Fatalf("issue token: %s", errCode.ResponseMessage)
+	}
+	parent := stored(first.RefreshToken)
+
+	// refresh token of bound grant is redeemed with the same certificate only
+	time.Sleep(1100 * time.Millisecond)
+	second, errCode := a.refreshAccessToken(withCertificate("partner"), client, &TokenRequest{RefreshToken: first.RefreshToken, Scope: "todo:read"})
+	if errCode != nil {
+		t.Fatalf("Expected refresh with the same certificate, got %s", errCode.ResponseMessage)
+	}
+
+	// rotation keep family and expiry, and access token stay bound
+	rotated := stored(second.RefreshToken)
+	if rotated.Family != parent.Family || !rotated.Expired.Equal(parent.Expired) || rotated.Thumbprint != thumbprint {
+		t.Errorf("Expected family, expiry and thumbprint of parent, got %+v parent %+v", rotated, parent)
+	}
+	if second.RefreshExpiresIn == first.RefreshExpiresIn {
+		t.Errorf("Expected remaining lifetime, got %s", second.RefreshExpiresIn)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(second.AccessToken, claims); err != nil || boundThumbprint(claims) != thumbprint {
+		t.Errorf("Expected access token bound to certificate of the grant, got %v", claims["cnf"])
+	}
+	if claims["scope"] != "todo:read" {
+		t.Errorf("Expected narrowed scope, got %v", claims["scope"])
+	}
+
+	// without certificate or with other certificate
+	for _, r := range []*http.Request{httptest.NewRequest(http.MethodPost, "/v1.0/access-token", nil), withCertificate("other")} {
+		if _, errCode := a.refreshAccessToken(r, client, &TokenRequest{RefreshToken: second.RefreshToken}); errCode == nil || errCode.ResponseCode != "4017300" {
+			t.Errorf("Expected refresh of bound grant without the certificate is rejected, got %v", errCode)
+		}
+	}
+
+	// refresh token of other client
+	other := &clients.Client{Key: "other"}
+	if _, errCode := a.refreshAccessToken(withCertificate("partner"), other, &TokenRequest{RefreshToken: second.RefreshToken}); errCode == nil || errCode.ResponseCode != "4017301" {
+		t.Errorf("Expected refresh token of other client is rejected, got %v", errCode)
+	}
+
+	// rejected request does not use the token, so the client can still redeem it
+	if stored(second.RefreshToken).Used {
+		t.Errorf("Expected rejected refresh does not mark the token as used")
+	}
+	if _, errCode := a.refreshAccessToken(withCertificate("partner"), client, &TokenRequest{RefreshToken: second.RefreshToken}); errCode != nil {
+		t.Errorf("Expected refresh after rejected attempts, got %s", errCode.ResponseMessage)
+	}
+	if !stored(second.RefreshToken).Used {
+		t.Errorf("Expected redeemed refresh token is marked as used")
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	a := newTestService(nil, nil, "", "")
+	a.clients = clients.NewMemoryStore()
+	a.replay = replay.NewGuard(replay.NewMemoryStore(), time.Minute)
+	a.locks = lockout.NewLockout(lockout.NewMemoryStore(time.Minute), 2, time.Minute, time.Minute)
+	a.clientIP = clientip.NewResolver([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	// each attempt use another unknown client key, only the source IP is counted twice
+	request := func(remoteAddr string, forwarded string) string {
+		r := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", strings.NewReader(`{"grantType":"client_credentials"}`))
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Client-Key", uuid.NewString())
+		r.Header.Set("X-Timestamp", time.Now().Format(time.RFC3339Nano))
+		r.Header.Set("X-Signature", "aW52YWxpZA==")
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-For", forwarded)
+		}
+
+		_, errCode := a.GetAccessToken(httptest.NewRecorder(), r)
+		if errCode == nil {
+			t.Fatalf("Expected unknown client is rejected")
+		}
+		return errCode.ResponseCode
+	}
+
+	for _, ts := range []struct {
+		name         string
+		remoteAddr   string
+		forwarded    string
+		responseCode string
+	}{
+		{"Failed Behind Load Balancer", "10.0.0.1:1234", "203.0.113.7", "4017300"},
+		{"Failed Behind Other Load Balancer", "10.0.0.2:1234", "203.0.113.7", "4017300"},
+		{"Source IP Locked Out", "10.0.0.1:1234", "203.0.113.7", "4297301"},
+		{"Other Client Behind The Same Load Balancer", "10.0.0.1:1234", "203.0.113.8", "4017300"},
+		{"Forged Header From Untrusted Address", "198.51.100.1:1234", "203.0.113.8", "4017300"},
+		{"Forged Header Is Not Counted For Other Client", "10.0.0.1:1234", "203.0.113.8", "4017300"},
+		{"Failed From Untrusted Address", "198.51.100.1:1234", "", "4017300"},
+		{"Untrusted Address Locked Out", "198.51.100.1:1234", "", "4297301"},
+	} {
+		if responseCode := request(ts.remoteAddr, ts.forwarded); responseCode != ts.responseCode {
+			t.Errorf("%s: expected response code '%s', got '%s'", ts.name, ts.responseCode, responseCode)
+		}
+	}
+}
+
+func TestCertificateNonce(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a := newTestService(map[string][]byte{"2024": encodePrivate(t, key)}, nil, "2024", "")
+	a.replay = replay.NewGuard(replay.NewMemoryStore(), time.Minute)
+	a.locks = lockout.NewLockout(lockout.NewMemoryStore(time.Minute), 5, time.Minute, time.Minute)
+
+	cert := &x509.Certificate{Raw: []byte("partner")}
+	a.clients = clients.NewMemoryStore(&clients.Client{
+		Key:                    "partner",
+		Status:                 clients.StatusActive,
+		TLSAuth:                clients.TLSAuthCertificate,
+		CertificateFingerprint: clients.Fingerprint(cert),
+	})
+
+	// request authenticated by certificate only has no signature
+	ts := time.Now().Format(time.RFC3339Nano)
+	request := func(body string) *res.Message {
+		r := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", strings.NewReader(body))
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Client-Key", "partner")
+		r.Header.Set("X-Timestamp", ts)
+
+		_, errCode := a.GetAccessToken(httptest.NewRecorder(), r)
+		return errCode
+	}
+
+	if errCode := request(`{"grantType":"client_credentials","scope":"todo:read"}`); errCode != nil {
+		t.Fatalf("Expected token, got %s", errCode.ResponseMessage)
+	}
+
+	// other request sharing the timestamp is not a replay
+	if errCode := request(`{"grantType":"client_credentials","scope":"todo:write"}`); errCode != nil {
+		t.Errorf("Expected other request with the same timestamp is accepted, got %s", errCode.ResponseMessage)
+	}
+
+	if errCode := request(`{"grantType":"client_credentials","scope":"todo:read"}`); errCode == nil || errCode.ResponseCode != "4097300" {
+		t.Errorf("Expected identical request is rejected, got %v", errCode)
+	}
+}
+
+func TestTrustedIssuerClaims(t *testing.T) {
+	idpKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwksSet, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC",
+		"crv": "P-256",
+		"kid": "idp",
+		"x":   base64.RawURLEncoding.EncodeToString(idpKey.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(idpKey.Y.FillBytes(make([]byte, 32))),
+	}}})
+	jwksFile := t.TempDir() + "/jwks.json"
+	if err := os.WriteFile(jwksFile, jwksSet, 0o600); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	a := newTestService(map[string][]byte{"2024": encodePrivate(t, key)}, nil, "2024", "")
+	a.cfg.TrustedIssuers.MinRefetch = "30"
+	a.cfg.TrustedIssuers.Issuers = []config.TrustedIssuer{{
+		Issuer:   "https://idp.example.com",
+		JWKSFile: jwksFile,
+		Audience: "api://http-jwt-crud",
+		Claims:   config.ClaimMapping{ClientID: "azp", Scope: "scp", TokenID: "uti"},
+	}}
+	a.trusted = newTrustedIssuers(a.cfg)
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = "idp"
+		accessToken, _ := token.SignedString(idpKey)
+		return accessToken
+	}
+	claims := func(exclude string) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": "https://idp.example.com",
+			"aud": "api://http-jwt-crud",
+			"azp": "client",
+			"scp": "todo:read",
+			"uti": "token-id",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+		delete(c, exclude)
+		return c
+	}
+	expired := claims("")
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	emptyID := claims("")
+	emptyID["uti"] = ""
+	longID := claims("")
+	longID["uti"] = strings.Repeat("token-id", 32)
+
+	// token ID of provider is stored hashed with its issuer
+	hashID := func(tokenID string) string {
+		sum := sha256.Sum256([]byte("https://idp.example.com\n" + tokenID))
+		return hex.EncodeToString(sum[:])
+	}
+
+	for _, ts := range []struct {
+		name  string
+		token string
+		valid bool
+		jti   string
+	}{
+		{"Success", sign(claims("")), true, hashID("token-id")},
+		{"Success. Long Token ID", sign(longID), true, hashID(strings.Repeat("token-id", 32))},
+		{"Failed. Without Expiry", sign(claims("exp")), false, ""},
+		{"Failed. Expired", sign(expired), false, ""},
+		{"Failed. Without Token ID", sign(claims("uti")), false, ""},
+		{"Failed. Empty Token ID", sign(emptyID), false, ""},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			mapped, errCode := a.validateToken(context.Background(), ts.token, "24")
+			if ts.valid && (errCode != nil || mapped["sub"] != "client" || mapped["jti"] != ts.jti) {
+				t.Errorf("Expected mapped claims, got %v %v", mapped, errCode)
+			}
+			if !ts.valid && errCode == nil {
+				t.Errorf("Expected token is rejected")
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope("24", func(w http.ResponseWriter, r *http.Request) {}, ScopeTodoWrite)
+
+	for _, ts := range []struct {
+		name      string
+		principal *Principal
+		expected  int
+	}{
+		{name: "Not Authenticated", expected: http.StatusUnauthorized},
+		{name: "Insufficient Scope", principal: &Principal{ClientID: "client", Scopes: []string{ScopeTodoRead}}, expected: http.StatusForbidden},
+		{name: "Granted", principal: &Principal{ClientID: "client", Scopes: []string{ScopeTodoRead, ScopeTodoWrite}}, expected: http.StatusOK},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/v1.0/todo", nil)
+			if ts.principal != nil {
+				request = request.WithContext(WithPrincipal(request.Context(), ts.principal))
+			}
+			responseRecorder := httptest.NewRecorder()
+			handler(responseRecorder, request)
+
+			if responseRecorder.Code != ts.expected {
+				t.Errorf("Expected HTTP %d, not HTTP %d", ts.expected, responseRecorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ThumbprintClaim is confirmation member of certificate-bound access token (RFC 8705)
+const ThumbprintClaim = "x5t#S256"
+
+// peerCertificate return client certificate of mTLS connection which was verified with client CA,
+// nil when request has none
+func peerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// CertificateThumbprint return base64url SHA-256 of client certificate (x5t#S256),
+// empty when request has no verified client certificate
+func CertificateThumbprint(r *http.Request) string {
+	cert := peerCertificate(r)
+	if cert == nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// boundThumbprint return certificate thumbprint which access token is bound to, empty when token is not bound
+func boundThumbprint(claims jwt.MapClaims) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	thumbprint, _ := cnf[ThumbprintClaim].(string)
+	return thumbprint
+}
+
+// matchThumbprint report whether token is not bound, or bound to the certificate of the request
+func matchThumbprint(claims jwt.MapClaims, thumbprint string) bool {
+	bound := boundThumbprint(claims)
+	return bound == "" || subtle.ConstantTimeCompare([]byte(bound), []byte(thumbprint)) == 1
+}
@@ -1,15 +1,27 @@
 package auth
 
-// time_format:"2006-01-02T15:04:05+07:00"
+// X-Timestamp is RFC 3339, see ParseTimestamp
 type TokenHeader struct {
 	ContentType string `header:"Content-Type" validate:"required"`
 	ClientKey   string `header:"X-Client-Key" validate:"required,max=64"`
 	Timestamp   string `header:"X-Timestamp" validate:"required" `
-	Signature   string `header:"X-Signature" validate:"required"`
+	// not required when client authenticate with certificate only
+	Signature string `header:"X-Signature"`
+	// optional request ID for tracing, not signed and not used as nonce
+	ExternalID string `header:"X-External-ID" validate:"max=64"`
 }
 
 type TokenRequest struct {
 	GrantType string `json:"grantType" validate:"required"`
+	// mandatory on refresh_token grant
+	RefreshToken string `json:"refreshToken"`
+	// optional space separated scopes, default is every scope allowed for client
+	Scope string `json:"scope"`
+}
+
+// TokenActionRequest is body of revoke and introspect
+type TokenActionRequest struct {
+	Token string `json:"token" validate:"required"`
 }
 
 type TokenResponse struct {
@@ -18,4 +30,44 @@ type TokenResponse struct {
 	AccessToken     string `json:"accessToken"`
 	TokenType       string `json:"tokenType"`
 	ExpiresIn       string `json:"expiresIn"`
+	Scope           string `json:"scope"`
+	// opaque token, use once on refresh_token grant
+	RefreshToken     string `json:"refreshToken,omitempty"`
+	RefreshExpiresIn string `json:"refreshExpiresIn,omitempty"`
+}
+
+// JWK is public key on JSON Web Key Set (RFC 7517).
+// RSA key has n and e, EC and OKP (Ed25519) key has crv and x (and y for EC)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSResponse struct {
+	Keys []JWK `json:"keys"`
+}
+
+// IntrospectResponse follow RFC 7662, only active is set when token is not active
+type IntrospectResponse struct {
+	ResponseCode    string `json:"responseCode"`
+	ResponseMessage string `json:"responseMessage"`
+	Active          bool   `json:"active"`
+	Scope           string `json:"scope,omitempty"`
+	ClientID        string `json:"client_id,omitempty"`
+	Subject         string `json:"sub,omitempty"`
+	TokenType       string `json:"token_type,omitempty"`
+	Issuer          string `json:"iss,omitempty"`
+	Audience        string `json:"aud,omitempty"`
+	IssuedAt        int64  `json:"iat,omitempty"`
+	ExpiresAt       int64  `json:"exp,omitempty"`
+	JTI             string `json:"jti,omitempty"`
+	// certificate which token is bound to (RFC 8705)
+	Cnf map[string]string `json:"cnf,omitempty"`
 }
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/arthben/http_jwt_crud/internal/signing"
+)
+
+var (
+	ErrNoSigningKey = errors.New("active signing key is not available")
+	ErrUnknownKid   = errors.New("unknown or retired kid")
+)
+
+// keySet hold signing keys by kid. Only active key sign new token,
+// every key which is not retired can verify token
+type keySet struct {
+	active  string
+	keys    map[string]*signing.Key
+	retired map[string]bool
+}
+
+// newKeySet parse signing keys of config
+func newKeySet(cfg *config.EnvParams) *keySet {
+	ks := &keySet{
+		active:  cfg.Server.ActiveKid,
+		keys:    map[string]*signing.Key{},
+		retired: map[string]bool{},
+	}
+
+	for _, kid := range strings.Split(cfg.Server.RetiredKids, ",") {
+		if kid = strings.TrimSpace(kid); kid != "" {
+			ks.retired[kid] = true
+		}
+	}
+
+	for kid, raw := range cfg.Server.Keys {
+		// key and algorithm already validated on config.LoadConfig
+		key, err := signing.ParseKey(raw, cfg.Server.Algorithms[kid])
+		if err != nil {
+			continue
+		}
+		ks.keys[kid] = key
+	}
+
+	return ks
+}
+
+// signer return kid and active key
+func (ks *keySet) signer() (string, *signing.Key, error) {
+	key, ok := ks.keys[ks.active]
+	if !ok || key.Private == nil {
+		return "", nil, ErrNoSigningKey
+	}
+	return ks.active, key, nil
+}
+
+// verifier return key of kid. Token issued before kid was introduced has no kid,
+// it is verified with the legacy "default" key
+func (ks *keySet) verifier(kid string) (*signing.Key, error) {
+	if kid == "" {
+		kid = config.DefaultKid
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok || ks.retired[kid] {
+		return nil, ErrUnknownKid
+	}
+	return key, nil
+}
+
+// jwks return public keys which are not retired, sorted by kid
+func (ks *keySet) jwks() []JWK {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		if !ks.retired[kid] {
+			kids = append(kids, kid)
+		}
+	}
+	sort.Strings(kids)
+
+	keys := make([]JWK, 0, len(kids))
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{
+			Use: "sig",
+			Alg: key.Method.Alg(),
+			Kid: kid,
+		}
+
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+
+		case *ecdsa.PublicKey:
+			// coordinates are padded to the curve size (RFC 7518 section 6.2.1.2)
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = public.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, size)))
+
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		keys = append(keys, jwk)
+	}
+	return keys
+}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/arthben/http_jwt_crud/internal/revocation"
+	"github.com/golang-jwt/jwt"
+)
+
+func encodePrivate(t *testing.T, key crypto.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func encodePublic(t *testing.T, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// newTestService return service which only sign and verify token, refresh token is disabled
+func newTestService(keys map[string][]byte, algorithms map[string]string, active string, retired string) *AuthService {
+	cfg := &config.EnvParams{}
+	cfg.Token.Expire = "300"
+	cfg.Token.RefreshExpire = "0"
+	cfg.Token.Issuer = "http_jwt_crud"
+	cfg.Token.Audience = "http_jwt_crud"
+	cfg.Server.Keys = keys
+	cfg.Server.Algorithms = algorithms
+	cfg.Server.ActiveKid = active
+	cfg.Server.RetiredKids = retired
+	return &AuthService{cfg: cfg, keys: newKeySet(cfg), revoked: revocation.NewMemoryStore()}
+}
+
+func issue(t *testing.T, a *AuthService) string {
+	return issueFor(t, a, "client")
+}
+
+func issueFor(t *testing.T, a *AuthService, clientKey string) string {
+	resp, errCode := a.issueToken(context.Background(), &clients.Client{Key: clientKey}, nil, "todo:read", "")
+	if errCode != nil {
+		t.Fatalf("issue token: %s", errCode.ResponseMessage)
+	}
+	return resp.AccessToken
+}
+
+func tokenKid(t *testing.T, accessToken string) string {
+	token, _, err := new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	a := newTestService(map[string][]byte{
+		"rsa": encodePrivate(t, rsaKey),
+		"ec":  encodePrivate(t, ecKey),
+		"ed":  encodePublic(t, edKey.Public()),
+		"old": encodePrivate(t, oldKey),
+	}, map[string]string{"rsa": "PS256"}, "rsa", "old")
+
+	keys := a.JWKS().Keys
+	if len(keys) != 3 {
+		t.Fatalf("Expected 3 keys without retired kid, got %d", len(keys))
+	}
+
+	// sorted by kid, private part is never published
+	for i, want := range []JWK{
+		{Kty: "EC", Use: "sig", Alg: "ES256", Kid: "ec", Crv: "P-256"},
+		{Kty: "OKP", Use: "sig", Alg: "EdDSA", Kid: "ed", Crv: "Ed25519"},
+		{Kty: "RSA", Use: "sig", Alg: "PS256", Kid: "rsa"},
+	} {
+		got := keys[i]
+		if got.Kty != want.Kty || got.Use != want.Use || got.Alg != want.Alg || got.Kid != want.Kid || got.Crv != want.Crv {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	}
+
+	// EC coordinates are padded to the curve size
+	x, _ := base64.RawURLEncoding.DecodeString(keys[0].X)
+	y, _ := base64.RawURLEncoding.DecodeString(keys[0].Y)
+	if len(x) != 32 || len(y) != 32 || ecKey.X.Cmp(new(big.Int).SetBytes(x)) != 0 || ecKey.Y.Cmp(new(big.Int).SetBytes(y)) != 0 {
+		t.Errorf("Expected 32 bytes coordinates of public key, got x=%d y=%d", len(x), len(y))
+	}
+
+	ed, _ := base64.RawURLEncoding.DecodeString(keys[1].X)
+	if !edKey.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(ed)) {
+		t.Errorf("Expected Ed25519 public key on x")
+	}
+
+	if keys[2].N != base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()) || keys[2].E != "AQAB" {
+		t.Errorf("Expected RSA modulus and exponent, got n=%.16s e=%s", keys[2].N, keys[2].E)
+	}
+}
+
+func TestKidRotation(t *testing.T) {
+	first, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	second, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keys := map[string][]byte{"2023": encodePrivate(t, first)}
+
+	before := newTestService(keys, nil, "2023", "")
+	oldToken := issue(t, before)
+	if kid := tokenKid(t, oldToken); kid != "2023" {
+		t.Errorf("Expected kid 2023, got %s", kid)
+	}
+
+	// new key is active, token of the previous key is still valid
+	keys["2024"] = encodePrivate(t, second)
+	rotated := newTestService(keys, nil, "2024", "")
+	newToken := issue(t, rotated)
+	if kid := tokenKid(t, newToken); kid != "2024" {
+		t.Errorf("Expected kid 2024 after rotation, got %s", kid)
+	}
+	for _, accessToken := range []string{oldToken, newToken} {
+		if _, errCode := rotated.validateToken(context.Background(), accessToken, ServiceCode); errCode != nil {
+			t.Errorf("Expected token valid after rotation, got %s", errCode.ResponseMessage)
+		}
+	}
+
+	// retired key no longer verify token and is removed from JWKS
+	retired := newTestService(keys, nil, "2024", "2023")
+	if _, errCode := retired.validateToken(context.Background(), oldToken, ServiceCode); errCode == nil {
+		t.Errorf("Expected token of retired kid is rejected")
+	}
+	if _, errCode := retired.validateToken(context.Background(), newToken, ServiceCode); errCode != nil {
+		t.Errorf("Expected token of active kid valid, got %s", errCode.ResponseMessage)
+	}
+	if jwks := retired.JWKS().Keys; len(jwks) != 1 || jwks[0].Kid != "2024" {
+		t.Errorf("Expected only kid 2024 on JWKS, got %+v", jwks)
+	}
+
+	// unknown kid is rejected
+	unknown := newTestService(map[string][]byte{"2024": keys["2024"]}, nil, "2024", "")
+	if _, errCode := unknown.validateToken(context.Background(), oldToken, ServiceCode); errCode == nil {
+		t.Errorf("Expected token of unknown kid is rejected")
+	}
+}
+
+func TestLegacyTokenWithoutKid(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	a := newTestService(map[string][]byte{config.DefaultKid: encodePrivate(t, rsaKey)}, nil, config.DefaultKid, "")
+
+	// token issued before kid was introduced
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": a.cfg.Token.Issuer,
+		"aud": a.cfg.Token.Audience,
+		"sub": "client",
+	})
+	accessToken, _ := token.SignedString(rsaKey)
+
+	if _, errCode := a.validateToken(context.Background(), accessToken, ServiceCode); errCode != nil {
+		t.Errorf("Expected token without kid verified by default key, got %s", errCode.ResponseMessage)
+	}
+}
+
+func TestSigningAlgorithm(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	keys := map[string][]byte{
+		"rsa": encodePrivate(t, rsaKey),
+		"ec":  encodePrivate(t, ecKey),
+		"ed":  encodePrivate(t, edKey),
+	}
+	algorithms := map[string]string{"rsa": "PS256"}
+
+	for _, ts := range []struct {
+		kid string
+		alg string
+		kty string
+	}{
+		{"ec", "ES256", "EC"},
+		{"ed", "EdDSA", "OKP"},
+		{"rsa", "PS256", "RSA"},
+	} {
+		t.Run(ts.alg, func(t *testing.T) {
+			a := newTestService(keys, algorithms, ts.kid, "")
+			accessToken := issue(t, a)
+
+			token, _, _ := new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
+			if token.Header["alg"] != ts.alg || token.Header["kid"] != ts.kid {
+				t.Errorf("Expected alg %s kid %s, got %v %v", ts.alg, ts.kid, token.Header["alg"], token.Header["kid"])
+			}
+
+			if _, errCode := a.validateToken(context.Background(), accessToken, ServiceCode); errCode != nil {
+				t.Errorf("Expected token valid, got %s", errCode.ResponseMessage)
+			}
+
+			// JWKS publish the algorithm of the key
+			for _, jwk := range a.JWKS().Keys {
+				if jwk.Kid == ts.kid && (jwk.Alg != ts.alg || jwk.Kty != ts.kty) {
+					t.Errorf("Expected JWK alg %s kty %s, got %s %s", ts.alg, ts.kty, jwk.Alg, jwk.Kty)
+				}
+			}
+		})
+	}
+
+	a := newTestService(keys, algorithms, "rsa", "")
+	claims := jwt.MapClaims{"iss": a.cfg.Token.Issuer, "aud": a.cfg.Token.Audience, "sub": "client"}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		accessToken, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return accessToken
+	}
+
+	rsaPublic, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	for _, ts := range []struct {
+		name  string
+		token string
+	}{
+		// public key is known by everyone, it must never be used as HMAC secret
+		{"HS256 Signed With Public Key PEM", sign(jwt.SigningMethodHS256, "rsa", encodePublic(t, &rsaKey.PublicKey))},
+		{"HS256 Signed With Public Key DER", sign(jwt.SigningMethodHS256, "rsa", rsaPublic)},
+		{"RS256 On PS256 Key", sign(jwt.SigningMethodRS256, "rsa", rsaKey)},
+		{"PS512 On PS256 Key", sign(jwt.SigningMethodPS512, "rsa", rsaKey)},
+		{"ES256 On EdDSA Key", sign(jwt.SigningMethodES256, "ed", ecKey)},
+		{"None Algorithm", sign(jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType)},
+	} {
+		t.Run("Failed. "+ts.name, func(t *testing.T) {
+			if _, errCode := a.validateToken(context.Background(), ts.token, ServiceCode); errCode == nil {
+				t.Errorf("Expected token is rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	res "github.com/arthben/http_jwt_crud/internal/response"
+)
+
+// Principal is the verified caller of request, set on request context by Authenticate
+type Principal struct {
+	// client key, subject of the access token
+	ClientID string
+	Scopes   []string
+	// jti of the access token
+	TokenID string
+	// registered client of ClientID
+	Client *clients.Client
+}
+
+type principalKey struct{}
+
+// WithPrincipal return copy of ctx which carry principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext return principal verified by Authenticate, false when request was not authenticated
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// Authenticate verify bearer access token and X-Client-Key before the handler, and set the Principal
+// on request context. Failure is responded with serviceCode of the route
+func (a *AuthService) Authenticate(serviceCode string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, errCode := a.authenticate(r, serviceCode)
+		if errCode != nil {
+			res.Write(w).AbortWithJSON(errCode)
+			return
+		}
+
+		next(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	}
+}
+
+func (a *AuthService) authenticate(r *http.Request, serviceCode string) (*Principal, *res.Message) {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return nil, res.BadResponse(http.StatusBadRequest, serviceCode, "02", "Missing Mandatory Field Authorization")
+	}
+
+	accessToken, ok := BearerToken(authorization)
+	if !ok {
+		return nil, res.BadResponse(http.StatusBadRequest, serviceCode, "01", "Invalid Field Format Authorization")
+	}
+
+	clientKey := r.Header.Get("X-Client-Key")
+	if clientKey == "" {
+		return nil, res.BadResponse(http.StatusBadRequest, serviceCode, "02", "Missing Mandatory Field ClientKey")
+	}
+
+	client, err := a.clients.Get(r.Context(), clientKey)
+	if err != nil && !errors.Is(err, clients.ErrNotFound) {
+		return nil, res.BadResponse(http.StatusInternalServerError, serviceCode, "00", "Error Internal Server")
+	}
+
+	if client == nil || !client.Active() {
+		return nil, res.BadResponse(http.StatusUnauthorized, serviceCode, "00", "Unauthorized. Unknown Client Key")
+	}
+
+	// token must be issued to the client on X-Client-Key
+	principal, errCode := a.VerifyAccessToken(r.Context(), accessToken, clientKey, CertificateThumbprint(r), serviceCode)
+	if errCode != nil {
+		return nil, errCode
+	}
+
+	principal.Client = client
+	return principal, nil
+}
+
+// BearerToken return token of "Bearer <token>" Authorization header, false when it is not bearer or token is empty
+func BearerToken(authorization string) (string, bool) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		return "", false
+	}
+	return token, true
+}
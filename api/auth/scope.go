@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	res "github.com/arthben/http_jwt_crud/internal/response"
+)
+
+const (
+	ScopeTodoRead  = "todo:read"
+	ScopeTodoWrite = "todo:write"
+)
+
+// RequireScope reject request whose access token does not have every scopes.
+// It reads the principal, so it must be wrapped by Authenticate.
+// Rejection is responded with serviceCode of the route
+func RequireScope(serviceCode string, next http.HandlerFunc, scopes ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			res.Write(w).AbortWithJSON(res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token"))
+			return
+		}
+
+		if !hasScopes(principal.Scopes, scopes) {
+			res.Write(w).AbortWithJSON(res.BadResponse(http.StatusForbidden, serviceCode, "00", "Forbidden. Insufficient Scope"))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// grantScopes return requested scopes when all of them are allowed.
+// Empty request is granted every allowed scopes
+func grantScopes(requested string, allowed []string) (string, bool) {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(allowed, " "), true
+	}
+
+	var granted []string
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(allowed, scope) {
+			return "", false
+		}
+
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return strings.Join(granted, " "), true
+}
+
+// hasScopes check granted scopes contains every required scopes
+func hasScopes(granted []string, required []string) bool {
+	for _, s := range required {
+		if !slices.Contains(granted, s) {
+			return false
+		}
+	}
+	return true
+}
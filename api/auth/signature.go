@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+)
+
+var ErrSignature = errors.New("invalid signature")
+
+// VerifySignature verify base64 signature of message with PEM public key of client.
+// RSA key use PKCS #1 v1.5, ECDSA key use ASN.1 DER signature, both over SHA-256
+func VerifySignature(publicKey []byte, message string, signature string) error {
+	parsed, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return ErrSignature
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrSignature
+	}
+
+	hashed := sha256.Sum256([]byte(message))
+	switch key := parsed.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+			return ErrSignature
+		}
+
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, hashed[:], sig) {
+			return ErrSignature
+		}
+
+	default:
+		return ErrSignature
+	}
+
+	return nil
+}
+
+// ParsePublicKey parse PEM (PKIX) public key of client
+func ParsePublicKey(publicKey []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return nil, ErrSignature
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
@@ -0,0 +1,14 @@
+package auth
+
+import "time"
+
+// ParseTimestamp parse X-Timestamp as RFC 3339 with any offset and optional fractional second,
+// ex: 2024-01-02T15:04:05+07:00, 2024-01-02T08:04:05Z or 2024-01-02T08:04:05.123Z.
+// Result is normalised to UTC, the original string is still used on string-to-sign
+func ParseTimestamp(value string) (time.Time, error) {
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ts.UTC(), nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/arthben/http_jwt_crud/internal/jwks"
+	"github.com/golang-jwt/jwt"
+)
+
+// trustedIssuer is external identity provider which access token is accepted, see config.TrustedIssuer
+type trustedIssuer struct {
+	config.TrustedIssuer
+	keys *jwks.Cache
+}
+
+// trustedIssuers is trusted issuer by iss claim
+type trustedIssuers map[string]*trustedIssuer
+
+func newTrustedIssuers(cfg *config.EnvParams) trustedIssuers {
+	minRefetch, _ := strconv.Atoi(cfg.TrustedIssuers.MinRefetch)
+
+	issuers := trustedIssuers{}
+	for _, issuer := range cfg.TrustedIssuers.Issuers {
+		issuers[issuer.Issuer] = &trustedIssuer{
+			TrustedIssuer: issuer,
+			keys:          jwks.New(issuer.JWKSURL, issuer.JWKSFile, time.Duration(minRefetch)*time.Second),
+		}
+	}
+	return issuers
+}
+
+// run refresh JWKS of every issuer in background until ctx is done
+func (t trustedIssuers) run(ctx context.Context, interval time.Duration) {
+	for _, issuer := range t {
+		go issuer.keys.Run(ctx, interval)
+	}
+}
+
+// verifier return public key of token kid. Algorithm is pinned to the key, HMAC and none are never accepted
+func (t *trustedIssuer) verifier(ctx context.Context, jwtToken *jwt.Token) (interface{}, error) {
+	kid, _ := jwtToken.Header["kid"].(string)
+	key, err := t.keys.Key(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, hmac := jwtToken.Method.(*jwt.SigningMethodHMAC); hmac || jwtToken.Method.Alg() != key.Alg {
+		return nil, fmt.Errorf("unexpected method %s", jwtToken.Header["alg"])
+	}
+	return key.Public, nil
+}
+
+// mapClaims return claims of provider token in the shape of self issued token,
+// so sub is the client key, scope is space separated and jti is the token ID.
+// Token ID of provider has no length limit, jti is hex SHA-256 of issuer and token ID
+// so it fits revoked_tokens and does not collide with ID of other issuers
+func (t *trustedIssuer) mapClaims(claims jwt.MapClaims) jwt.MapClaims {
+	mapped := jwt.MapClaims{}
+	for k, v := range claims {
+		mapped[k] = v
+	}
+
+	mapped["sub"], _ = claims[t.Claims.ClientID].(string)
+	mapped["jti"] = ""
+	if tokenID, _ := claims[t.Claims.TokenID].(string); tokenID != "" {
+		sum := sha256.Sum256([]byte(t.Issuer + "\n" + tokenID))
+		mapped["jti"] = hex.EncodeToString(sum[:])
+	}
+
+	switch scope := claims[t.Claims.Scope].(type) {
+	case string:
+		mapped["scope"] = strings.Join(strings.Fields(scope), " ")
+	case []interface{}:
+		var scopes []string
+		for _, s := range scope {
+			if s, ok := s.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		mapped["scope"] = strings.Join(scopes, " ")
+	default:
+		mapped["scope"] = ""
+	}
+
+	return mapped
+}
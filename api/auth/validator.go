@@ -1,12 +1,7 @@
 package auth
 
 import (
-	"crypto"
-	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/pem"
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -18,63 +13,75 @@ import (
 )
 
 const (
-	ServiceCode = "73"
-	GrantType   = "client_credentials"
-	TSLayout    = "2006-01-02T15:04:05+07:00"
+	ServiceCode      = "73"
+	GrantType        = "client_credentials"
+	GrantTypeRefresh = "refresh_token"
+	// TSLayout is format of X-Timestamp, any RFC 3339 offset and fractional second is accepted
+	TSLayout = time.RFC3339
 )
 
-func validateToken(issuer string, accessToken string, serviceCode string, pubKey []byte) *res.Message {
-	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pubKey)
-	if err != nil {
-		return res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
-	}
-
+// validateToken verify self issued access token, or access token of trusted issuer which claims
+// are mapped to the shape of self issued token, see trustedIssuer.mapClaims
+func (a *AuthService) validateToken(ctx context.Context, accessToken string, serviceCode string) (jwt.MapClaims, *res.Message) {
 	token, err := jwt.Parse(accessToken, func(jwtToken *jwt.Token) (interface{}, error) {
-		if _, ok := jwtToken.Method.(*jwt.SigningMethodRSA); !ok {
+		// iss is not trusted yet, it only select the keys which verify the token
+		iss, _ := jwtToken.Claims.(jwt.MapClaims)["iss"].(string)
+		if iss != a.cfg.Token.Issuer {
+			issuer, ok := a.trusted[iss]
+			if !ok {
+				return nil, fmt.Errorf("unknown issuer %s", iss)
+			}
+			return issuer.verifier(ctx, jwtToken)
+		}
+
+		kid, _ := jwtToken.Header["kid"].(string)
+		key, err := a.keys.verifier(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// algorithm is pinned to the key, alg header must match exactly
+		if jwtToken.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected method %s", jwtToken.Header["alg"])
 		}
-		return publicKey, nil
+		return key.Public, nil
 	})
 
 	// if error occured, token has been expired
 	if err != nil {
-		return res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
+		return nil, res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
-	}
-
-	if claims["iss"] != issuer {
-		return res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
+		return nil, res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
 	}
 
-	return nil
-}
+	// keys were selected by iss, so iss is either the token issuer or a trusted issuer
+	iss, _ := claims["iss"].(string)
+	if issuer, ok := a.trusted[iss]; ok {
+		// jwt.Parse accept token without exp, token of other provider must expire
+		if !claims.VerifyAudience(issuer.Audience, true) || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+			return nil, res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
+		}
 
-func validateSignature(header *TokenHeader, strToSign string, pubKey []byte) *res.Message {
-	block, _ := pem.Decode(pubKey)
-	if block == nil {
-		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Signature")
+		// token ID is the revocation key, empty ID would be revoked for every token without one
+		mapped := issuer.mapClaims(claims)
+		if mapped["jti"] == "" {
+			return nil, res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
+		}
+		return mapped, nil
 	}
 
-	parseResult, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Signature")
+	if !claims.VerifyAudience(a.cfg.Token.Audience, true) {
+		return nil, res.BadResponse(http.StatusUnauthorized, serviceCode, "01", "Unauthorized. Invalid Token")
 	}
-	publicKey := parseResult.(*rsa.PublicKey)
 
-	msgHash := sha256.New()
-	msgHash.Write([]byte(strToSign))
-	msgHashSum := msgHash.Sum(nil)
-
-	signature, err := base64.StdEncoding.DecodeString(header.Signature)
-	if err != nil {
-		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Signature")
-	}
+	return claims, nil
+}
 
-	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, msgHashSum, signature); err != nil {
+func validateSignature(header *TokenHeader, strToSign string, pubKey []byte) *res.Message {
+	if err := VerifySignature(pubKey, strToSign, header.Signature); err != nil {
 		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Signature")
 	}
 	return nil
@@ -96,13 +103,34 @@ func validateBody(w http.ResponseWriter, r *http.Request) (*TokenRequest, *res.M
 		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
 	}
 
-	if payload.GrantType != GrantType {
+	switch payload.GrantType {
+	case GrantType:
+	case GrantTypeRefresh:
+		if len(payload.RefreshToken) == 0 {
+			return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field refreshToken")
+		}
+	default:
 		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Unsupported grantType")
 	}
 
 	return &payload, nil
 }
 
+func validateTokenBody(w http.ResponseWriter, r *http.Request) (*TokenActionRequest, *res.Message) {
+	var payload TokenActionRequest
+
+	if err := bindhttp.BindBody(w, r, &payload); err != nil {
+		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+	}
+
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	if err := validate.Struct(&payload); err != nil {
+		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field token")
+	}
+
+	return &payload, nil
+}
+
 func validateHeader(r *http.Request) (*TokenHeader, *res.Message) {
 	var header TokenHeader
 
@@ -137,9 +165,9 @@ func validateHeader(r *http.Request) (*TokenHeader, *res.Message) {
 					return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field X-TIMESTAMP")
 				}
 
-			case "Signature":
-				if ve.Tag() == "required" {
-					return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "02", "Missing Mandatory Field X-SIGNATURE")
+			case "ExternalID":
+				if ve.Tag() == "max" {
+					return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format X-EXTERNAL-ID")
 				}
 
 			default:
@@ -154,7 +182,7 @@ func validateHeader(r *http.Request) (*TokenHeader, *res.Message) {
 	}
 
 	// validate timestamp format
-	if _, err := time.Parse(TSLayout, header.Timestamp); err != nil {
+	if _, err := ParseTimestamp(header.Timestamp); err != nil {
 		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format X-TIMESTAMP")
 	}
 
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	"github.com/arthben/http_jwt_crud/internal/response"
+)
+
+// CreateClient godoc
+// @Summary Register Client
+// @Description.markdown admin_clients
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param request       body   admin.CreateClientRequest true "request"
+// @Success 200 {object} admin.ClientResponse
+// @Failure 400 {object} response.Message
+// @Failure 401 {object} response.Message
+// @Failure 503 {object} response.Message
+// @Router /admin/v1.0/clients [POST]
+func (h *Handlers) CreateClient(w http.ResponseWriter, r *http.Request) {
+	// generated secret must not be stored by any cache nor log
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp, errCode := h.admin.CreateClient(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// ListClients godoc
+// @Summary List Clients
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer admin token"
+// @Success 200 {object} admin.ClientListResponse
+// @Failure 401 {object} response.Message
+// @Router /admin/v1.0/clients [GET]
+func (h *Handlers) ListClients(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.admin.ListClients(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// DisableClient godoc
+// @Summary Disable Client
+// @Tags Admin
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param clientKey     path   string true "Client Key"
+// @Success 200 {object} admin.ClientResponse
+// @Failure 404 {object} response.Message
+// @Router /admin/v1.0/clients/{clientKey}/disable [POST]
+func (h *Handlers) DisableClient(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.admin.SetClientStatus(w, r, clients.StatusDisabled)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// EnableClient godoc
+// @Summary Enable Client
+// @Tags Admin
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param clientKey     path   string true "Client Key"
+// @Success 200 {object} admin.ClientResponse
+// @Failure 404 {object} response.Message
+// @Router /admin/v1.0/clients/{clientKey}/enable [POST]
+func (h *Handlers) EnableClient(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.admin.SetClientStatus(w, r, clients.StatusActive)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// RotateClientSecret godoc
+// @Summary Rotate Client Secret
+// @Description New secret is only shown on this response
+// @Tags Admin
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param clientKey     path   string true "Client Key"
+// @Success 200 {object} admin.ClientResponse
+// @Failure 404 {object} response.Message
+// @Failure 503 {object} response.Message
+// @Router /admin/v1.0/clients/{clientKey}/rotate-secret [POST]
+func (h *Handlers) RotateClientSecret(w http.ResponseWriter, r *http.Request) {
+	// generated secret must not be stored by any cache nor log
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp, errCode := h.admin.RotateSecret(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// SetClientSignatureMethod godoc
+// @Summary Set Client Signature Method
+// @Description Service signature (todo endpoints) is HMAC with client secret by default.
+// @Description asymmetric verify the same string-to-sign with client public key (SHA256withRSA or SHA256withECDSA)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param clientKey     path   string true "Client Key"
+// @Param request       body   admin.SignatureMethodRequest true "request"
+// @Success 200 {object} admin.ClientResponse
+// @Failure 400 {object} response.Message
+// @Failure 404 {object} response.Message
+// @Router /admin/v1.0/clients/{clientKey}/signature-method [PUT]
+func (h *Handlers) SetClientSignatureMethod(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.admin.SetSignatureMethod(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// SetClientSignatureComponents godoc
+// @Summary Set Client Signature Components
+// @Description Components which message signature (Signature-Input / Signature, RFC 9421) must cover.
+// @Description Empty reset to default: @method @path @query authorization content-digest
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param clientKey     path   string true "Client Key"
+// @Param request       body   admin.SignatureComponentsRequest true "request"
+// @Success 200 {object} admin.ClientResponse
+// @Failure 400 {object} response.Message
+// @Failure 404 {object} response.Message
+// @Router /admin/v1.0/clients/{clientKey}/signature-components [PUT]
+func (h *Handlers) SetClientSignatureComponents(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.admin.SetSignatureComponents(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// SetClientCertificate godoc
+// @Summary Set Client Certificate
+// @Description Map client certificate ( mTLS ) by SHA-256 fingerprint and / or subject DN.
+// @Description tlsAuth certificate authenticate token request by the certificate instead of X-Signature, both require the two.
+// @Description Access token issued on mTLS connection is bound to the certificate ( RFC 8705 )
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param clientKey     path   string true "Client Key"
+// @Param request       body   admin.CertificateRequest true "request"
+// @Success 200 {object} admin.ClientResponse
+// @Failure 400 {object} response.Message
+// @Failure 404 {object} response.Message
+// @Router /admin/v1.0/clients/{clientKey}/certificate [PUT]
+func (h *Handlers) SetClientCertificate(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.admin.SetCertificate(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// SetClientPublicKey godoc
+// @Summary Upload Client Public Key
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param clientKey     path   string true "Client Key"
+// @Param request       body   admin.PublicKeyRequest true "request"
+// @Success 200 {object} admin.ClientResponse
+// @Failure 400 {object} response.Message
+// @Failure 404 {object} response.Message
+// @Router /admin/v1.0/clients/{clientKey}/public-key [PUT]
+func (h *Handlers) SetClientPublicKey(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.admin.SetPublicKey(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// UnlockClient godoc
+// @Summary Unlock Client
+// @Description Client key and source IP are locked out after repeated failed authentication on access token endpoints.
+// @Description Clear the failure counter and lockout of clientKey and / or ip
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer admin token"
+// @Param request       body   admin.UnlockRequest true "request"
+// @Success 200 {object} response.Message
+// @Failure 400 {object} response.Message
+// @Failure 401 {object} response.Message
+// @Router /admin/v1.0/lockouts/unlock [POST]
+func (h *Handlers) UnlockClient(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.admin.Unlock(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
@@ -1,14 +1,24 @@
 package handlers
 
 import (
+	"context"
+	"expvar"
 	"net/http"
 
+	"github.com/arthben/http_jwt_crud/api/admin"
 	"github.com/arthben/http_jwt_crud/api/auth"
 	"github.com/arthben/http_jwt_crud/api/todo"
 
 	_ "github.com/arthben/http_jwt_crud/docs"
+	"github.com/arthben/http_jwt_crud/internal/clients"
 	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/lockout"
+	"github.com/arthben/http_jwt_crud/internal/ratelimit"
+	"github.com/arthben/http_jwt_crud/internal/refresh"
+	"github.com/arthben/http_jwt_crud/internal/replay"
 	"github.com/arthben/http_jwt_crud/internal/response"
+	"github.com/arthben/http_jwt_crud/internal/revocation"
 
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 
@@ -16,22 +26,37 @@ import (
 )
 
 type Handlers struct {
-	mux  *http.ServeMux
-	auth *auth.AuthService
-	todo *todo.TodoService
+	mux     *http.ServeMux
+	auth    *auth.AuthService
+	todo    *todo.TodoService
+	admin   *admin.AdminService
+	limiter *ratelimit.Limiter
 }
 
 func NewHandlers(
 	db *sqlx.DB,
 	cfg *config.EnvParams,
 ) *Handlers {
+	clientStore := clients.New(db, cfg)
+	guard := replay.New(db, cfg)
+	locks := lockout.New(db, cfg)
+	authService := auth.NewAuthService(cfg, clientStore, revocation.New(db, cfg), refresh.New(db, cfg), guard, locks)
+
 	return &Handlers{
-		mux:  http.NewServeMux(),
-		auth: auth.NewAuthService(cfg),
-		todo: todo.NewTodoService(db, cfg),
+		mux:     http.NewServeMux(),
+		auth:    authService,
+		todo:    todo.NewTodoService(db, cfg, guard, locks),
+		admin:   admin.NewAdminService(db, cfg, locks),
+		limiter: ratelimit.New(cfg, verifiedClient),
 	}
 }
 
+// Run start background process of services until ctx is done
+func (h *Handlers) Run(ctx context.Context) {
+	h.auth.Run(ctx)
+	h.todo.Run(ctx)
+}
+
 // @title HTTP JWT CRUD
 // @version 1.0
 // @description Demonstrate HTTP with Middleware, JWT, SQLX and slog package
@@ -45,13 +70,52 @@ func (h *Handlers) BuildRouter() (http.Handler, error) {
 	h.InitSwagger()
 
 	h.mux.HandleFunc("GET /halo", halo)
-	h.mux.HandleFunc("POST /v1.0/access-token", h.GetAccessToken)
-	h.mux.HandleFunc("POST /v1.0/todo", h.NewTodo)
-	h.mux.HandleFunc("GET /v1.0/todo/{ID}", h.GetTodoList)
+	h.mux.HandleFunc("GET /ready", ready)
+	h.mux.HandleFunc("GET /.well-known/jwks.json", h.GetJWKS)
+
+	// client of token routes is authenticated by the handler, they are rate limited per source IP
+	h.mux.Handle("POST /v1.0/access-token", h.limit("POST /v1.0/access-token", auth.ServiceCode, h.GetAccessToken))
+	h.mux.Handle("POST /v1.0/access-token/revoke", h.limit("POST /v1.0/access-token/revoke", auth.ServiceCode, h.RevokeAccessToken))
+	h.mux.Handle("POST /v1.0/access-token/introspect", h.limit("POST /v1.0/access-token/introspect", auth.ServiceCode, h.IntrospectAccessToken))
+	// todo routes are authenticated before the handler, the principal is read from request context
+	// and rate limited per verified client
+	h.mux.Handle("POST /v1.0/todo", h.auth.Authenticate(todo.ServiceCode, h.limit("POST /v1.0/todo", todo.ServiceCode, auth.RequireScope(todo.ServiceCode, h.NewTodo, auth.ScopeTodoWrite))))
+	h.mux.Handle("GET /v1.0/todo", h.auth.Authenticate(todo.ServiceCode, h.limit("GET /v1.0/todo", todo.ServiceCode, auth.RequireScope(todo.ServiceCode, h.GetTodoList, auth.ScopeTodoRead))))
+	h.mux.Handle("GET /v1.0/todo/{ID}", h.auth.Authenticate(todo.ServiceCode, h.limit("GET /v1.0/todo/{ID}", todo.ServiceCode, auth.RequireScope(todo.ServiceCode, h.GetTodoList, auth.ScopeTodoRead))))
+	h.mux.Handle("POST /v1.0/todo/{ID}/unarchive", h.auth.Authenticate(todo.ServiceCode, h.limit("POST /v1.0/todo/{ID}/unarchive", todo.ServiceCode, auth.RequireScope(todo.ServiceCode, h.UnarchiveTodo, auth.ScopeTodoWrite))))
+
+	if h.admin.Enabled() {
+		h.mux.HandleFunc("POST /admin/v1.0/clients", h.CreateClient)
+		h.mux.HandleFunc("GET /admin/v1.0/clients", h.ListClients)
+		h.mux.HandleFunc("POST /admin/v1.0/clients/{clientKey}/disable", h.DisableClient)
+		h.mux.HandleFunc("POST /admin/v1.0/clients/{clientKey}/enable", h.EnableClient)
+		h.mux.HandleFunc("POST /admin/v1.0/clients/{clientKey}/rotate-secret", h.RotateClientSecret)
+		h.mux.HandleFunc("PUT /admin/v1.0/clients/{clientKey}/public-key", h.SetClientPublicKey)
+		h.mux.HandleFunc("PUT /admin/v1.0/clients/{clientKey}/signature-method", h.SetClientSignatureMethod)
+		h.mux.HandleFunc("PUT /admin/v1.0/clients/{clientKey}/signature-components", h.SetClientSignatureComponents)
+		h.mux.HandleFunc("PUT /admin/v1.0/clients/{clientKey}/certificate", h.SetClientCertificate)
+		h.mux.HandleFunc("POST /admin/v1.0/lockouts/unlock", h.UnlockClient)
+		// cmdline and memstats are not public, metrics require admin token
+		h.mux.Handle("GET /admin/v1.0/debug/vars", h.admin.Authorize(expvar.Handler()))
+	}
 
 	return http.Handler(h.mux), nil
 }
 
+// limit put handler of pattern behind the rate limiter
+func (h *Handlers) limit(pattern string, serviceCode string, handler http.HandlerFunc) http.HandlerFunc {
+	return h.limiter.Handler(pattern, serviceCode, handler).ServeHTTP
+}
+
+// verifiedClient return client of the principal set by Authenticate
+func verifiedClient(r *http.Request) (string, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return "", false
+	}
+	return principal.ClientID, true
+}
+
 func (h *Handlers) InitSwagger() {
 	h.mux.HandleFunc("GET /swagger/", httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"),
@@ -64,13 +128,16 @@ func (h *Handlers) InitSwagger() {
 
 // GetAccessToken godoc
 // @Summary Get Access Token
+// @Description.markdown token_get
 // @Tags Token
 // @Accept json
 // @Produce json
 // @Param Content-Type header string true "application/json"
 // @Param X-Client-Key header string true "Client key provided by server"
-// @Param X-Timestamp  header string true "format: 2006-01-02T15:04:05+07:00"
-// @Param X-Signature  header string true "Generated Signature"
+// @Param X-Timestamp  header string true "RFC 3339, ex: 2006-01-02T15:04:05+07:00"
+// @Param X-Signature  header string false "Generated Signature, not required when client authenticate with certificate only"
+// @Param X-External-ID header string false "Request ID for tracing, not used as nonce"
+// @Param request      body   auth.TokenRequest true "request"
 // @Success 200 {object} auth.TokenResponse
 // @Failure 400 {object} response.Message
 // @Failure 401 {object} response.Message
@@ -85,6 +152,70 @@ func (h *Handlers) GetAccessToken(w http.ResponseWriter, r *http.Request) {
 	response.Write(w).JSON(resp)
 }
 
+// RevokeAccessToken godoc
+// @Summary Revoke Access Token
+// @Description.markdown token_revoke
+// @Tags Token
+// @Accept json
+// @Produce json
+// @Param Content-Type header string true "application/json"
+// @Param X-Client-Key header string true "Client key provided by server"
+// @Param X-Timestamp  header string true "RFC 3339, ex: 2006-01-02T15:04:05+07:00"
+// @Param X-Signature  header string true "Generated Signature"
+// @Param request      body   auth.TokenActionRequest true "request"
+// @Success 200 {object} response.Message
+// @Failure 400 {object} response.Message
+// @Failure 401 {object} response.Message
+// @Router /v1.0/access-token/revoke [POST]
+func (h *Handlers) RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.auth.RevokeToken(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// IntrospectAccessToken godoc
+// @Summary Introspect Access Token
+// @Description.markdown token_introspect
+// @Tags Token
+// @Accept json
+// @Produce json
+// @Param Content-Type header string true "application/json"
+// @Param X-Client-Key header string true "Client key provided by server"
+// @Param X-Timestamp  header string true "RFC 3339, ex: 2006-01-02T15:04:05+07:00"
+// @Param X-Signature  header string true "Generated Signature"
+// @Param request      body   auth.TokenActionRequest true "request"
+// @Success 200 {object} auth.IntrospectResponse
+// @Failure 400 {object} response.Message
+// @Failure 401 {object} response.Message
+// @Router /v1.0/access-token/introspect [POST]
+func (h *Handlers) IntrospectAccessToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	resp, errCode := h.auth.IntrospectToken(w, r)
+	if errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+		return
+	}
+
+	response.Write(w).JSON(resp)
+}
+
+// GetJWKS godoc
+// @Summary Public keys to verify access token
+// @Description Access token header `kid` refer to key on this set
+// @Tags Token
+// @Produce json
+// @Success 200 {object} auth.JWKSResponse
+// @Router /.well-known/jwks.json [GET]
+func (h *Handlers) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	response.Write(w).JSON(h.auth.JWKS())
+}
+
 // NewTodo godoc
 // @Summary Add Todo item
 // @Description.markdown todo_add
@@ -94,8 +225,11 @@ func (h *Handlers) GetAccessToken(w http.ResponseWriter, r *http.Request) {
 // @Param Content-Type  header string true "application/json"
 // @Param Authorization header string true "Bearer token"
 // @Param X-Client-Key  header string true "Client Key provided by server"
-// @Param X-Timestamp   header string true "format: 2006-01-02T15:04:05+07:00"
-// @Param X-Signature   header string true "123425234"
+// @Param X-Timestamp   header string true "RFC 3339, ex: 2006-01-02T15:04:05+07:00"
+// @Param X-Signature   header string false "123425234, not required when Signature-Input is sent"
+// @Param Signature-Input header string false "RFC 9421, ex: sig1=(\"@method\" \"@path\" \"@query\" \"authorization\" \"content-digest\");created=1704182645;keyid=\"clientKey\""
+// @Param Signature     header string false "RFC 9421, ex: sig1=:base64:"
+// @Param Content-Digest header string false "RFC 9530, ex: sha-256=:base64:"
 // @Param request       body   todo.AddTodosRequest true "request"
 // @Success 200 {object} database.TableTodos
 // @Failure 400 {object} response.Message
@@ -112,27 +246,56 @@ func (h *Handlers) NewTodo(w http.ResponseWriter, r *http.Request) {
 
 // GetTodoList godoc
 // @Summary Todo List
-// @Description Get list of todo
+// @Description.markdown todo_list
 // @Tags Todo
 // @Accept json
 // @Produce json
+// @Produce application/x-ndjson
 // @Param Content-Type  header string true "application/json"
 // @Param Authorization header string true "Bearer token"
 // @Param X-Client-Key  header string true "Client Key provided by server"
-// @Param X-Timestamp   header string true "format: 2006-01-02T15:04:05+07:00"
-// @Param X-Signature   header string true "123425234"
+// @Param X-Timestamp   header string true "RFC 3339, ex: 2006-01-02T15:04:05+07:00"
+// @Param X-Signature   header string false "123425234, not required when Signature-Input is sent"
+// @Param Signature-Input header string false "RFC 9421, ex: sig1=(\"@method\" \"@path\" \"@query\" \"authorization\" \"content-digest\");created=1704182645;keyid=\"clientKey\""
+// @Param Signature     header string false "RFC 9421, ex: sig1=:base64:"
+// @Param X-Read-Your-Writes header string false "true to read from primary shortly after own write"
+// @Param Accept        header string false "application/json (default) or application/x-ndjson"
 // @Param ID path string false "ID of todo"
+// @Param archived query bool false "true to list archived todo"
 // @Success 200 {object} []database.TableTodos
 // @Failure 404 {object} response.Message
 // @Router /v1.0/todo [GET]
 func (h *Handlers) GetTodoList(w http.ResponseWriter, r *http.Request) {
-	tbs, errCode := h.todo.Get(w, r)
+	if errCode := h.todo.Get(w, r); errCode != nil {
+		response.Write(w).AbortWithJSON(errCode)
+	}
+}
+
+// UnarchiveTodo godoc
+// @Summary Unarchive Todo
+// @Description Move archived todo back to todo list. Signature is generated with empty body
+// @Tags Todo
+// @Accept json
+// @Produce json
+// @Param Content-Type  header string true "application/json"
+// @Param Authorization header string true "Bearer token"
+// @Param X-Client-Key  header string true "Client Key provided by server"
+// @Param X-Timestamp   header string true "RFC 3339, ex: 2006-01-02T15:04:05+07:00"
+// @Param X-Signature   header string false "123425234, not required when Signature-Input is sent"
+// @Param Signature-Input header string false "RFC 9421, ex: sig1=(\"@method\" \"@path\" \"@query\" \"authorization\" \"content-digest\");created=1704182645;keyid=\"clientKey\""
+// @Param Signature     header string false "RFC 9421, ex: sig1=:base64:"
+// @Param ID path string true "ID of todo"
+// @Success 200 {object} response.Message
+// @Failure 404 {object} response.Message
+// @Router /v1.0/todo/{ID}/unarchive [POST]
+func (h *Handlers) UnarchiveTodo(w http.ResponseWriter, r *http.Request) {
+	resp, errCode := h.todo.Unarchive(w, r)
 	if errCode != nil {
 		response.Write(w).AbortWithJSON(errCode)
 		return
 	}
 
-	response.Write(w).JSON(tbs)
+	response.Write(w).JSON(resp)
 }
 
 func halo(w http.ResponseWriter, r *http.Request) {
@@ -142,3 +305,28 @@ func halo(w http.ResponseWriter, r *http.Request) {
 		ResponseMessage: "Halo",
 	})
 }
+
+// ready godoc
+// @Summary Readiness probe
+// @Description Return 503 until database is reachable
+// @Tags Health
+// @Produce json
+// @Success 200 {object} response.Message
+// @Failure 503 {object} response.Message
+// @Router /ready [GET]
+func ready(w http.ResponseWriter, r *http.Request) {
+	if !database.IsReady() {
+		response.Write(w).AbortWithJSON(&response.Message{
+			HttpStatus:      http.StatusServiceUnavailable,
+			ResponseCode:    "00",
+			ResponseMessage: "Database Not Ready",
+		})
+		return
+	}
+
+	response.Write(w).JSON(&response.Message{
+		HttpStatus:      http.StatusOK,
+		ResponseCode:    "00",
+		ResponseMessage: "Ready",
+	})
+}
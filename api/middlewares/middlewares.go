@@ -14,7 +14,11 @@ import (
 	"github.com/google/uuid"
 )
 
-const KeyRequestID = "request_id"
+const (
+	KeyRequestID = "request_id"
+	// response body logged up to this size, streamed response can be very large
+	maxLogBody = 64 << 10
+)
 
 type Middleware func(logger *slog.Logger, next http.Handler) http.HandlerFunc
 
@@ -95,10 +99,15 @@ func RequestLogger(logger *slog.Logger, next http.Handler) http.HandlerFunc {
 		next.ServeHTTP(newWriter, r)
 
 		latency := float64(time.Since(t).Seconds())
+		// response which must not be stored, ex: generated secret, is not logged
+		noStore := newWriter.Header().Get("Cache-Control") == "no-store"
 		// write log
 		go func() {
 			status := newWriter.ResponseStatus
 			respBody := newWriter.ResponseBody.String()
+			if noStore {
+				respBody = "[REDACTED]"
+			}
 			reqLoggerInfo.Info(
 				"",
 				slog.Float64("latency", latency),
@@ -155,8 +164,10 @@ func (w *httpResponseWrapper) Header() http.Header {
 
 // Write implements http.ResponseWriter.
 func (w *httpResponseWrapper) Write(p []byte) (int, error) {
-	writeTargets := io.MultiWriter(w.wrapped, w.ResponseBody)
-	return writeTargets.Write(p)
+	if remain := maxLogBody - w.ResponseBody.Len(); remain > 0 {
+		w.ResponseBody.Write(p[:min(len(p), remain)])
+	}
+	return w.wrapped.Write(p)
 }
 
 // WriteHeader implements http.ResponseWriter.
@@ -164,3 +175,8 @@ func (w *httpResponseWrapper) WriteHeader(statusCode int) {
 	w.ResponseStatus = statusCode
 	w.wrapped.WriteHeader(statusCode)
 }
+
+// Unwrap let http.ResponseController reach the original writer, ex: to flush streamed response
+func (w *httpResponseWrapper) Unwrap() http.ResponseWriter {
+	return w.wrapped
+}
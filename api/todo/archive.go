@@ -0,0 +1,129 @@
+package todo
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/logging"
+	res "github.com/arthben/http_jwt_crud/internal/response"
+)
+
+// only one replica of the service run archiver at a time
+const archiveLock = "todo_archiver"
+
+// runArchiver move old completed todos to archive every Archive.Interval until ctx is done
+func (t *TodoService) runArchiver(ctx context.Context) {
+	interval, _ := strconv.Atoi(t.cfg.Archive.Interval)
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		total, err := t.Archive(ctx)
+		if err != nil {
+			slog.Error("Archive Todo", slog.Int("total", total), slog.String("error", err.Error()))
+			continue
+		}
+
+		if total > 0 {
+			slog.Info("Archive Todo", slog.Int("total", total))
+		}
+	}
+}
+
+// Archive move todos in batches while holding the archive lock.
+// Return 0 when the lock is hold by other replica
+func (t *TodoService) Archive(ctx context.Context) (int, error) {
+	if !dbs.IsReady() {
+		return 0, nil
+	}
+
+	conn, err := dbs.TryLock(t.db, ctx, archiveLock)
+	if err != nil || conn == nil {
+		// lock is hold by other replica
+		return 0, err
+	}
+	defer dbs.Unlock(conn, archiveLock)
+
+	afterDays, _ := strconv.Atoi(t.cfg.Archive.AfterDays)
+	batchSize, _ := strconv.Atoi(t.cfg.Archive.BatchSize)
+	before := time.Now().UTC().AddDate(0, 0, -afterDays)
+
+	var total int
+	defer func() {
+		if total > 0 {
+			t.invalidateCache(context.Background())
+		}
+	}()
+
+	for ctx.Err() == nil {
+		moved, err := dbs.ArchiveTodos(t.db, ctx, before, batchSize)
+		total += moved
+		if err != nil {
+			return total, err
+		}
+
+		if moved < batchSize {
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// Unarchive move archived todo back to the list
+func (t *TodoService) Unarchive(w http.ResponseWriter, r *http.Request) (*res.Message, *res.Message) {
+	logger, _ := logging.FromContext(r.Context())
+	if !dbs.IsReady() {
+		return nil, res.BadResponse(http.StatusServiceUnavailable, ServiceCode, "00", "Service Unavailable")
+	}
+
+	header, client, errCode := t.validateHeader(r)
+	if errCode != nil {
+		return nil, errCode
+	}
+
+	// body is optional, but still part of signature
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+	if err != nil {
+		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+	}
+
+	if errCode := t.validateSignature(w, header, body, r, client); errCode != nil {
+		return nil, errCode
+	}
+
+	if errCode := t.checkReplay(r.Context(), header); errCode != nil {
+		return nil, errCode
+	}
+
+	found, err := dbs.UnarchiveTodo(t.db, r.Context(), r.PathValue("ID"))
+	if err != nil {
+		if logger != nil {
+			logger.Error("UnarchiveTodo", slog.String("error", err.Error()))
+		}
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	if !found {
+		return nil, res.BadResponse(http.StatusNotFound, ServiceCode, "00", "No Data Found")
+	}
+	t.replicas.MarkWrite(header.ClientKey)
+	t.invalidateCache(r.Context())
+
+	return &res.Message{
+		HttpStatus:      http.StatusOK,
+		ResponseCode:    "200" + ServiceCode + "00",
+		ResponseMessage: "Success",
+	}, nil
+}
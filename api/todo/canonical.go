@@ -0,0 +1,57 @@
+package todo
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// canonicalTarget return request path followed by canonical query string, ex:
+// /v1.0/todo?archived=true&b=1&b=2. Path without query is returned as it is
+func canonicalTarget(u *url.URL) string {
+	query := canonicalQuery(u.RawQuery)
+	if query == "" {
+		return u.Path
+	}
+	return u.Path + "?" + query
+}
+
+// canonicalQuery sort query parameters by name then value, and percent-encode them (RFC 3986).
+// So the signature does not depend on parameter order or encoding chosen by client
+func canonicalQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil || len(values) == 0 {
+		// invalid query can not be canonicalised, it is signed as it is
+		return rawQuery
+	}
+
+	// sorted by encoded name, so order is the same as the signed string
+	names := make(map[string]string, len(values))
+	keys := make([]string, 0, len(values))
+	for name := range values {
+		key := escape(name)
+		names[key] = name
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		list := make([]string, 0, len(values[names[key]]))
+		for _, value := range values[names[key]] {
+			list = append(list, escape(value))
+		}
+		sort.Strings(list)
+
+		for _, value := range list {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// escape percent-encode everything except unreserved characters of RFC 3986
+func escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
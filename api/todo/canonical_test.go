@@ -0,0 +1,50 @@
+package todo
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalQuery(t *testing.T) {
+	for _, ts := range []struct {
+		name     string
+		rawQuery string
+		expected string
+	}{
+		{"Empty", "", ""},
+		{"Sorted By Name", "b=2&a=1", "a=1&b=2"},
+		{"Repeated Key Sorted By Value", "b=2&a=3&b=1", "a=3&b=1&b=2"},
+		{"Repeated Key Keep Duplicate", "a=1&a=1", "a=1&a=1"},
+		{"Plus Is Space", "q=hello+world", "q=hello%20world"},
+		{"Space Encoded", "q=hello%20world", "q=hello%20world"},
+		{"Reserved Character Encoded", "q=a/b", "q=a%2Fb"},
+		{"Unreserved Character Decoded", "q=%7Euser%2D1", "q=~user-1"},
+		{"Lowercase Percent Encoding", "q=a%2fb", "q=a%2Fb"},
+		{"Name Encoded", "%C3%A9t%C3%A9=1", "%C3%A9t%C3%A9=1"},
+		{"Empty Value", "a=&b", "a=&b="},
+		{"Invalid Escape Signed As It Is", "b=1&a=%zz", "b=1&a=%zz"},
+		{"Semicolon Signed As It Is", "b=1;a=2", "b=1;a=2"},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			if query := canonicalQuery(ts.rawQuery); query != ts.expected {
+				t.Errorf("Expected '%s', got '%s'", ts.expected, query)
+			}
+		})
+	}
+}
+
+func TestCanonicalTarget(t *testing.T) {
+	for _, ts := range []struct {
+		target   string
+		expected string
+	}{
+		{"/v1.0/todo", "/v1.0/todo"},
+		{"/v1.0/todo?", "/v1.0/todo"},
+		{"/v1.0/todo/1?archived=true&b=2&b=1", "/v1.0/todo/1?archived=true&b=1&b=2"},
+	} {
+		u, _ := url.Parse(ts.target)
+		if target := canonicalTarget(u); target != ts.expected {
+			t.Errorf("%s: expected '%s', got '%s'", ts.target, ts.expected, target)
+		}
+	}
+}
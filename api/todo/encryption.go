@@ -0,0 +1,146 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/encryption"
+	"github.com/jmoiron/sqlx"
+)
+
+const reencryptBatch = 100
+
+// sealTodo encrypt detail, and title when configured, using new data key.
+// Todo is left as plaintext when encryption is not configured
+func (t *TodoService) sealTodo(tb *dbs.TableTodos) error {
+	tb.KeyID, tb.DataKey, tb.EncTitle = "", "", "0"
+	if t.keyring == nil {
+		return nil
+	}
+
+	dataKey, err := t.keyring.NewDataKey()
+	if err != nil {
+		return err
+	}
+
+	if tb.Detail, err = dataKey.Encrypt(tb.Detail, aad(tb.ID, "detail")); err != nil {
+		return err
+	}
+
+	if t.cfg.Encryption.EncryptTitle == "true" {
+		if tb.Title, err = dataKey.Encrypt(tb.Title, aad(tb.ID, "title")); err != nil {
+			return err
+		}
+		tb.EncTitle = "1"
+	}
+
+	tb.KeyID = dataKey.KeyID
+	tb.DataKey = dataKey.Wrapped
+	return nil
+}
+
+// openTodo decrypt todo which stored by sealTodo
+func (t *TodoService) openTodo(tb *dbs.TableTodos) error {
+	if tb.KeyID == "" {
+		return nil
+	}
+
+	if t.keyring == nil {
+		return encryption.ErrUnknownKey
+	}
+
+	dataKey, err := t.keyring.OpenDataKey(tb.KeyID, tb.DataKey)
+	if err != nil {
+		return err
+	}
+
+	if tb.Detail, err = dataKey.Decrypt(tb.Detail, aad(tb.ID, "detail")); err != nil {
+		return err
+	}
+
+	if tb.EncTitle == "1" {
+		if tb.Title, err = dataKey.Decrypt(tb.Title, aad(tb.ID, "title")); err != nil {
+			return err
+		}
+	}
+
+	tb.KeyID, tb.DataKey, tb.EncTitle = "", "", "0"
+	return nil
+}
+
+// Reencrypt encrypt every todo and archived todo which not using active master key or current title setting.
+// Used by reencrypt command after master key rotation, only primary database is used.
+// Cache is not invalidated since decrypted todo does not change. Return number of re-encrypted todos
+func Reencrypt(ctx context.Context, db *sqlx.DB, cfg *config.EnvParams, logger *slog.Logger) (int, error) {
+	if len(cfg.Encryption.Keys) == 0 {
+		return 0, errors.New("encryption is not configured")
+	}
+
+	t := &TodoService{
+		db:      db,
+		cfg:     cfg,
+		keyring: encryption.NewKeyring(cfg.Encryption.Keys, cfg.Encryption.ActiveKey),
+	}
+
+	var total int
+	for _, table := range []string{"todos", "todos_archive"} {
+		count, err := t.reencryptTable(ctx, table, logger)
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// reencryptTable re-encrypt todos of table in batches
+func (t *TodoService) reencryptTable(ctx context.Context, table string, logger *slog.Logger) (int, error) {
+	encTitle := "0"
+	if t.cfg.Encryption.EncryptTitle == "true" {
+		encTitle = "1"
+	}
+
+	var (
+		total   int
+		afterID string
+	)
+
+	for {
+		tbs, err := dbs.ListTodoToReencrypt(t.db, ctx, table, t.keyring.ActiveKeyID(), encTitle, afterID, reencryptBatch)
+		if err != nil {
+			return total, err
+		}
+
+		if len(tbs) == 0 {
+			return total, nil
+		}
+
+		for _, tb := range tbs {
+			afterID = tb.ID
+
+			// row encrypted by removed master key can not be recovered, skip it
+			if err := t.openTodo(tb); err != nil {
+				logger.Error("Reencrypt", slog.String("table", table), slog.String("id", tb.ID), slog.String("key_id", tb.KeyID), slog.String("error", err.Error()))
+				continue
+			}
+
+			if err := t.sealTodo(tb); err != nil {
+				return total, err
+			}
+
+			if err := dbs.UpdateTodoEncryption(t.db, ctx, table, tb); err != nil {
+				return total, err
+			}
+			total++
+		}
+	}
+}
+
+// aad bind ciphertext to its row and column, so it can not be moved to other row
+func aad(id string, column string) string {
+	return id + ":" + column
+}
@@ -0,0 +1,44 @@
+package todo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/encryption"
+)
+
+func TestSealTodo(t *testing.T) {
+	cfg := &config.EnvParams{}
+	cfg.Encryption.EncryptTitle = "true"
+	svc := &TodoService{
+		cfg:     cfg,
+		keyring: encryption.NewKeyring(map[string][]byte{"2024": bytes.Repeat([]byte{1}, encryption.KeySize)}, "2024"),
+	}
+
+	tb := &dbs.TableTodos{ID: "id-1", Title: "title", Detail: "detail"}
+	if err := svc.sealTodo(tb); err != nil {
+		t.Fatalf("sealTodo: %v", err)
+	}
+	if tb.KeyID != "2024" || tb.EncTitle != "1" || tb.Title == "title" || tb.Detail == "detail" {
+		t.Errorf("Expected sealed todo, got %+v", tb)
+	}
+
+	// ciphertext moved to other row can not be opened
+	moved := *tb
+	moved.ID = "id-2"
+	if err := svc.openTodo(&moved); err == nil {
+		t.Errorf("Expected ciphertext moved to other row to fail")
+	}
+
+	if err := svc.openTodo(tb); err != nil || tb.Title != "title" || tb.Detail != "detail" || tb.KeyID != "" {
+		t.Errorf("Expected opened todo, got %+v %v", tb, err)
+	}
+
+	// plaintext row is returned as is
+	plain := &dbs.TableTodos{ID: "id-3", Title: "title", Detail: "detail"}
+	if err := svc.openTodo(plain); err != nil || plain.Detail != "detail" {
+		t.Errorf("Expected plaintext row as is, got %+v %v", plain, err)
+	}
+}
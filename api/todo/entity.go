@@ -6,6 +6,11 @@ type RequestHeader struct {
 	ClientKey     string `header:"X-Client-Key" binding:"required"`
 	Timestamp     string `header:"X-Timestamp" binding:"required"`
 	Signature     string `header:"X-Signature" binding:"required"`
+	// optional request ID for tracing, not signed and not used as nonce
+	ExternalID string `header:"X-External-ID"`
+	// message signature (RFC 9421), used instead of X-Signature when Signature-Input is sent
+	SignatureInput   string `header:"Signature-Input"`
+	MessageSignature string `header:"Signature"`
 }
 
 type AddTodosRequest struct {
@@ -0,0 +1,65 @@
+package todo
+
+import (
+	"bytes"
+	"net/http"
+
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+// response larger than this is not cached
+const cacheMaxEntry = 1 << 20
+
+// todoRows decrypt every todo while iterating the rows
+type todoRows struct {
+	rows    *sqlx.Rows
+	service *TodoService
+}
+
+func (t *todoRows) Next() bool {
+	return t.rows.Next()
+}
+
+func (t *todoRows) Scan() (any, error) {
+	var tb dbs.TableTodos
+	if err := t.rows.StructScan(&tb); err != nil {
+		return nil, err
+	}
+
+	if err := t.service.openTodo(&tb); err != nil {
+		return nil, err
+	}
+
+	return &tb, nil
+}
+
+func (t *todoRows) Err() error {
+	return t.rows.Err()
+}
+
+// captureWriter keep copy of response body up to max bytes
+type captureWriter struct {
+	http.ResponseWriter
+	buf      bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	if !c.overflow {
+		if c.buf.Len()+len(p) > c.max {
+			c.overflow = true
+			c.buf.Reset()
+		} else {
+			c.buf.Write(p)
+		}
+	}
+
+	return c.ResponseWriter.Write(p)
+}
+
+// Unwrap let http.ResponseController reach the original writer
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -1,83 +1,221 @@
 package todo
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"io"
 	"log"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/arthben/http_jwt_crud/api/auth"
+	"github.com/arthben/http_jwt_crud/internal/cache"
+	"github.com/arthben/http_jwt_crud/internal/clientip"
 	"github.com/arthben/http_jwt_crud/internal/config"
 	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/encryption"
+	"github.com/arthben/http_jwt_crud/internal/lockout"
 	"github.com/arthben/http_jwt_crud/internal/logging"
+	"github.com/arthben/http_jwt_crud/internal/replay"
 	res "github.com/arthben/http_jwt_crud/internal/response"
 	"github.com/jmoiron/sqlx"
 )
 
 const (
-	DateLayout  = "2006-01-02 15:04:05"
 	UnCompleted = "0"
 )
 
 type TodoService struct {
-	db  *sqlx.DB
-	cfg *config.EnvParams
+	db       *sqlx.DB
+	cfg      *config.EnvParams
+	replicas *dbs.Replicas
+	cache    *cache.Cache
+	keyring  *encryption.Keyring
+	replay   *replay.Guard
+	locks    *lockout.Lockout
+	clientIP *clientip.Resolver
 }
 
-func NewTodoService(db *sqlx.DB, cfg *config.EnvParams) *TodoService {
-	return &TodoService{db: db, cfg: cfg}
+func NewTodoService(
+	db *sqlx.DB,
+	cfg *config.EnvParams,
+	guard *replay.Guard,
+	locks *lockout.Lockout,
+) *TodoService {
+	t := &TodoService{
+		db:       db,
+		cfg:      cfg,
+		replicas: dbs.NewReplicas(db, cfg),
+		replay:   guard,
+		locks:    locks,
+		clientIP: clientip.New(cfg),
+	}
+
+	if cfg.Cache.Enabled == "true" {
+		ttl, _ := strconv.Atoi(cfg.Cache.TTL)
+		size, _ := strconv.Atoi(cfg.Cache.Size)
+		t.cache = cache.New(cache.NewLRU(size), "todo", time.Duration(ttl)*time.Second)
+	}
+
+	if len(cfg.Encryption.Keys) > 0 {
+		t.keyring = encryption.NewKeyring(cfg.Encryption.Keys, cfg.Encryption.ActiveKey)
+	}
+
+	return t
+}
+
+// Run start background process of todo service until ctx is done
+func (t *TodoService) Run(ctx context.Context) {
+	go t.replicas.HealthCheck(ctx)
+
+	if t.cfg.Archive.Enabled == "true" {
+		go t.runArchiver(ctx)
+	}
 }
 
-func (t *TodoService) Get(w http.ResponseWriter, r *http.Request) ([]*dbs.TableTodos, *res.Message) {
-	_, errCode := validateHeader(r, t.cfg)
+// Get stream list of todo to client. Response is written by Get unless *res.Message is returned
+func (t *TodoService) Get(w http.ResponseWriter, r *http.Request) *res.Message {
+	logger, _ := logging.FromContext(r.Context())
+	if !dbs.IsReady() {
+		return res.BadResponse(http.StatusServiceUnavailable, ServiceCode, "00", "Service Unavailable")
+	}
+
+	header, client, errCode := t.validateHeader(r)
 	if errCode != nil {
-		return nil, errCode
+		return errCode
 	}
 
+	// ID and query are part of the signature, body is empty
+	if errCode := t.validateSignature(w, header, nil, r, client); errCode != nil {
+		return errCode
+	}
+
+	if errCode := t.checkReplay(r.Context(), header); errCode != nil {
+		return errCode
+	}
+
+	// list query served by replica, unless client ask to read its own writes
+	readYourWrites := r.Header.Get("X-Read-Your-Writes") == "true"
+	reader := t.replicas.Reader(header.ClientKey, readYourWrites)
+
 	// get the ID
 	id := r.PathValue("ID")
-	resp, err := dbs.ListTodo(t.db, context.TODO(), id)
-	if err != nil && id != "" {
-		return nil, res.BadResponse(http.StatusNotFound, ServiceCode, "00", "No Data Found")
+	archived := r.URL.Query().Get("archived") == "true"
+	ndjson := r.Header.Get("Accept") == res.ContentTypeNDJSON
+	contentType := "application/json"
+	if ndjson {
+		contentType = res.ContentTypeNDJSON
+	}
+
+	failMsg := res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	if id != "" {
+		failMsg = res.BadResponse(http.StatusNotFound, ServiceCode, "00", "No Data Found")
 	}
 
-	return resp, nil
+	// cache is skipped when client ask to read its own writes
+	var cacheKey string
+	if t.cache != nil && !readYourWrites {
+		cacheKey = t.cache.Key(r.Context(), header.ClientKey, "id="+id+"&archived="+strconv.FormatBool(archived)+"&type="+contentType)
+		if cached, ok := t.cache.Get(r.Context(), cacheKey); ok {
+			res.Write(w).Raw(contentType, cached)
+			return nil
+		}
+	}
+
+	listTodo := dbs.ListTodo
+	if archived {
+		listTodo = dbs.ListArchivedTodo
+	}
+
+	rows, err := listTodo(reader, r.Context(), id)
+	if err != nil {
+		if logger != nil {
+			logger.Error("ListTodo", slog.String("error", err.Error()))
+		}
+		return failMsg
+	}
+	defer rows.Close()
+
+	// keep copy of streamed response for cache, unless it is too large
+	out := w
+	var capture *captureWriter
+	if cacheKey != "" {
+		capture = &captureWriter{ResponseWriter: w, max: cacheMaxEntry}
+		out = capture
+	}
+
+	if err := res.Write(out).Stream(&todoRows{rows: rows, service: t}, ndjson, failMsg); err != nil {
+		if logger != nil {
+			logger.Error("StreamTodo", slog.String("error", err.Error()))
+		}
+		return nil
+	}
+
+	if capture != nil && !capture.overflow {
+		t.cache.Set(r.Context(), cacheKey, capture.buf.Bytes())
+	}
+
+	return nil
 }
 
 func (t *TodoService) Add(w http.ResponseWriter, r *http.Request) (*dbs.TableTodos, *res.Message) {
 	logger, _ := logging.FromContext(r.Context())
-	header, errCode := validateHeader(r, t.cfg)
+	if !dbs.IsReady() {
+		return nil, res.BadResponse(http.StatusServiceUnavailable, ServiceCode, "00", "Service Unavailable")
+	}
+
+	header, client, errCode := t.validateHeader(r)
 	if errCode != nil {
 		return nil, errCode
 	}
 
+	// body as it is sent is signed, Content-Digest is computed over it
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+	if err != nil {
+		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
 	payload, errCode := validateAddBody(w, r)
 	if errCode != nil {
 		return nil, errCode
 	}
 
-	// skip err because on validateBody already handle it
-	body, _ := json.Marshal(payload)
-
 	// validate signature
-	if errCode := validateSignature(header, body, r.URL.Path, r.Method, t.cfg.Client.Secret); errCode != nil {
+	if errCode := t.validateSignature(w, header, body, r, client); errCode != nil {
+		return nil, errCode
+	}
+
+	if errCode := t.checkReplay(r.Context(), header); errCode != nil {
 		return nil, errCode
 	}
 
 	// skip err because already check in validateHeader
-	createdDate, _ := time.Parse(TSLayout, header.Timestamp)
+	createdDate, _ := auth.ParseTimestamp(header.Timestamp)
 
-	now := time.Now()
+	// stored timestamp precision is second
+	now := time.Now().UTC().Truncate(time.Second)
 	tbl := &dbs.TableTodos{
 		ID:              generateIDTodos(),
 		Title:           payload.Title,
 		Detail:          payload.DetailTodo,
-		CreatedDate:     createdDate.Format(DateLayout),
-		UpdatedDate:     now.Format(DateLayout),
+		CreatedDate:     createdDate.Truncate(time.Second),
+		UpdatedDate:     now,
 		StatusCompleted: UnCompleted,
 	}
-	if err := dbs.AddTodo(t.db, context.TODO(), tbl); err != nil {
+
+	// stored copy is encrypted, plaintext is returned to client
+	stored := *tbl
+	if err := t.sealTodo(&stored); err != nil {
+		if logger != nil {
+			logger.Error("SealTodo", slog.String("error", err.Error()))
+		}
+		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	if err := dbs.AddTodo(t.db, context.TODO(), &stored); err != nil {
 		if logger != nil {
 			logger.Error("AddTodo", slog.String("error", err.Error()))
 		} else {
@@ -85,6 +223,15 @@ func (t *TodoService) Add(w http.ResponseWriter, r *http.Request) (*dbs.TableTod
 		}
 		return nil, res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
 	}
+	t.replicas.MarkWrite(header.ClientKey)
+	t.invalidateCache(r.Context())
 
 	return tbl, nil
 }
+
+// invalidateCache drop cached todo list, every write must call this
+func (t *TodoService) invalidateCache(ctx context.Context) {
+	if t.cache != nil {
+		t.cache.Invalidate(ctx)
+	}
+}
@@ -2,95 +2,203 @@ package todo
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/arthben/http_jwt_crud/api/auth"
-	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	"github.com/arthben/http_jwt_crud/internal/lockout"
+	"github.com/arthben/http_jwt_crud/internal/logging"
+	"github.com/arthben/http_jwt_crud/internal/replay"
 	res "github.com/arthben/http_jwt_crud/internal/response"
 	bindhttp "github.com/arthben/http_jwt_crud/pkg/bind_http"
+	"github.com/arthben/http_jwt_crud/pkg/httpsig"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 )
 
 const (
 	ServiceCode = "24"
-	TSLayout    = "2006-01-02T15:04:05+07:00"
+	// TSLayout is format of X-Timestamp, any RFC 3339 offset and fractional second is accepted
+	TSLayout = auth.TSLayout
 )
 
 func generateIDTodos() string {
 	return uuid.New().String()
 }
 
-func validateHeader(r *http.Request, cfg *config.EnvParams) (*RequestHeader, *res.Message) {
-	header, errCode := validateHeaderValue(r)
-	if errCode != nil {
-		return nil, errCode
+// validateHeader validate request header of todo route. Access token and client key are already
+// verified by auth.Authenticate on the route, the client is taken from its principal
+func (t *TodoService) validateHeader(r *http.Request) (*RequestHeader, *clients.Client, *res.Message) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return nil, nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "01", "Unauthorized. Invalid Token")
 	}
 
-	if errCode := validateClientKey(cfg, header.ClientKey); errCode != nil {
-		return nil, errCode
+	header, errCode := validateHeaderValue(r)
+	if errCode != nil {
+		return nil, nil, errCode
 	}
 
-	if errCode := validateAccessToken(cfg, header.Authorization); errCode != nil {
-		return nil, errCode
+	// format already checked by validateHeaderValue
+	ts, _ := auth.ParseTimestamp(header.Timestamp)
+	if err := t.replay.CheckTimestamp(ts); err != nil {
+		return nil, nil, res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Invalid Timestamp")
 	}
 
-	return header, nil
+	return header, principal.Client, nil
 }
 
-func validateClientKey(cfg *config.EnvParams, clientKey string) *res.Message {
-	if cfg.Client.Key != clientKey {
-		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Unknown Client Key")
+// checkReplay reject request which was already accepted within the timestamp window.
+// Call it after the signature is valid
+func (t *TodoService) checkReplay(ctx context.Context, header *RequestHeader) *res.Message {
+	// X-External-ID is not signed, so the verified signature is the nonce.
+	// X-Signature is not verified when request use Signature-Input
+	nonce := header.Signature
+	if header.SignatureInput != "" {
+		nonce = header.MessageSignature
+	}
+
+	if err := t.replay.Check(ctx, header.ClientKey, nonce); err != nil {
+		if errors.Is(err, replay.ErrReplayed) {
+			return res.BadResponse(http.StatusConflict, ServiceCode, "00", "Conflict. Duplicate Request")
+		}
+		return res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
 	}
 
 	return nil
 }
 
-func validateAccessToken(cfg *config.EnvParams, accessToken string) *res.Message {
-	authService := auth.NewAuthService(cfg)
-	bearerToken := strings.Split(accessToken, "Bearer ")
-	return authService.ValidateAccessToken(strings.TrimSpace(bearerToken[1]), ServiceCode)
+// validateSignature verify signature of request. Invalid signature is counted by the lockout
+// per client key and per source IP, the same counter as access token endpoints
+func (t *TodoService) validateSignature(w http.ResponseWriter, header *RequestHeader, body []byte, r *http.Request, client *clients.Client) *res.Message {
+	ctx := r.Context()
+	lockKeys := []string{lockout.ClientKey(client.Key), lockout.IP(t.clientIP.IP(r))}
+	locked, err := t.locks.Check(ctx, lockKeys...)
+	if err != nil {
+		return res.BadResponse(http.StatusInternalServerError, ServiceCode, "00", "Error Internal Server")
+	}
+
+	if locked > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.Seconds()))))
+		return res.BadResponse(http.StatusTooManyRequests, ServiceCode, "01", "Too Many Failed Attempts")
+	}
+
+	errCode := t.verifySignature(header, body, r, client)
+	if errCode != nil && errCode.HttpStatus == http.StatusUnauthorized {
+		// counter error must not hide the signature error
+		if err := t.locks.Fail(ctx, lockKeys...); err != nil {
+			if logger, _ := logging.FromContext(ctx); logger != nil {
+				logger.Warn("Lockout Fail", slog.String("error", err.Error()))
+			}
+		}
+	}
+	return errCode
 }
 
-func validateSignature(header *RequestHeader, body []byte, reqPath string, method string, clientSecret string) *res.Message {
+// verifySignature verify X-Signature with client secret (HMAC-SHA512),
+// or with client public key when client use asymmetric signature.
+// Request with Signature-Input is verified as message signature (RFC 9421)
+func (t *TodoService) verifySignature(header *RequestHeader, body []byte, r *http.Request, client *clients.Client) *res.Message {
+	if header.SignatureInput != "" {
+		return t.validateMessageSignature(body, r, client)
+	}
+
 	// signature :
-	// HTTP Method + ":" + request Path + ":" + access token + ":" + lowercase(hexencode(SHA256(minify(body)))) + ":" + timestamp
+	// HTTP Method + ":" + request Path [+ "?" + canonical query] + ":" + access token + ":" +
+	// lowercase(hexencode(SHA256(minify(body)))) + ":" + timestamp
 
+	// empty body (GET, DELETE) is hashed as empty string
 	dst := &bytes.Buffer{}
-	if err := json.Compact(dst, body); err != nil {
-		return res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+	if len(body) > 0 {
+		if err := json.Compact(dst, body); err != nil {
+			return res.BadResponse(http.StatusBadRequest, ServiceCode, "00", "Bad Request")
+		}
 	}
 
 	h := sha256.New()
 	h.Write(dst.Bytes())
 
 	strSign := strings.Join([]string{
-		method,
-		reqPath,
-		header.Authorization[7:],
+		r.Method,
+		canonicalTarget(r.URL),
+		strings.TrimPrefix(header.Authorization, "Bearer "),
 		strings.ToLower(hex.EncodeToString(h.Sum(nil))),
 		header.Timestamp,
 	}, ":")
 
-	mac := hmac.New(sha512.New, []byte(clientSecret))
+	if client.Asymmetric() {
+		if err := auth.VerifySignature([]byte(client.PublicKey), strSign, header.Signature); err != nil {
+			return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized Signature")
+		}
+		return nil
+	}
+
+	mac := hmac.New(sha512.New, []byte(client.Secret))
 	mac.Write([]byte(strSign))
 
 	internalSignature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
-	if internalSignature != header.Signature {
+	if !hmac.Equal([]byte(internalSignature), []byte(header.Signature)) {
 		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized Signature")
 	}
 
 	return nil
 }
 
+// validateMessageSignature verify Signature-Input / Signature with the same key as X-Signature:
+// client secret (hmac-sha256) or client public key. Content-Digest must match the body
+func (t *TodoService) validateMessageSignature(body []byte, r *http.Request, client *clients.Client) *res.Message {
+	required := client.RequiredComponents()
+	if len(body) == 0 {
+		// request without body has no content to digest
+		required = slices.DeleteFunc(required, func(c string) bool { return c == "content-digest" })
+	}
+
+	if digest := r.Header.Get("Content-Digest"); digest != "" {
+		if err := httpsig.VerifyContentDigest(digest, body); err != nil {
+			return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Invalid Content-Digest")
+		}
+	}
+
+	var key any = []byte(client.Secret)
+	if client.Asymmetric() {
+		publicKey, err := auth.ParsePublicKey([]byte(client.PublicKey))
+		if err != nil {
+			return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized Signature")
+		}
+		key = publicKey
+	}
+
+	params, err := httpsig.Verify(r, key, required)
+	if err != nil {
+		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized Signature")
+	}
+
+	if params.KeyID != "" && params.KeyID != client.Key {
+		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized Signature")
+	}
+
+	// created is mandatory, so signature can not be replayed with other X-Timestamp
+	if params.Created == 0 || t.replay.CheckTimestamp(time.Unix(params.Created, 0)) != nil {
+		return res.BadResponse(http.StatusUnauthorized, ServiceCode, "00", "Unauthorized. Invalid Timestamp")
+	}
+
+	return nil
+}
+
 func validateHeaderValue(r *http.Request) (*RequestHeader, *res.Message) {
 	var header RequestHeader
 
@@ -143,20 +251,10 @@ func validateHeaderValue(r *http.Request) (*RequestHeader, *res.Message) {
 	}
 
 	// validate timestamp format
-	if _, err := time.Parse(TSLayout, header.Timestamp); err != nil {
+	if _, err := auth.ParseTimestamp(header.Timestamp); err != nil {
 		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format X-TIMESTAMP")
 	}
 
-	// validate Bearer
-	authBearer := strings.Split(header.Authorization, "Bearer")
-	if len(authBearer) == 0 {
-		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format Authorization")
-	}
-
-	if len(strings.TrimSpace(authBearer[1])) == 0 {
-		return nil, res.BadResponse(http.StatusBadRequest, ServiceCode, "01", "Invalid Field Format Authorization")
-	}
-
 	return &header, nil
 }
 
@@ -0,0 +1,29 @@
+package todo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	"github.com/arthben/http_jwt_crud/internal/lockout"
+)
+
+func TestSignatureLockout(t *testing.T) {
+	svc := &TodoService{
+		locks: lockout.NewLockout(lockout.NewMemoryStore(time.Minute), 2, time.Minute, time.Minute),
+	}
+	client := &clients.Client{Key: "client", Secret: "secret"}
+	header := &RequestHeader{Authorization: "Bearer token", Timestamp: "2024-01-02T08:04:05Z", Signature: "aW52YWxpZA=="}
+
+	// client is locked out after 2 invalid signatures
+	for i, expected := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodGet, "/v1.0/todo", nil)
+		responseRecorder := httptest.NewRecorder()
+		errCode := svc.validateSignature(responseRecorder, header, nil, request, client)
+		if errCode == nil || errCode.HttpStatus != expected {
+			t.Errorf("Request %d expected HTTP %d, got %+v", i+1, expected, errCode)
+		}
+	}
+}
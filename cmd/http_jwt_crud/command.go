@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/arthben/http_jwt_crud/api/todo"
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/jmoiron/sqlx"
+)
+
+// runCommand execute maintenance command given on program arguments
+//
+//	reencrypt : encrypt every todo, archived todo and client secret using active master key
+//	clients   : manage registered clients, see runClients
+func runCommand(ctx context.Context, args []string, db *sqlx.DB, cfg *config.EnvParams, logger *slog.Logger) error {
+	switch args[0] {
+	case "reencrypt":
+		total, err := todo.Reencrypt(ctx, db, cfg, logger)
+		logger.Info("REENCRYPT DONE", slog.Int("total", total))
+		if err != nil {
+			return err
+		}
+
+		// client secret is sealed with the same keyring
+		total, err = clients.NewManager(db, cfg).Reencrypt(ctx, logger)
+		logger.Info("REENCRYPT CLIENTS DONE", slog.Int("total", total))
+		return err
+
+	case "clients":
+		return runClients(ctx, args[1:], clients.NewManager(db, cfg))
+
+	default:
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+}
+
+// runClients execute client management command
+//
+//	clients create [--scopes "todo:read todo:write"] [--public-key file] [--signature-method hmac|asymmetric]
+//	clients list
+//	clients disable <clientKey>
+//	clients enable <clientKey>
+//	clients rotate-secret <clientKey>
+//	clients set-public-key <clientKey> <file>
+//	clients set-signature-method <clientKey> <hmac|asymmetric>
+//	clients set-signature-components <clientKey> ["@method @path @query authorization content-digest"]
+//	clients set-certificate <clientKey> <none|certificate|both> [--fingerprint sha256] [--subject "CN=partner,O=Bank"]
+func runClients(ctx context.Context, args []string, manager *clients.Manager) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing clients command")
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("clients create", flag.ContinueOnError)
+		scopes := flags.String("scopes", "", "space separated scopes of client")
+		publicKeyFile := flags.String("public-key", "", "PEM file of client public key")
+		signatureMethod := flags.String("signature-method", clients.SignatureHMAC, "hmac or asymmetric service signature")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		var publicKey string
+		if *publicKeyFile != "" {
+			raw, err := os.ReadFile(*publicKeyFile)
+			if err != nil {
+				return err
+			}
+			publicKey = string(raw)
+		}
+
+		client, err := manager.Create(ctx, *scopes, publicKey, *signatureMethod)
+		if err != nil {
+			return err
+		}
+		printClient(client)
+		return nil
+
+	case "list":
+		list, err := manager.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, client := range list {
+			fmt.Printf("%s\t%s\t%s\t%s\n", client.Key, client.Status, client.SignatureMethod, client.Scopes)
+		}
+		return nil
+
+	case "disable", "enable":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: clients %s <clientKey>", args[0])
+		}
+
+		status := clients.StatusActive
+		if args[0] == "disable" {
+			status = clients.StatusDisabled
+		}
+
+		client, err := manager.SetStatus(ctx, args[1], status)
+		if err != nil {
+			return err
+		}
+		printClient(client)
+		return nil
+
+	case "rotate-secret":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: clients rotate-secret <clientKey>")
+		}
+
+		client, err := manager.RotateSecret(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		printClient(client)
+		return nil
+
+	case "set-public-key":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: clients set-public-key <clientKey> <file>")
+		}
+
+		raw, err := os.ReadFile(args[2])
+		if err != nil {
+			return err
+		}
+
+		client, err := manager.SetPublicKey(ctx, args[1], string(raw))
+		if err != nil {
+			return err
+		}
+		printClient(client)
+		return nil
+
+	case "set-signature-method":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: clients set-signature-method <clientKey> <hmac|asymmetric>")
+		}
+
+		client, err := manager.SetSignatureMethod(ctx, args[1], args[2])
+		if err != nil {
+			return err
+		}
+		printClient(client)
+		return nil
+
+	case "set-signature-components":
+		if len(args) != 2 && len(args) != 3 {
+			return fmt.Errorf("usage: clients set-signature-components <clientKey> [components]")
+		}
+
+		// without components, client is reset to the default components
+		var components string
+		if len(args) == 3 {
+			components = args[2]
+		}
+
+		client, err := manager.SetSignatureComponents(ctx, args[1], components)
+		if err != nil {
+			return err
+		}
+		printClient(client)
+		return nil
+
+	case "set-certificate":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: clients set-certificate <clientKey> <none|certificate|both> [--fingerprint sha256] [--subject dn]")
+		}
+
+		flags := flag.NewFlagSet("clients set-certificate", flag.ContinueOnError)
+		fingerprint := flags.String("fingerprint", "", "sha256 fingerprint of client certificate")
+		subject := flags.String("subject", "", "subject DN of client certificate")
+		if err := flags.Parse(args[3:]); err != nil {
+			return err
+		}
+
+		client, err := manager.SetCertificate(ctx, args[1], args[2], *fingerprint, *subject)
+		if err != nil {
+			return err
+		}
+		printClient(client)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown clients command %s", args[0])
+	}
+}
+
+// printClient print client to stdout. Secret is only set right after create or rotate-secret
+func printClient(client *clients.Client) {
+	fmt.Printf("clientKey : %s\n", client.Key)
+	if client.Secret != "" {
+		fmt.Printf("secret    : %s (shown only once)\n", client.Secret)
+	}
+	fmt.Printf("status    : %s\n", client.Status)
+	fmt.Printf("scopes    : %s\n", client.Scopes)
+	fmt.Printf("signature : %s\n", client.SignatureMethod)
+	if client.SignatureComponents != "" {
+		fmt.Printf("covered   : %s\n", client.SignatureComponents)
+	}
+	if client.CertificateRequired() {
+		fmt.Printf("tls auth  : %s\n", client.TLSAuth)
+		fmt.Printf("cert sha  : %s\n", client.CertificateFingerprint)
+		fmt.Printf("cert dn   : %s\n", client.CertificateSubject)
+	}
+}
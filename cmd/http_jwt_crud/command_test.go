@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/arthben/http_jwt_crud/internal/clients"
+	"github.com/arthben/http_jwt_crud/internal/config"
+)
+
+// TestRunClientsUsage only cover argument error, every command which reach manager need database
+func TestRunClientsUsage(t *testing.T) {
+	manager := clients.NewManager(nil, &config.EnvParams{})
+
+	for _, ts := range []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"Missing Command", nil, "missing clients command"},
+		{"Unknown Command", []string{"delete"}, "unknown clients command delete"},
+		{"Disable Without Client Key", []string{"disable"}, "usage: clients disable <clientKey>"},
+		{"Enable With Extra Argument", []string{"enable", "a", "b"}, "usage: clients enable <clientKey>"},
+		{"Rotate Secret Without Client Key", []string{"rotate-secret"}, "usage: clients rotate-secret"},
+		{"Set Public Key Without File", []string{"set-public-key", "a"}, "usage: clients set-public-key"},
+		{"Set Public Key Missing File", []string{"set-public-key", "a", "/nonexistent.pem"}, "no such file"},
+		{"Set Signature Method Without Method", []string{"set-signature-method", "a"}, "usage: clients set-signature-method"},
+		{"Set Signature Components Without Client Key", []string{"set-signature-components"}, "usage: clients set-signature-components"},
+		{"Set Certificate Without Mode", []string{"set-certificate", "a"}, "usage: clients set-certificate"},
+		{"Set Certificate Unknown Flag", []string{"set-certificate", "a", "both", "--issuer", "x"}, "flag provided but not defined"},
+		{"Create Unknown Flag", []string{"create", "--secret", "x"}, "flag provided but not defined"},
+		{"Create Unknown Scope", []string{"create", "--scopes", "todo:read todo:delete"}, "scope must be one of"},
+		{"Create Missing Public Key File", []string{"create", "--public-key", "/nonexistent.pem"}, "no such file"},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			err := runClients(context.Background(), ts.args, manager)
+			if err == nil || !strings.Contains(err.Error(), ts.err) {
+				t.Errorf("Expected error '%s', got %v", ts.err, err)
+			}
+		})
+	}
+}
+
+func TestRunCommandUnknown(t *testing.T) {
+	err := runCommand(context.Background(), []string{"migrate"}, nil, &config.EnvParams{}, nil)
+	if err == nil || err.Error() != "unknown command migrate" {
+		t.Errorf("Expected unknown command error, got %v", err)
+	}
+}
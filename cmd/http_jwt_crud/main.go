@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -15,6 +17,7 @@ import (
 	"github.com/arthben/http_jwt_crud/internal/config"
 	"github.com/arthben/http_jwt_crud/internal/database"
 	"github.com/arthben/http_jwt_crud/internal/logging"
+	"github.com/jmoiron/sqlx"
 )
 
 type App struct {
@@ -35,21 +38,46 @@ func main() {
 	// init slog
 	logger := logging.NewLogger(cfg.AppMode, "my-service")
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// maintenance command, run then exit.
+	// Command need a ready database, so degraded start is ignored and command fail fast
+	if len(os.Args) > 1 {
+		db, err := database.BoostrapDatabase(&cfg)
+		if err != nil {
+			logger.Error("err Open Database:", slog.String("", err.Error()))
+			os.Exit(1)
+			return
+		}
+
+		err = runCommand(ctx, os.Args[1:], db, &cfg, logger)
+		database.CloseDatabase(db)
+		if err != nil {
+			logger.Error("err Command:", slog.String("command", os.Args[1]), slog.String("", err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
 	// init database
-	db, err := database.BoostrapDatabase(&cfg)
+	db, err := initDatabase(ctx, &cfg, logger)
 	if err != nil {
 		logger.Error("err Open Database:", slog.String("", err.Error()))
 		os.Exit(1)
 		return
 	}
 	defer database.CloseDatabase(db)
+	go database.Monitor(ctx, db, &cfg)
 
-	handler, err := handlers.NewHandlers(db, &cfg).BuildRouter()
+	services := handlers.NewHandlers(db, &cfg)
+	handler, err := services.BuildRouter()
 	if err != nil {
 		logger.Error("err BuildRouter:", slog.String("", err.Error()))
 		os.Exit(1)
 		return
 	}
+	services.Run(ctx)
 
 	// init middleware
 	middlewareChain := middlewares.MiddlewareChain(
@@ -68,11 +96,19 @@ func main() {
 	}
 	defer server.Close()
 
+	if len(cfg.TLS.CertFile) > 0 {
+		server.TLSConfig = tlsConfig(&cfg)
+	}
+
 	osSignal := make(chan os.Signal, 2)
 	signal.Notify(osSignal, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
 		logger.Info("SERVER START", slog.String("address", "0.0.0.0:"+cfg.Port))
+		if server.TLSConfig != nil {
+			logger.Warn("SERVER CLOSE", slog.String("error", server.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile).Error()))
+			return
+		}
 		logger.Warn("SERVER CLOSE", slog.String("error", server.ListenAndServe().Error()))
 	}()
 
@@ -84,3 +120,44 @@ func main() {
 
 	logger.Info("SERVER STOP")
 }
+
+// initDatabase wait for database before server start.
+// On degraded mode, server start immediately and database is reached in background
+func initDatabase(ctx context.Context, cfg *config.EnvParams, logger *slog.Logger) (*sqlx.DB, error) {
+	if cfg.DB.DegradedStart != "true" {
+		return database.BoostrapDatabase(cfg)
+	}
+
+	db, err := database.OpenDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		logger.Warn("SERVER START IN DEGRADED MODE. Waiting for database")
+		if err := database.Reconnect(ctx, db, cfg); err != nil {
+			logger.Error("err Reconnect Database:", slog.String("", err.Error()))
+			return
+		}
+		logger.Info("DATABASE READY")
+	}()
+
+	return db, nil
+}
+
+// tlsConfig verify client certificate with client CA bundle when configured
+func tlsConfig(cfg *config.EnvParams) *tls.Config {
+	clientAuth := tls.NoClientCert
+	switch cfg.TLS.ClientAuth {
+	case "optional":
+		clientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientCAs:  cfg.TLS.ClientCAs,
+		ClientAuth: clientAuth,
+	}
+}
@@ -19,53 +19,101 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/v1.0/access-token": {
-            "post": {
-                "consumes": [
+        "/.well-known/jwks.json": {
+            "get": {
+                "description": "Access token header ` + "`" + `kid` + "`" + ` refer to key on this set",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "Token"
+                ],
+                "summary": "Public keys to verify access token",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/auth.JWKSResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/v1.0/clients": {
+            "get": {
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Token"
+                    "Admin"
                 ],
-                "summary": "Get Access Token",
+                "summary": "List Clients",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "application/json",
-                        "name": "Content-Type",
+                        "description": "Bearer admin token",
+                        "name": "Authorization",
                         "in": "header",
                         "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ClientListResponse"
+                        }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "## Description \nRegister new client ( partner ). Client key and secret are generated by server.\n\nThe client secret is only shown once on this response ( and on rotate secret ).\nIt is stored encrypted, so encryption master key must be configured, otherwise 503 is returned.\n\nAdmin endpoints are authenticated with ` + "`" + `Authorization: Bearer \u003cadmin token\u003e` + "`" + `.\nConfigure sha256 of the token on ` + "`" + `ADMIN_TOKEN_HASH` + "`" + `, admin endpoints are disabled when it is empty.\n` + "`" + `Content-Type: application/json` + "`" + ` is required on every admin endpoint except GET.\n\nService signature ( todo endpoints ) is HMAC with client secret by default.\nSend ` + "`" + `\"signatureMethod\": \"asymmetric\"` + "`" + ` to verify it with the client public key instead, ` + "`" + `publicKey` + "`" + ` is mandatory then.\n\n## Response Code\n| HTTP  | Service | Code | Description                  |\n| ----- | ------- | ---- | -----------------------------|\n|  200  |    90   |  00  | Success                      |\n|  400  |    90   |  00  | Bad Request                  |\n|  400  |    90   |  01  | Invalid Field Format         |\n|  400  |    90   |  02  | Missing Mandatory Field      |\n|  401  |    90   |  00  | Invalid Admin Token          |\n|  404  |    90   |  00  | Client Not Found             |\n|  500  |    90   |  00  | Internal Server Error        |\n|  503  |    90   |  01  | Encryption Not Configured    |\n",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Register Client",
+                "parameters": [
                     {
                         "type": "string",
-                        "description": "Client key provided by server",
-                        "name": "X-Client-Key",
+                        "description": "application/json",
+                        "name": "Content-Type",
                         "in": "header",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "format: 2006-01-02T15:04:05+07:00",
-                        "name": "X-Timestamp",
+                        "description": "Bearer admin token",
+                        "name": "Authorization",
                         "in": "header",
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "Generated Signature",
-                        "name": "X-Signature",
-                        "in": "header",
-                        "required": true
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.CreateClientRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/auth.TokenResponse"
+                            "$ref": "#/definitions/admin.ClientResponse"
                         }
                     },
                     "400": {
@@ -79,13 +127,19 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/response.Message"
                         }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
                     }
                 }
             }
         },
-        "/v1.0/todo": {
-            "get": {
-                "description": "Get list of todo",
+        "/admin/v1.0/clients/{clientKey}/certificate": {
+            "put": {
+                "description": "Map client certificate ( mTLS ) by SHA-256 fingerprint and / or subject DN.\ntlsAuth certificate authenticate token request by the certificate instead of X-Signature, both require the two.\nAccess token issued on mTLS connection is bound to the certificate ( RFC 8705 )",
                 "consumes": [
                     "application/json"
                 ],
@@ -93,9 +147,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Todo"
+                    "Admin"
                 ],
-                "summary": "Todo List",
+                "summary": "Set Client Certificate",
                 "parameters": [
                     {
                         "type": "string",
@@ -106,47 +160,87 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Bearer token",
+                        "description": "Bearer admin token",
                         "name": "Authorization",
                         "in": "header",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Client Key provided by server",
-                        "name": "X-Client-Key",
-                        "in": "header",
+                        "description": "Client Key",
+                        "name": "clientKey",
+                        "in": "path",
                         "required": true
                     },
+                    {
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.CertificateRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ClientResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/v1.0/clients/{clientKey}/disable": {
+            "post": {
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Disable Client",
+                "parameters": [
                     {
                         "type": "string",
-                        "description": "format: 2006-01-02T15:04:05+07:00",
-                        "name": "X-Timestamp",
+                        "description": "application/json",
+                        "name": "Content-Type",
                         "in": "header",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "123425234",
-                        "name": "X-Signature",
+                        "description": "Bearer admin token",
+                        "name": "Authorization",
                         "in": "header",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "ID of todo",
-                        "name": "ID",
-                        "in": "path"
+                        "description": "Client Key",
+                        "name": "clientKey",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/database.TableTodos"
-                            }
+                            "$ref": "#/definitions/admin.ClientResponse"
                         }
                     },
                     "404": {
@@ -156,19 +250,17 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/admin/v1.0/clients/{clientKey}/enable": {
             "post": {
-                "description": "## Description \nAdd new task to todo list.\n\n## Response Code\n| HTTP  | Service | Code | Description                  |\n| ----- | ------- | ---- | -----------------------------|\n|  200  |    24   |  -   | Success                      |\n|  400  |    24   |  00  | Bad Request / Unauthorized   |\n|  400  |    24   |  01  | Invalid Field Format         |\n|  400  |    24   |  02  | Missing Mandatory Field      |\n|  500  |    24   |  00  | Internal Server Error        |",
-                "consumes": [
-                    "application/json"
-                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Todo"
+                    "Admin"
                 ],
-                "summary": "Add Todo item",
+                "summary": "Enable Client",
                 "parameters": [
                     {
                         "type": "string",
@@ -179,39 +271,76 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "description": "Bearer token",
+                        "description": "Bearer admin token",
                         "name": "Authorization",
                         "in": "header",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Client Key provided by server",
-                        "name": "X-Client-Key",
-                        "in": "header",
+                        "description": "Client Key",
+                        "name": "clientKey",
+                        "in": "path",
                         "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ClientResponse"
+                        }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/v1.0/clients/{clientKey}/public-key": {
+            "put": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Upload Client Public Key",
+                "parameters": [
                     {
                         "type": "string",
-                        "description": "format: 2006-01-02T15:04:05+07:00",
-                        "name": "X-Timestamp",
+                        "description": "application/json",
+                        "name": "Content-Type",
                         "in": "header",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "123425234",
-                        "name": "X-Signature",
+                        "description": "Bearer admin token",
+                        "name": "Authorization",
                         "in": "header",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "Client Key",
+                        "name": "clientKey",
+                        "in": "path",
+                        "required": true
+                    },
                     {
                         "description": "request",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/todo.AddTodosRequest"
+                            "$ref": "#/definitions/admin.PublicKeyRequest"
                         }
                     }
                 ],
@@ -219,7 +348,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/database.TableTodos"
+                            "$ref": "#/definitions/admin.ClientResponse"
                         }
                     },
                     "400": {
@@ -227,37 +356,1120 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/response.Message"
                         }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "auth.TokenResponse": {
-            "type": "object",
-            "properties": {
-                "accessToken": {
-                    "type": "string"
-                },
-                "expiresIn": {
-                    "type": "string"
-                },
-                "responseCode": {
-                    "type": "string"
-                },
-                "responseMessage": {
-                    "type": "string"
-                },
-                "tokenType": {
-                    "type": "string"
+        },
+        "/admin/v1.0/clients/{clientKey}/rotate-secret": {
+            "post": {
+                "description": "New secret is only shown on this response",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Rotate Client Secret",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer admin token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client Key",
+                        "name": "clientKey",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ClientResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
                 }
             }
         },
-        "database.TableTodos": {
-            "type": "object",
-            "properties": {
-                "completedDate": {
-                    "type": "string"
+        "/admin/v1.0/clients/{clientKey}/signature-components": {
+            "put": {
+                "description": "Components which message signature (Signature-Input / Signature, RFC 9421) must cover.\nEmpty reset to default: @method @path @query authorization content-digest",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Set Client Signature Components",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer admin token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client Key",
+                        "name": "clientKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.SignatureComponentsRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ClientResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/v1.0/clients/{clientKey}/signature-method": {
+            "put": {
+                "description": "Service signature (todo endpoints) is HMAC with client secret by default.\nasymmetric verify the same string-to-sign with client public key (SHA256withRSA or SHA256withECDSA)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Set Client Signature Method",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer admin token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client Key",
+                        "name": "clientKey",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.SignatureMethodRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/admin.ClientResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/v1.0/lockouts/unlock": {
+            "post": {
+                "description": "Client key and source IP are locked out after repeated failed authentication on access token endpoints.\nClear the failure counter and lockout of clientKey and / or ip",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Unlock Client",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer admin token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/admin.UnlockRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/ready": {
+            "get": {
+                "description": "Return 503 until database is reachable",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1.0/access-token": {
+            "post": {
+                "description": "## Description \nGet access token. Supported ` + "`" + `grantType` + "`" + ` :\n- ` + "`" + `client_credentials` + "`" + ` : signed with client private key, ` + "`" + `X-Signature` + "`" + ` is mandatory\n- ` + "`" + `refresh_token` + "`" + ` : redeem ` + "`" + `refreshToken` + "`" + ` of previous response, client is authenticated the same way as ` + "`" + `client_credentials` + "`" + `\n\nOptional ` + "`" + `scope` + "`" + ` ( space separated ) must be allowed for the client, default is every allowed scope.\nClient without configured scopes is allowed ` + "`" + `todo:read todo:write` + "`" + `.\n\nRefresh token is opaque and can only be used once, every response return a new refresh token.\nUsing a refresh token twice revoke every refresh token and access token issued from the same ` + "`" + `client_credentials` + "`" + ` grant.\nRotation does not extend the lifetime, every refresh token of the grant expire ` + "`" + `TOKEN_REFRESH_EXPIRE` + "`" + ` seconds after the ` + "`" + `client_credentials` + "`" + ` grant.\n\n` + "`" + `X-Timestamp` + "`" + ` must be within ` + "`" + `SECURITY_TIMESTAMP_SKEW` + "`" + ` ( default 300 seconds ) of server time.\nSigned request is only accepted once, use fractional second in ` + "`" + `X-Timestamp` + "`" + ` when requesting token twice within the same second.\n\nRefresh token is disabled when ` + "`" + `TOKEN_REFRESH_EXPIRE=0` + "`" + `.\n\nClient with ` + "`" + `tlsAuth: certificate` + "`" + ` authenticate with client certificate ( mTLS ) instead of ` + "`" + `X-Signature` + "`" + `, ` + "`" + `both` + "`" + ` require the two.\nAccess token requested with client certificate is bound to it ( ` + "`" + `cnf.x5t#S256` + "`" + `, RFC 8705 ).\nRefresh token of a bound grant is only redeemed with the same certificate, and the new access token stay bound to it.\n\nUnknown client and invalid signature are counted per ` + "`" + `X-Client-Key` + "`" + ` and per source IP.\nAfter ` + "`" + `LOCKOUT_MAX_FAILURES` + "`" + ` ( default 5 ) failures the key is locked out with HTTP 429 and ` + "`" + `Retry-After` + "`" + `,\ncooldown is doubled on each following lockout. Admin may unlock with ` + "`" + `POST /admin/v1.0/lockouts/unlock` + "`" + `.\n\n## Response Code\n| HTTP  | Service | Code | Description                  |\n| ----- | ------- | ---- | -----------------------------|\n|  200  |    73   |  00  | Success                      |\n|  400  |    73   |  00  | Bad Request                  |\n|  400  |    73   |  01  | Invalid Field Format / Scope |\n|  400  |    73   |  02  | Missing Mandatory Field      |\n|  401  |    73   |  00  | Unauthorized                 |\n|  401  |    73   |  01  | Invalid Refresh Token        |\n|  409  |    73   |  00  | Duplicate Request            |\n|  429  |    73   |  00  | Too Many Requests            |\n|  429  |    73   |  01  | Too Many Failed Attempts     |\n|  500  |    73   |  00  | Internal Server Error        |\n",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Token"
+                ],
+                "summary": "Get Access Token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client key provided by server",
+                        "name": "X-Client-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339, ex: 2006-01-02T15:04:05+07:00",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Generated Signature, not required when client authenticate with certificate only",
+                        "name": "X-Signature",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Request ID for tracing, not used as nonce",
+                        "name": "X-External-ID",
+                        "in": "header"
+                    },
+                    {
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.TokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/auth.TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1.0/access-token/introspect": {
+            "post": {
+                "description": "## Description \nReturn state of access token (RFC 7662). Client is authenticated the same way as Get Access Token.\n\nExpired, revoked, invalid token or token issued to other client is responded with ` + "`" + `\"active\": false` + "`" + ` only.\n\n## Response Code\n| HTTP  | Service | Code | Description                  |\n| ----- | ------- | ---- | -----------------------------|\n|  200  |    73   |  00  | Success                      |\n|  400  |    73   |  00  | Bad Request                  |\n|  400  |    73   |  01  | Invalid Field Format         |\n|  400  |    73   |  02  | Missing Mandatory Field      |\n|  401  |    73   |  00  | Unauthorized                 |\n|  429  |    73   |  00  | Too Many Requests            |\n|  429  |    73   |  01  | Too Many Failed Attempts     |\n|  500  |    73   |  00  | Internal Server Error        |\n",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Token"
+                ],
+                "summary": "Introspect Access Token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client key provided by server",
+                        "name": "X-Client-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339, ex: 2006-01-02T15:04:05+07:00",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Generated Signature",
+                        "name": "X-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.TokenActionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/auth.IntrospectResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1.0/access-token/revoke": {
+            "post": {
+                "description": "## Description \nRevoke access token before it expires (RFC 7009). Client is authenticated the same way as Get Access Token.\n\nClient can only revoke its own token. Invalid or expired token is ignored and responded as success.\nRevoked token is rejected by every endpoint until it expires.\n\nUse ` + "`" + `REVOCATION_STORE=database` + "`" + ` when running multiple replicas, so revoked token is shared.\n\n## Response Code\n| HTTP  | Service | Code | Description                  |\n| ----- | ------- | ---- | -----------------------------|\n|  200  |    73   |  00  | Success                      |\n|  400  |    73   |  00  | Bad Request                  |\n|  400  |    73   |  01  | Invalid Field Format         |\n|  400  |    73   |  02  | Missing Mandatory Field      |\n|  401  |    73   |  00  | Unauthorized                 |\n|  401  |    73   |  01  | Token issued to other client |\n|  429  |    73   |  00  | Too Many Requests            |\n|  429  |    73   |  01  | Too Many Failed Attempts     |\n|  500  |    73   |  00  | Internal Server Error        |\n",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Token"
+                ],
+                "summary": "Revoke Access Token",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client key provided by server",
+                        "name": "X-Client-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339, ex: 2006-01-02T15:04:05+07:00",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Generated Signature",
+                        "name": "X-Signature",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/auth.TokenActionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1.0/todo": {
+            "get": {
+                "description": "## Description \nGet list of todo. The list is streamed to client while reading from database.\n\nResponse is JSON array by default. Send header ` + "`" + `Accept: application/x-ndjson` + "`" + ` to receive one todo per line.\n\n## Signature\nRequest is signed like other todo endpoints, with empty body. ID and query string are part of the signature :\n` + "`" + `` + "`" + `` + "`" + `\nGET:/v1.0/todo?archived=true:\u003caccess token\u003e:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855:\u003cX-Timestamp\u003e\n` + "`" + `` + "`" + `` + "`" + `\nQuery parameters are sorted by name then value and percent-encoded ( RFC 3986, space is ` + "`" + `%20` + "`" + ` ).\n\nMessage signature ( ` + "`" + `Signature-Input` + "`" + ` / ` + "`" + `Signature` + "`" + `, RFC 9421 ) is accepted instead of ` + "`" + `X-Signature` + "`" + `,\n` + "`" + `content-digest` + "`" + ` is not required since there is no body.\nInvalid signature is counted by the lockout of access token endpoints, see ` + "`" + `POST /v1.0/access-token` + "`" + `.\n\n## Error While Streaming\nError before the first todo is written is responded as usual.\nOnce streaming started, HTTP status can not be changed anymore :\n- trailer ` + "`" + `X-Stream-Error` + "`" + ` contains the response code\n- NDJSON : the last line is the error object ` + "`" + `{\"responseCode\": \"...\", \"responseMessage\": \"...\"}` + "`" + `\n- JSON array : closing bracket ` + "`" + `]` + "`" + ` is not written, so partial list is never a valid JSON\n\n## Response Code\n| HTTP  | Service | Code | Description                  |\n| ----- | ------- | ---- | -----------------------------|\n|  200  |    24   |  -   | Success                      |\n|  400  |    24   |  00  | Bad Request / Unauthorized   |\n|  400  |    24   |  01  | Invalid Field Format         |\n|  400  |    24   |  02  | Missing Mandatory Field      |\n|  401  |    24   |  00  | Unauthorized                 |\n|  401  |    24   |  01  | Invalid Token                |\n|  403  |    24   |  00  | Token has no todo:read scope |\n|  404  |    24   |  00  | No Data Found                |\n|  409  |    24   |  00  | Duplicate Request            |\n|  429  |    24   |  00  | Too Many Requests            |\n|  429  |    24   |  01  | Too Many Failed Attempts     |\n|  500  |    24   |  00  | Internal Server Error        |\n|  503  |    24   |  00  | Service Unavailable          |\n",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "Todo"
+                ],
+                "summary": "Todo List",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client Key provided by server",
+                        "name": "X-Client-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339, ex: 2006-01-02T15:04:05+07:00",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "123425234, not required when Signature-Input is sent",
+                        "name": "X-Signature",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9421, ex: sig1=(\\",
+                        "name": "Signature-Input",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9421, ex: sig1=:base64:",
+                        "name": "Signature",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "true to read from primary shortly after own write",
+                        "name": "X-Read-Your-Writes",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "application/json (default) or application/x-ndjson",
+                        "name": "Accept",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of todo",
+                        "name": "ID",
+                        "in": "path"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "true to list archived todo",
+                        "name": "archived",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/database.TableTodos"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "## Description \nAdd new task to todo list. Access token must have ` + "`" + `todo:write` + "`" + ` scope.\n\n` + "`" + `X-Timestamp` + "`" + ` must be within ` + "`" + `SECURITY_TIMESTAMP_SKEW` + "`" + ` ( default 300 seconds ) of server time.\nSigned request is only accepted once, send a new ` + "`" + `X-Timestamp` + "`" + ` to submit the same payload again.\n\nRequest is signed with ` + "`" + `X-Signature` + "`" + `, or with message signature ( ` + "`" + `Signature-Input` + "`" + ` / ` + "`" + `Signature` + "`" + `, RFC 9421 )\nalong with ` + "`" + `Content-Digest` + "`" + ` ( RFC 9530 ) of the body as it is sent, see README.\nInvalid signature is counted by the lockout of access token endpoints, see ` + "`" + `POST /v1.0/access-token` + "`" + `.\n\n## Response Code\n| HTTP  | Service | Code | Description                  |\n| ----- | ------- | ---- | -----------------------------|\n|  200  |    24   |  -   | Success                      |\n|  400  |    24   |  00  | Bad Request / Unauthorized   |\n|  400  |    24   |  01  | Invalid Field Format         |\n|  400  |    24   |  02  | Missing Mandatory Field      |\n|  401  |    24   |  00  | Unauthorized / Invalid Timestamp |\n|  403  |    24   |  00  | Token has no todo:write scope|\n|  409  |    24   |  00  | Duplicate Request            |\n|  429  |    24   |  00  | Too Many Requests            |\n|  429  |    24   |  01  | Too Many Failed Attempts     |\n|  500  |    24   |  00  | Internal Server Error        |",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Todo"
+                ],
+                "summary": "Add Todo item",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client Key provided by server",
+                        "name": "X-Client-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339, ex: 2006-01-02T15:04:05+07:00",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "123425234, not required when Signature-Input is sent",
+                        "name": "X-Signature",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9421, ex: sig1=(\\",
+                        "name": "Signature-Input",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9421, ex: sig1=:base64:",
+                        "name": "Signature",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9530, ex: sha-256=:base64:",
+                        "name": "Content-Digest",
+                        "in": "header"
+                    },
+                    {
+                        "description": "request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/todo.AddTodosRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/database.TableTodos"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1.0/todo/{ID}/unarchive": {
+            "post": {
+                "description": "Move archived todo back to todo list. Signature is generated with empty body",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Todo"
+                ],
+                "summary": "Unarchive Todo",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "application/json",
+                        "name": "Content-Type",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client Key provided by server",
+                        "name": "X-Client-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 3339, ex: 2006-01-02T15:04:05+07:00",
+                        "name": "X-Timestamp",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "123425234, not required when Signature-Input is sent",
+                        "name": "X-Signature",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9421, ex: sig1=(\\",
+                        "name": "Signature-Input",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "RFC 9421, ex: sig1=:base64:",
+                        "name": "Signature",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ID of todo",
+                        "name": "ID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/response.Message"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "admin.CertificateRequest": {
+            "type": "object",
+            "required": [
+                "tlsAuth"
+            ],
+            "properties": {
+                "certificateFingerprint": {
+                    "description": "hex SHA-256 of client certificate, colon separator is allowed",
+                    "type": "string",
+                    "maxLength": 128
+                },
+                "certificateSubject": {
+                    "description": "subject DN of client certificate, ex: CN=partner,O=Bank",
+                    "type": "string",
+                    "maxLength": 512
+                },
+                "tlsAuth": {
+                    "description": "none, certificate (instead of X-Signature) or both",
+                    "type": "string",
+                    "enum": [
+                        "none",
+                        "certificate",
+                        "both"
+                    ]
+                }
+            }
+        },
+        "admin.ClientListResponse": {
+            "type": "object",
+            "properties": {
+                "clients": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/admin.ClientResponse"
+                    }
+                },
+                "responseCode": {
+                    "type": "string"
+                },
+                "responseMessage": {
+                    "type": "string"
+                }
+            }
+        },
+        "admin.ClientResponse": {
+            "type": "object",
+            "properties": {
+                "certificateFingerprint": {
+                    "type": "string"
+                },
+                "certificateSubject": {
+                    "type": "string"
+                },
+                "clientKey": {
+                    "type": "string"
+                },
+                "clientSecret": {
+                    "description": "only returned once, on create and rotate secret",
+                    "type": "string"
+                },
+                "publicKey": {
+                    "type": "string"
+                },
+                "responseCode": {
+                    "type": "string"
+                },
+                "responseMessage": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "string"
+                },
+                "signatureComponents": {
+                    "description": "space separated components which message signature must cover, empty is default",
+                    "type": "string"
+                },
+                "signatureMethod": {
+                    "description": "hmac or asymmetric",
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "tlsAuth": {
+                    "description": "none, certificate or both",
+                    "type": "string"
+                }
+            }
+        },
+        "admin.CreateClientRequest": {
+            "type": "object",
+            "properties": {
+                "publicKey": {
+                    "description": "optional, PEM encoded public key",
+                    "type": "string",
+                    "maxLength": 4096
+                },
+                "scopes": {
+                    "description": "space separated allowed scopes, todo:read and / or todo:write. Empty allow both",
+                    "type": "string",
+                    "maxLength": 512
+                },
+                "signatureMethod": {
+                    "description": "optional, hmac (default) or asymmetric. asymmetric require publicKey",
+                    "type": "string",
+                    "enum": [
+                        "hmac",
+                        "asymmetric"
+                    ]
+                }
+            }
+        },
+        "admin.PublicKeyRequest": {
+            "type": "object",
+            "required": [
+                "publicKey"
+            ],
+            "properties": {
+                "publicKey": {
+                    "type": "string",
+                    "maxLength": 4096
+                }
+            }
+        },
+        "admin.SignatureComponentsRequest": {
+            "type": "object",
+            "properties": {
+                "signatureComponents": {
+                    "description": "space separated components which message signature must cover, empty reset to default",
+                    "type": "string",
+                    "maxLength": 512
+                }
+            }
+        },
+        "admin.SignatureMethodRequest": {
+            "type": "object",
+            "required": [
+                "signatureMethod"
+            ],
+            "properties": {
+                "signatureMethod": {
+                    "description": "hmac or asymmetric",
+                    "type": "string",
+                    "enum": [
+                        "hmac",
+                        "asymmetric"
+                    ]
+                }
+            }
+        },
+        "admin.UnlockRequest": {
+            "type": "object",
+            "properties": {
+                "clientKey": {
+                    "description": "client key to unlock, optional when ip is given",
+                    "type": "string",
+                    "maxLength": 64
+                },
+                "ip": {
+                    "description": "source IP to unlock, optional when clientKey is given",
+                    "type": "string"
+                }
+            }
+        },
+        "auth.IntrospectResponse": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "aud": {
+                    "type": "string"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "cnf": {
+                    "description": "certificate which token is bound to (RFC 8705)",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "exp": {
+                    "type": "integer"
+                },
+                "iat": {
+                    "type": "integer"
+                },
+                "iss": {
+                    "type": "string"
+                },
+                "jti": {
+                    "type": "string"
+                },
+                "responseCode": {
+                    "type": "string"
+                },
+                "responseMessage": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "sub": {
+                    "type": "string"
+                },
+                "token_type": {
+                    "type": "string"
+                }
+            }
+        },
+        "auth.JWK": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "string"
+                },
+                "crv": {
+                    "type": "string"
+                },
+                "e": {
+                    "type": "string"
+                },
+                "kid": {
+                    "type": "string"
+                },
+                "kty": {
+                    "type": "string"
+                },
+                "n": {
+                    "type": "string"
+                },
+                "use": {
+                    "type": "string"
+                },
+                "x": {
+                    "type": "string"
+                },
+                "y": {
+                    "type": "string"
+                }
+            }
+        },
+        "auth.JWKSResponse": {
+            "type": "object",
+            "properties": {
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/auth.JWK"
+                    }
+                }
+            }
+        },
+        "auth.TokenActionRequest": {
+            "type": "object",
+            "required": [
+                "token"
+            ],
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "auth.TokenRequest": {
+            "type": "object",
+            "required": [
+                "grantType"
+            ],
+            "properties": {
+                "grantType": {
+                    "type": "string"
+                },
+                "refreshToken": {
+                    "description": "mandatory on refresh_token grant",
+                    "type": "string"
+                },
+                "scope": {
+                    "description": "optional space separated scopes, default is every scope allowed for client",
+                    "type": "string"
+                }
+            }
+        },
+        "auth.TokenResponse": {
+            "type": "object",
+            "properties": {
+                "accessToken": {
+                    "type": "string"
+                },
+                "expiresIn": {
+                    "type": "string"
+                },
+                "refreshExpiresIn": {
+                    "type": "string"
+                },
+                "refreshToken": {
+                    "description": "opaque token, use once on refresh_token grant",
+                    "type": "string"
+                },
+                "responseCode": {
+                    "type": "string"
+                },
+                "responseMessage": {
+                    "type": "string"
+                },
+                "scope": {
+                    "type": "string"
+                },
+                "tokenType": {
+                    "type": "string"
+                }
+            }
+        },
+        "database.TableTodos": {
+            "type": "object",
+            "properties": {
+                "completedDate": {
+                    "type": "string",
+                    "format": "date-time"
                 },
                 "createdDate": {
                     "type": "string"
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"expvar"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// counters published on /admin/v1.0/debug/vars as cache.<namespace>_hits and cache.<namespace>_misses
+var counters = expvar.NewMap("cache")
+
+// Store is the backend of Cache.
+// Redis compatible store can implement it with GET and SET EX command.
+// Value is the decrypted response, so a shared store keep todo in plain text outside the database.
+// Encrypt the value before using a shared store when Encryption is configured
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Cache keep response keyed by client and query.
+// Every entry is prefixed with generation, so Invalidate only need to change the generation
+// and old entries will be expired by the store.
+// Generation live in the store, with the in memory store Invalidate only reach the local process
+// and other replicas serve stale entry until ttl
+type Cache struct {
+	store     Store
+	namespace string
+	ttl       time.Duration
+}
+
+func New(store Store, namespace string, ttl time.Duration) *Cache {
+	return &Cache{store: store, namespace: namespace, ttl: ttl}
+}
+
+// Key return entry key of client and query on current generation.
+// Use the same key for Get and Set, so value loaded before Invalidate is never kept on new generation
+func (c *Cache) Key(ctx context.Context, client string, query string) string {
+	gen, ok, err := c.store.Get(ctx, c.generationKey())
+	if err != nil || !ok {
+		// generation is lost (evicted or store restarted), start a new one
+		// so entry of previous generation is never served
+		gen = []byte(uuid.New().String())
+		_ = c.store.Set(ctx, c.generationKey(), gen, 0)
+	}
+
+	return strings.Join([]string{c.namespace, string(gen), client, query}, ":")
+}
+
+// Get return cached value of key
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool) {
+	value, ok, err := c.store.Get(ctx, key)
+	if err != nil || !ok {
+		counters.Add(c.namespace+"_misses", 1)
+		return nil, false
+	}
+
+	counters.Add(c.namespace+"_hits", 1)
+	return value, true
+}
+
+// Set keep value of key until ttl
+func (c *Cache) Set(ctx context.Context, key string, value []byte) {
+	_ = c.store.Set(ctx, key, value, c.ttl)
+}
+
+// Invalidate drop every entry on the namespace
+func (c *Cache) Invalidate(ctx context.Context) {
+	_ = c.store.Set(ctx, c.generationKey(), []byte(uuid.New().String()), 0)
+}
+
+func (c *Cache) generationKey() string {
+	return c.namespace + ":generation"
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCacheInvalidate(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), "test", time.Minute)
+
+	key := c.Key(ctx, "client", "id=")
+	if _, ok := c.Get(ctx, key); ok {
+		t.Errorf("Expected miss on empty cache")
+	}
+
+	c.Set(ctx, key, []byte("v1"))
+	if value, ok := c.Get(ctx, c.Key(ctx, "client", "id=")); !ok || string(value) != "v1" {
+		t.Errorf("Expected hit 'v1', got '%s' %v", value, ok)
+	}
+
+	// entry of other client is not shared
+	if _, ok := c.Get(ctx, c.Key(ctx, "other", "id=")); ok {
+		t.Errorf("Expected miss for other client")
+	}
+
+	// write invalidate every entry
+	c.Invalidate(ctx)
+	if _, ok := c.Get(ctx, c.Key(ctx, "client", "id=")); ok {
+		t.Errorf("Expected miss after invalidate")
+	}
+
+	// value loaded before invalidate is stored on the old generation, never served
+	c.Set(ctx, key, []byte("stale"))
+	if _, ok := c.Get(ctx, c.Key(ctx, "client", "id=")); ok {
+		t.Errorf("Expected stale value of old generation is not served")
+	}
+}
+
+func TestCacheGenerationLost(t *testing.T) {
+	ctx := context.Background()
+	// capacity 1, entry evict the generation
+	c := New(NewLRU(1), "test", time.Minute)
+
+	key := c.Key(ctx, "client", "id=")
+	c.Set(ctx, key, []byte("v1"))
+
+	if _, ok := c.Get(ctx, c.Key(ctx, "client", "id=")); ok {
+		t.Errorf("Expected miss when generation is lost")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(2)
+
+	l.Set(ctx, "a", []byte("a"), 0)
+	l.Set(ctx, "b", []byte("b"), 0)
+	l.Get(ctx, "a")
+	l.Set(ctx, "c", []byte("c"), 0)
+
+	if _, ok, _ := l.Get(ctx, "b"); ok {
+		t.Errorf("Expected least recently used 'b' is evicted")
+	}
+	if _, ok, _ := l.Get(ctx, "a"); !ok {
+		t.Errorf("Expected 'a' is kept")
+	}
+
+	l.Set(ctx, "ttl", []byte("ttl"), 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := l.Get(ctx, "ttl"); ok {
+		t.Errorf("Expected expired entry is not returned")
+	}
+}
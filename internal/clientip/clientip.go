@@ -0,0 +1,70 @@
+// Package clientip resolve source IP of request, behind trusted load balancer or reverse proxy
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+)
+
+// Resolver return remote address of request. When remote address is a trusted proxy,
+// source IP is the right-most address of X-Forwarded-For which is not a trusted proxy.
+// Nil resolver trust no proxy
+type Resolver struct {
+	proxies []netip.Prefix
+}
+
+// New build resolver based on Server TrustedProxies config
+func New(cfg *config.EnvParams) *Resolver {
+	return NewResolver(cfg.Server.Proxies)
+}
+
+func NewResolver(proxies []netip.Prefix) *Resolver {
+	return &Resolver{proxies: proxies}
+}
+
+// IP return source IP of request
+func (res *Resolver) IP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if res == nil || !res.trusted(host) {
+		return host
+	}
+
+	// X-Forwarded-For may be sent more than once, each proxy append the address it received from.
+	// Address left of the first untrusted one is set by the client and can not be trusted
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// malformed hop, the proxy which sent it is the last known address
+			return host
+		}
+		if !res.trusted(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func (res *Resolver) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	return slices.ContainsFunc(res.proxies, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
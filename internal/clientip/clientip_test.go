@@ -0,0 +1,50 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIP(t *testing.T) {
+	resolver := NewResolver([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.10/32")})
+
+	for _, ts := range []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"Without Proxy", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"Untrusted Remote Address Ignore Header", "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"Trusted Proxy", "10.0.0.1:1234", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"Chain Of Trusted Proxies", "10.0.0.1:1234", []string{"198.51.100.1, 203.0.113.7, 192.0.2.10"}, "203.0.113.7"},
+		{"Header Sent More Than Once", "10.0.0.1:1234", []string{"198.51.100.1", "203.0.113.7"}, "203.0.113.7"},
+		{"Client Forged Left Address", "10.0.0.1:1234", []string{"10.0.0.2, 203.0.113.7"}, "203.0.113.7"},
+		{"Only Trusted Proxies", "10.0.0.1:1234", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"Trusted Proxy Without Header", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"Malformed Hop", "10.0.0.1:1234", []string{"203.0.113.7, unknown"}, "10.0.0.1"},
+		{"IPv6", "[2001:db8::1]:1234", nil, "2001:db8::1"},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = ts.remoteAddr
+			for _, value := range ts.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if ip := resolver.IP(r); ip != ts.expected {
+				t.Errorf("Expected %s, got %s", ts.expected, ip)
+			}
+		})
+	}
+
+	// nil resolver trust no proxy
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Add("X-Forwarded-For", "203.0.113.7")
+	if ip := (*Resolver)(nil).IP(r); ip != "10.0.0.1" {
+		t.Errorf("Expected remote address, got %s", ip)
+	}
+}
@@ -0,0 +1,280 @@
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/encryption"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	StatusActive   = "active"
+	StatusDisabled = "disabled"
+)
+
+// Signature method of service request (todo endpoints)
+const (
+	// HMAC-SHA512 with client secret, default
+	SignatureHMAC = "hmac"
+	// SHA256withRSA or SHA256withECDSA, verified with client public key
+	SignatureAsymmetric = "asymmetric"
+)
+
+// TLS client authentication (mTLS) on token endpoint
+const (
+	// X-Signature only, default
+	TLSAuthNone = "none"
+	// client certificate instead of X-Signature
+	TLSAuthCertificate = "certificate"
+	// client certificate and X-Signature
+	TLSAuthBoth = "both"
+)
+
+// DefaultSignatureComponents is components which message signature (RFC 9421) must cover
+// when client has none configured. content-digest is only required on request with body
+const DefaultSignatureComponents = "@method @path @query authorization content-digest"
+
+// DefaultScopes is every scope of the API, allowed to client which has no scopes configured
+const DefaultScopes = "todo:read todo:write"
+
+var ErrNotFound = errors.New("client not found")
+
+// Client is partner which allowed to call the API
+type Client struct {
+	Key string `yaml:"key"`
+	// HMAC secret of service signature
+	Secret string `yaml:"secret"`
+	// RSA or ECDSA public key (PEM) of access token signature,
+	// also service signature when SignatureMethod is SignatureAsymmetric
+	PublicKey string `yaml:"publicKey"`
+	Status    string `yaml:"status"`
+	// space separated allowed scopes
+	Scopes string `yaml:"scopes"`
+	// SignatureHMAC (default) or SignatureAsymmetric
+	SignatureMethod string `yaml:"signatureMethod"`
+	// space separated components which message signature must cover
+	SignatureComponents string `yaml:"signatureComponents"`
+	// TLSAuthNone (default), TLSAuthCertificate or TLSAuthBoth
+	TLSAuth string `yaml:"tlsAuth"`
+	// lowercase hex SHA-256 of client certificate (DER)
+	CertificateFingerprint string `yaml:"certificateFingerprint"`
+	// subject distinguished name of client certificate, ex: CN=partner,O=Bank
+	CertificateSubject string `yaml:"certificateSubject"`
+}
+
+func (c *Client) Active() bool {
+	return c.Status == StatusActive
+}
+
+// Asymmetric report whether service signature is verified with public key instead of secret
+func (c *Client) Asymmetric() bool {
+	return c.SignatureMethod == SignatureAsymmetric
+}
+
+// CertificateRequired report whether token endpoint require client certificate of the client
+func (c *Client) CertificateRequired() bool {
+	return c.TLSAuth == TLSAuthCertificate || c.TLSAuth == TLSAuthBoth
+}
+
+// SignatureRequired report whether token endpoint require X-Signature of the client
+func (c *Client) SignatureRequired() bool {
+	return c.TLSAuth != TLSAuthCertificate
+}
+
+// MatchCertificate report whether cert is mapped to the client by fingerprint and / or subject.
+// Every configured mapping must match, client without mapping match no certificate
+func (c *Client) MatchCertificate(cert *x509.Certificate) bool {
+	if cert == nil || (c.CertificateFingerprint == "" && c.CertificateSubject == "") {
+		return false
+	}
+
+	if c.CertificateFingerprint != "" && c.CertificateFingerprint != Fingerprint(cert) {
+		return false
+	}
+
+	if c.CertificateSubject != "" && c.CertificateSubject != cert.Subject.String() {
+		return false
+	}
+
+	return true
+}
+
+// Fingerprint return lowercase hex SHA-256 of certificate DER
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// RequiredComponents return components which message signature must cover,
+// DefaultSignatureComponents when none is configured
+func (c *Client) RequiredComponents() []string {
+	if strings.TrimSpace(c.SignatureComponents) == "" {
+		return strings.Fields(DefaultSignatureComponents)
+	}
+	return strings.Fields(c.SignatureComponents)
+}
+
+// AllowedScopes return scopes which client can request, DefaultScopes when none is configured
+func (c *Client) AllowedScopes() []string {
+	if strings.TrimSpace(c.Scopes) == "" {
+		return strings.Fields(DefaultScopes)
+	}
+	return strings.Fields(c.Scopes)
+}
+
+// Store lookup client by client key. ErrNotFound is returned when client is not registered
+type Store interface {
+	Get(ctx context.Context, clientKey string) (*Client, error)
+}
+
+// DBStore lookup client on clients table. Secret is decrypted using keyring
+type DBStore struct {
+	db      *sqlx.DB
+	keyring *encryption.Keyring
+	// warn once when clients table does not exist
+	missingTable sync.Once
+}
+
+func NewDBStore(db *sqlx.DB, keyring *encryption.Keyring) *DBStore {
+	return &DBStore{db: db, keyring: keyring}
+}
+
+// Get implements Store.
+func (s *DBStore) Get(ctx context.Context, clientKey string) (*Client, error) {
+	tb, err := dbs.GetClient(s.db, ctx, clientKey)
+	if dbs.IsMissingTable(err) {
+		// database created before clients table, next store is used until migration is run
+		s.missingTable.Do(func() {
+			slog.Warn("Client Store", slog.String("error", err.Error()))
+		})
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tb == nil {
+		return nil, ErrNotFound
+	}
+
+	secret, err := openSecret(s.keyring, tb)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		Key:                    tb.ClientKey,
+		Secret:                 secret,
+		PublicKey:              tb.PublicKey,
+		Status:                 tb.Status,
+		Scopes:                 tb.Scopes,
+		SignatureMethod:        tb.SignatureMethod,
+		SignatureComponents:    tb.SignatureComponents,
+		TLSAuth:                tb.TLSAuth,
+		CertificateFingerprint: tb.CertificateFingerprint,
+		CertificateSubject:     tb.CertificateSubject,
+	}, nil
+}
+
+// MemoryStore hold fixed list of clients, ex: loaded from file or config
+type MemoryStore struct {
+	clients map[string]*Client
+}
+
+func NewMemoryStore(clients ...*Client) *MemoryStore {
+	s := &MemoryStore{clients: map[string]*Client{}}
+	for _, c := range clients {
+		s.clients[c.Key] = c
+	}
+	return s
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(ctx context.Context, clientKey string) (*Client, error) {
+	c, ok := s.clients[clientKey]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	copied := *c
+	return &copied, nil
+}
+
+// Chain lookup client on every store in order.
+// Next store is only used when client is not found, including when clients table does not exist.
+// Failing store stop the lookup, so client which was disabled or rotated on the first store never fall back to a stale entry
+type Chain []Store
+
+// Get implements Store.
+func (c Chain) Get(ctx context.Context, clientKey string) (*Client, error) {
+	for _, store := range c {
+		client, err := store.Get(ctx, clientKey)
+		if err == nil {
+			return client, nil
+		}
+
+		if !errors.Is(err, ErrNotFound) {
+			slog.Warn("Client Store", slog.String("error", err.Error()))
+			return nil, err
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// New build client store. Clients table is looked up first,
+// clients file and client on config are used as fallback
+func New(db *sqlx.DB, cfg *config.EnvParams) Store {
+	var chain Chain
+	if cfg.Clients.Database == "true" {
+		chain = append(chain, NewDBStore(db, NewKeyring(cfg)))
+	}
+
+	// client on clients file override client on config
+	var fileClients []*Client
+	if len(cfg.Client.Key) > 0 {
+		fileClients = append(fileClients, &Client{
+			Key:                    cfg.Client.Key,
+			Secret:                 cfg.Client.Secret,
+			PublicKey:              cfg.Client.PublicKey,
+			Status:                 StatusActive,
+			Scopes:                 cfg.Client.Scopes,
+			SignatureMethod:        cfg.Client.SignatureMethod,
+			SignatureComponents:    cfg.Client.SignatureComponents,
+			TLSAuth:                cfg.Client.TLSAuth,
+			CertificateFingerprint: cfg.Client.CertificateFingerprint,
+			CertificateSubject:     cfg.Client.CertificateSubject,
+		})
+	}
+
+	for _, c := range cfg.Clients.Registered {
+		fileClients = append(fileClients, &Client{
+			Key:                    c.Key,
+			Secret:                 c.Secret,
+			PublicKey:              c.PublicKey,
+			Status:                 c.Status,
+			Scopes:                 c.Scopes,
+			SignatureMethod:        c.SignatureMethod,
+			SignatureComponents:    c.SignatureComponents,
+			TLSAuth:                c.TLSAuth,
+			CertificateFingerprint: c.CertificateFingerprint,
+			CertificateSubject:     c.CertificateSubject,
+		})
+	}
+
+	if len(fileClients) > 0 {
+		chain = append(chain, NewMemoryStore(fileClients...))
+	}
+
+	return chain
+}
@@ -0,0 +1,103 @@
+package clients
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// failingStore is store which can not be reached, ex: database outage
+type failingStore struct{ err error }
+
+func (s failingStore) Get(ctx context.Context, clientKey string) (*Client, error) {
+	return nil, s.err
+}
+
+func TestChainOrder(t *testing.T) {
+	ctx := context.Background()
+	db := NewMemoryStore(&Client{Key: "a", Secret: "db", Status: StatusActive})
+	file := NewMemoryStore(
+		&Client{Key: "a", Secret: "file", Status: StatusActive},
+		&Client{Key: "b", Secret: "file", Status: StatusActive},
+	)
+	chain := Chain{db, file}
+
+	if client, err := chain.Get(ctx, "a"); err != nil || client.Secret != "db" {
+		t.Errorf("Expected client of the first store, got %+v %v", client, err)
+	}
+
+	if client, err := chain.Get(ctx, "b"); err != nil || client.Secret != "file" {
+		t.Errorf("Expected fallback to next store when not found, got %+v %v", client, err)
+	}
+
+	if _, err := chain.Get(ctx, "c"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestChainDisabledOverride(t *testing.T) {
+	ctx := context.Background()
+	chain := Chain{
+		NewMemoryStore(&Client{Key: "a", Secret: "rotated", Status: StatusDisabled}),
+		NewMemoryStore(&Client{Key: "a", Secret: "stale", Status: StatusActive}),
+	}
+
+	client, err := chain.Get(ctx, "a")
+	if err != nil || client.Active() || client.Secret != "rotated" {
+		t.Errorf("Expected disabled client of the first store, got %+v %v", client, err)
+	}
+}
+
+func TestChainStoreError(t *testing.T) {
+	ctx := context.Background()
+	outage := errors.New("connection refused")
+	chain := Chain{
+		failingStore{err: outage},
+		NewMemoryStore(&Client{Key: "a", Secret: "stale", Status: StatusActive}),
+	}
+
+	// stale file entry must not authenticate while the database is failing
+	if client, err := chain.Get(ctx, "a"); !errors.Is(err, outage) || client != nil {
+		t.Errorf("Expected store error, got %+v %v", client, err)
+	}
+}
+
+// missingTableDriver answer every query with MySQL "table doesn't exist"
+type missingTableDriver struct{}
+
+type missingTableConn struct{}
+
+func init() {
+	sql.Register("missing_table", missingTableDriver{})
+}
+
+func (missingTableDriver) Open(name string) (driver.Conn, error) { return missingTableConn{}, nil }
+
+func (missingTableConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, &mysql.MySQLError{Number: 1146, Message: "Table 'db_todo.clients' doesn't exist"}
+}
+func (missingTableConn) Close() error              { return nil }
+func (missingTableConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func TestChainMissingTable(t *testing.T) {
+	db, err := sqlx.Open("missing_table", "")
+	if err != nil {
+		t.Fatalf("open fake database: %v", err)
+	}
+	defer db.Close()
+
+	// database created before clients migration still accept client on config
+	chain := Chain{
+		NewDBStore(db, nil),
+		NewMemoryStore(&Client{Key: "a", Secret: "config", Status: StatusActive}),
+	}
+
+	if client, err := chain.Get(context.Background(), "a"); err != nil || client.Secret != "config" {
+		t.Errorf("Expected fallback to client on config, got %+v %v", client, err)
+	}
+}
@@ -0,0 +1,339 @@
+package clients
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/encryption"
+	"github.com/arthben/http_jwt_crud/pkg/httpsig"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrInvalidPublicKey       = errors.New("public key must be PEM encoded RSA or ECDSA public key")
+	ErrInvalidSignatureMethod = errors.New("signature method must be hmac or asymmetric")
+	ErrPublicKeyRequired      = errors.New("asymmetric signature method require public key")
+	ErrInvalidComponents      = errors.New("signature components must be derived component or lowercase header name")
+	ErrInvalidTLSAuth         = errors.New("tls auth must be none, certificate or both")
+	ErrInvalidFingerprint     = errors.New("certificate fingerprint must be hex of sha256")
+	ErrCertificateRequired    = errors.New("tls auth require certificate fingerprint or subject")
+	ErrInvalidScope           = errors.New("scope must be one of " + DefaultScopes)
+)
+
+// Manager create and update client on clients table.
+// Generated secret is returned once by Create and RotateSecret, other methods never return the secret
+type Manager struct {
+	db      *sqlx.DB
+	keyring *encryption.Keyring
+}
+
+func NewManager(db *sqlx.DB, cfg *config.EnvParams) *Manager {
+	return &Manager{db: db, keyring: NewKeyring(cfg)}
+}
+
+// Create register new active client with generated key and secret. Scopes must be known, see DefaultScopes.
+// Public key is optional, it can be uploaded later with SetPublicKey.
+// Empty signatureMethod is SignatureHMAC, SignatureAsymmetric require public key
+func (m *Manager) Create(ctx context.Context, scopes string, publicKey string, signatureMethod string) (*Client, error) {
+	if err := validateScopes(scopes); err != nil {
+		return nil, err
+	}
+
+	if publicKey != "" {
+		if err := ValidatePublicKey(publicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if signatureMethod == "" {
+		signatureMethod = SignatureHMAC
+	}
+	if err := validateSignatureMethod(signatureMethod, publicKey); err != nil {
+		return nil, err
+	}
+
+	key, err := generateRandom(16)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateRandom(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	tb := &dbs.TableClients{
+		ClientKey:       key,
+		PublicKey:       publicKey,
+		Status:          StatusActive,
+		Scopes:          scopes,
+		SignatureMethod: signatureMethod,
+		TLSAuth:         TLSAuthNone,
+		CreatedDate:     now,
+		UpdatedDate:     now,
+	}
+	if err := sealSecret(m.keyring, tb, secret); err != nil {
+		return nil, err
+	}
+
+	if err := dbs.AddClient(m.db, ctx, tb); err != nil {
+		return nil, err
+	}
+
+	client := toClient(tb)
+	client.Secret = secret
+	return client, nil
+}
+
+func (m *Manager) List(ctx context.Context) ([]*Client, error) {
+	tbs, err := dbs.ListClients(m.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*Client, 0, len(tbs))
+	for _, tb := range tbs {
+		resp = append(resp, toClient(tb))
+	}
+	return resp, nil
+}
+
+// SetStatus enable (StatusActive) or disable (StatusDisabled) client
+func (m *Manager) SetStatus(ctx context.Context, clientKey string, status string) (*Client, error) {
+	return m.update(ctx, clientKey, func(tb *dbs.TableClients) error {
+		tb.Status = status
+		return nil
+	})
+}
+
+// RotateSecret replace HMAC secret of client with generated one
+func (m *Manager) RotateSecret(ctx context.Context, clientKey string) (*Client, error) {
+	secret, err := generateRandom(32)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := m.update(ctx, clientKey, func(tb *dbs.TableClients) error {
+		return sealSecret(m.keyring, tb, secret)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client.Secret = secret
+	return client, nil
+}
+
+// SetPublicKey replace public key of client which used to verify access token request
+func (m *Manager) SetPublicKey(ctx context.Context, clientKey string, publicKey string) (*Client, error) {
+	if err := ValidatePublicKey(publicKey); err != nil {
+		return nil, err
+	}
+
+	return m.update(ctx, clientKey, func(tb *dbs.TableClients) error {
+		tb.PublicKey = publicKey
+		return nil
+	})
+}
+
+// SetSignatureMethod switch service signature of client between SignatureHMAC and SignatureAsymmetric
+func (m *Manager) SetSignatureMethod(ctx context.Context, clientKey string, signatureMethod string) (*Client, error) {
+	return m.update(ctx, clientKey, func(tb *dbs.TableClients) error {
+		if err := validateSignatureMethod(signatureMethod, tb.PublicKey); err != nil {
+			return err
+		}
+		tb.SignatureMethod = signatureMethod
+		return nil
+	})
+}
+
+// SetSignatureComponents replace components which message signature of client must cover.
+// Empty components reset to DefaultSignatureComponents
+func (m *Manager) SetSignatureComponents(ctx context.Context, clientKey string, components string) (*Client, error) {
+	for _, component := range strings.Fields(components) {
+		if !httpsig.ValidComponent(component) {
+			return nil, ErrInvalidComponents
+		}
+	}
+
+	return m.update(ctx, clientKey, func(tb *dbs.TableClients) error {
+		tb.SignatureComponents = strings.Join(strings.Fields(components), " ")
+		return nil
+	})
+}
+
+// SetCertificate map client certificate (fingerprint and / or subject) to client and set
+// whether token endpoint authenticate client by the certificate
+func (m *Manager) SetCertificate(ctx context.Context, clientKey string, tlsAuth string, fingerprint string, subject string) (*Client, error) {
+	if tlsAuth == "" {
+		tlsAuth = TLSAuthNone
+	}
+
+	fingerprint = NormalizeFingerprint(fingerprint)
+	if err := ValidateCertificate(tlsAuth, fingerprint, subject); err != nil {
+		return nil, err
+	}
+
+	return m.update(ctx, clientKey, func(tb *dbs.TableClients) error {
+		tb.TLSAuth = tlsAuth
+		tb.CertificateFingerprint = fingerprint
+		tb.CertificateSubject = strings.TrimSpace(subject)
+		return nil
+	})
+}
+
+// Reencrypt wrap secret of every client which not using active master key, including plaintext secret.
+// Used after master key rotation along with todos. Return number of re-encrypted clients
+func (m *Manager) Reencrypt(ctx context.Context, logger *slog.Logger) (int, error) {
+	if m.keyring == nil {
+		return 0, ErrEncryptionNotConfigured
+	}
+
+	tbs, err := dbs.ListClients(m.db, ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	for _, tb := range tbs {
+		if tb.KeyID == m.keyring.ActiveKeyID() {
+			continue
+		}
+
+		// secret encrypted by removed master key can not be recovered, skip it
+		secret, err := openSecret(m.keyring, tb)
+		if err != nil {
+			logger.Error("Reencrypt Client", slog.String("clientKey", tb.ClientKey), slog.String("key_id", tb.KeyID), slog.String("error", err.Error()))
+			continue
+		}
+
+		if err := sealSecret(m.keyring, tb, secret); err != nil {
+			return total, err
+		}
+		tb.UpdatedDate = time.Now().UTC().Truncate(time.Second)
+
+		if err := dbs.UpdateClient(m.db, ctx, tb); err != nil {
+			return total, err
+		}
+		total++
+	}
+
+	return total, nil
+}
+
+// update apply change on client while its row is locked, see dbs.ChangeClient
+func (m *Manager) update(ctx context.Context, clientKey string, change func(tb *dbs.TableClients) error) (*Client, error) {
+	tb, err := dbs.ChangeClient(m.db, ctx, clientKey, func(tb *dbs.TableClients) error {
+		if err := change(tb); err != nil {
+			return err
+		}
+		tb.UpdatedDate = time.Now().UTC().Truncate(time.Second)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if tb == nil {
+		return nil, ErrNotFound
+	}
+
+	return toClient(tb), nil
+}
+
+// ValidatePublicKey check publicKey is PEM encoded public key which supported for signature
+func ValidatePublicKey(publicKey string) error {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return ErrInvalidPublicKey
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return ErrInvalidPublicKey
+	}
+
+	switch parsed.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return nil
+	default:
+		return ErrInvalidPublicKey
+	}
+}
+
+// NormalizeFingerprint lowercase fingerprint and remove colon separator, ex: from openssl x509 -fingerprint -sha256
+func NormalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+}
+
+// ValidateCertificate check tls auth and normalized fingerprint of client certificate
+func ValidateCertificate(tlsAuth string, fingerprint string, subject string) error {
+	switch tlsAuth {
+	case TLSAuthNone, TLSAuthCertificate, TLSAuthBoth:
+	default:
+		return ErrInvalidTLSAuth
+	}
+
+	if fingerprint != "" {
+		if _, err := hex.DecodeString(fingerprint); err != nil || len(fingerprint) != 64 {
+			return ErrInvalidFingerprint
+		}
+	}
+
+	if tlsAuth != TLSAuthNone && fingerprint == "" && strings.TrimSpace(subject) == "" {
+		return ErrCertificateRequired
+	}
+	return nil
+}
+
+// validateScopes check every space separated scope is known
+func validateScopes(scopes string) error {
+	known := strings.Fields(DefaultScopes)
+	for _, scope := range strings.Fields(scopes) {
+		if !slices.Contains(known, scope) {
+			return ErrInvalidScope
+		}
+	}
+	return nil
+}
+
+func validateSignatureMethod(signatureMethod string, publicKey string) error {
+	switch signatureMethod {
+	case SignatureHMAC:
+		return nil
+	case SignatureAsymmetric:
+		if publicKey == "" {
+			return ErrPublicKeyRequired
+		}
+		return nil
+	default:
+		return ErrInvalidSignatureMethod
+	}
+}
+
+// toClient convert table to client without secret
+func toClient(tb *dbs.TableClients) *Client {
+	return &Client{
+		Key:                    tb.ClientKey,
+		PublicKey:              tb.PublicKey,
+		Status:                 tb.Status,
+		Scopes:                 tb.Scopes,
+		SignatureMethod:        tb.SignatureMethod,
+		SignatureComponents:    tb.SignatureComponents,
+		TLSAuth:                tb.TLSAuth,
+		CertificateFingerprint: tb.CertificateFingerprint,
+		CertificateSubject:     tb.CertificateSubject,
+	}
+}
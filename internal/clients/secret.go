@@ -0,0 +1,69 @@
+package clients
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/encryption"
+)
+
+var ErrEncryptionNotConfigured = errors.New("encryption master key is not configured")
+
+// NewKeyring return keyring of encryption master keys, nil when encryption is not configured
+func NewKeyring(cfg *config.EnvParams) *encryption.Keyring {
+	if len(cfg.Encryption.Keys) == 0 {
+		return nil
+	}
+	return encryption.NewKeyring(cfg.Encryption.Keys, cfg.Encryption.ActiveKey)
+}
+
+// sealSecret encrypt HMAC secret of client. Secret must be recoverable to verify HMAC,
+// so it is encrypted instead of hashed
+func sealSecret(keyring *encryption.Keyring, tb *dbs.TableClients, secret string) error {
+	if keyring == nil {
+		return ErrEncryptionNotConfigured
+	}
+
+	dataKey, err := keyring.NewDataKey()
+	if err != nil {
+		return err
+	}
+
+	if tb.Secret, err = dataKey.Encrypt(secret, tb.ClientKey+":secret"); err != nil {
+		return err
+	}
+
+	tb.KeyID = dataKey.KeyID
+	tb.DataKey = dataKey.Wrapped
+	return nil
+}
+
+// openSecret decrypt HMAC secret of client. Secret without key ID is stored as plaintext
+func openSecret(keyring *encryption.Keyring, tb *dbs.TableClients) (string, error) {
+	if tb.KeyID == "" {
+		return tb.Secret, nil
+	}
+
+	if keyring == nil {
+		return "", ErrEncryptionNotConfigured
+	}
+
+	dataKey, err := keyring.OpenDataKey(tb.KeyID, tb.DataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return dataKey.Decrypt(tb.Secret, tb.ClientKey+":secret")
+}
+
+// generateRandom return hex of n random bytes
+func generateRandom(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
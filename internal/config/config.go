@@ -1,13 +1,33 @@
 package config
 
 import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"net/netip"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/arthben/http_jwt_crud/internal/signing"
+	"github.com/arthben/http_jwt_crud/pkg/httpsig"
+	"github.com/go-sql-driver/mysql"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
+// DefaultKid is kid of the legacy Server PublicKey / PrivateKey pair
+const DefaultKid = "default"
+
+// SigningAlgorithms is JWT algorithm which can be set per signing key
+var SigningAlgorithms = []string{
+	"RS256", "RS384", "RS512", "PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512", "EdDSA",
+}
+
 func LoadConfig() (cfg EnvParams, err error) {
 	viper.AddConfigPath("configs")
 	viper.SetConfigName("development")
@@ -64,29 +84,122 @@ func LoadConfig() (cfg EnvParams, err error) {
 		return
 	}
 
-	if len(cfg.Server.PublicKey) == 0 {
-		err = errors.New("Parameter Server Public Key is empty")
+	if len(cfg.Token.Audience) == 0 {
+		cfg.Token.Audience = cfg.Token.Issuer
+	}
+
+	if err = optionalNumber(&cfg.Token.RefreshExpire, "604800", "Token RefreshExpire"); err != nil {
 		return
 	}
 
-	rawSrvPub, err := os.ReadFile(cfg.Server.PublicKey)
-	if err != nil {
-		err = errors.New("Parameter Server Public Key not valid file")
+	if refreshExpire, _ := strconv.Atoi(cfg.Token.RefreshExpire); refreshExpire < 0 {
+		err = errors.New("Parameter Token RefreshExpire invalid value")
 		return
 	}
-	cfg.Server.PublicKey = string(rawSrvPub)
 
-	if len(cfg.Server.PrivateKey) == 0 {
-		err = errors.New("Parameter Server Private Key is empty")
+	// legacy single key pair, registered as signing key "default"
+	cfg.Server.Keys = map[string][]byte{}
+	cfg.Server.Algorithms = map[string]string{}
+	if len(cfg.Server.PublicKey) > 0 || len(cfg.Server.PrivateKey) > 0 {
+		if len(cfg.Server.PublicKey) == 0 {
+			err = errors.New("Parameter Server Public Key is empty")
+			return
+		}
+
+		rawSrvPub, errRead := os.ReadFile(cfg.Server.PublicKey)
+		if errRead != nil {
+			err = errors.New("Parameter Server Public Key not valid file")
+			return
+		}
+		cfg.Server.PublicKey = string(rawSrvPub)
+
+		if len(cfg.Server.PrivateKey) == 0 {
+			err = errors.New("Parameter Server Private Key is empty")
+			return
+		}
+
+		rawSrvPri, errRead := os.ReadFile(cfg.Server.PrivateKey)
+		if errRead != nil {
+			err = errors.New("Parameter Server Private Key not valid file")
+			return
+		}
+		cfg.Server.PrivateKey = string(rawSrvPri)
+
+		if _, errKey := signing.ParseKey(rawSrvPri, ""); errKey != nil {
+			err = errors.New("Parameter Server Private Key invalid key: " + errKey.Error())
+			return
+		}
+		cfg.Server.Keys[DefaultKid] = rawSrvPri
+	}
+
+	for _, entry := range strings.Split(cfg.Server.SigningKeys, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || len(kid) == 0 || len(path) == 0 {
+			err = errors.New("Parameter Server SigningKeys invalid value")
+			return
+		}
+
+		// optional algorithm suffix, ex: kid=path/to/key.pem@PS256
+		if at := strings.LastIndex(path, "@"); at > 0 {
+			alg := path[at+1:]
+			if !slices.Contains(SigningAlgorithms, alg) {
+				err = errors.New("Parameter Server SigningKeys unsupported algorithm " + alg)
+				return
+			}
+			cfg.Server.Algorithms[kid] = alg
+			path = path[:at]
+		}
+
+		rawKey, errRead := os.ReadFile(path)
+		if errRead != nil {
+			err = errors.New("Parameter Server SigningKeys not valid file")
+			return
+		}
+
+		// algorithm must match the key type, ex: PS256 on EC key fail startup
+		if _, errKey := signing.ParseKey(rawKey, cfg.Server.Algorithms[kid]); errKey != nil {
+			err = errors.New("Parameter Server SigningKeys invalid key " + kid + ": " + errKey.Error())
+			return
+		}
+		cfg.Server.Keys[kid] = rawKey
+	}
+
+	if len(cfg.Server.Keys) == 0 {
+		err = errors.New("Parameter Server SigningKeys is empty")
 		return
 	}
 
-	rawSrvPri, err := os.ReadFile(cfg.Server.PrivateKey)
-	if err != nil {
-		err = errors.New("Parameter Server Private Key not valid file")
+	if len(cfg.Server.ActiveKid) == 0 {
+		cfg.Server.ActiveKid = DefaultKid
+	}
+
+	// active key sign new token, so it must be a private key
+	activeKey, ok := cfg.Server.Keys[cfg.Server.ActiveKid]
+	if !ok {
+		err = errors.New("Parameter Server ActiveKid not found on SigningKeys")
+		return
+	}
+
+	if key, _ := signing.ParseKey(activeKey, cfg.Server.Algorithms[cfg.Server.ActiveKid]); key.Private == nil {
+		err = errors.New("Parameter Server ActiveKid must be a private key")
+		return
+	}
+
+	for _, kid := range strings.Split(cfg.Server.RetiredKids, ",") {
+		if strings.TrimSpace(kid) == cfg.Server.ActiveKid {
+			err = errors.New("Parameter Server RetiredKids must not contain ActiveKid")
+			return
+		}
+	}
+
+	if cfg.Server.Proxies, err = parsePrefixes(cfg.Server.TrustedProxies); err != nil {
+		err = errors.New("Parameter Server TrustedProxies invalid IP or CIDR " + err.Error())
 		return
 	}
-	cfg.Server.PrivateKey = string(rawSrvPri)
 
 	if len(cfg.DB.Host) == 0 {
 		err = errors.New("Parameter DB Host is empty")
@@ -108,7 +221,7 @@ func LoadConfig() (cfg EnvParams, err error) {
 		return
 	}
 
-	if _, err = strconv.Atoi(cfg.DB.MinPool); err != nil {
+	if n, convErr := strconv.Atoi(cfg.DB.MinPool); convErr != nil || n < 0 {
 		err = errors.New("Parameter DB MinPool invalid value")
 		return
 	}
@@ -118,32 +231,393 @@ func LoadConfig() (cfg EnvParams, err error) {
 		return
 	}
 
-	if _, err = strconv.Atoi(cfg.DB.MaxPool); err != nil {
+	if n, convErr := strconv.Atoi(cfg.DB.MaxPool); convErr != nil || n < 0 {
 		err = errors.New("Parameter DB MaxPool invalid value")
 		return
 	}
 
-	if len(cfg.Client.Key) == 0 {
-		err = errors.New("Parameter Client Key is empty")
+	if err = optionalNumber(&cfg.DB.ConnMaxLifetime, "0", "DB ConnMaxLifetime"); err != nil {
 		return
 	}
 
-	if len(cfg.Client.Secret) == 0 {
-		err = errors.New("Parameter Client Secret is empty")
+	if err = optionalNumber(&cfg.DB.ConnMaxIdleTime, "0", "DB ConnMaxIdleTime"); err != nil {
 		return
 	}
 
-	if len(cfg.Client.PublicKey) == 0 {
-		err = errors.New("Parameter Client Public Key is empty")
+	if err = optionalNumber(&cfg.DB.ConnectRetry, "5", "DB ConnectRetry"); err != nil {
 		return
 	}
 
-	rawSrvPubClient, err := os.ReadFile(cfg.Client.PublicKey)
-	if err != nil {
-		err = errors.New("Parameter Client Public Key not valid file")
+	if attempts, _ := strconv.Atoi(cfg.DB.ConnectRetry); attempts <= 0 {
+		err = errors.New("Parameter DB ConnectRetry must be greater than 0")
+		return
+	}
+
+	if err = optionalNumber(&cfg.DB.RetryInterval, "1", "DB RetryInterval"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.DB.RetryMaxInterval, "30", "DB RetryMaxInterval"); err != nil {
+		return
+	}
+
+	if err = optionalBool(&cfg.DB.DegradedStart, "DB DegradedStart"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.DB.HealthCheckInterval, "10", "DB HealthCheckInterval"); err != nil {
+		return
+	}
+
+	if interval, _ := strconv.Atoi(cfg.DB.HealthCheckInterval); interval <= 0 {
+		err = errors.New("Parameter DB HealthCheckInterval invalid value")
+		return
+	}
+
+	for _, dsn := range strings.Split(cfg.DB.Replicas, ",") {
+		if dsn = strings.TrimSpace(dsn); dsn == "" {
+			continue
+		}
+		if _, err = mysql.ParseDSN(dsn); err != nil {
+			err = errors.New("Parameter DB Replicas invalid DSN")
+			return
+		}
+	}
+
+	if err = optionalNumber(&cfg.DB.ReplicaCheckInterval, "10", "DB ReplicaCheckInterval"); err != nil {
+		return
+	}
+
+	if interval, _ := strconv.Atoi(cfg.DB.ReplicaCheckInterval); interval <= 0 {
+		err = errors.New("Parameter DB ReplicaCheckInterval invalid value")
 		return
 	}
-	cfg.Client.PublicKey = string(rawSrvPubClient)
+
+	if err = optionalNumber(&cfg.DB.ReadYourWritesWindow, "5", "DB ReadYourWritesWindow"); err != nil {
+		return
+	}
+
+	if err = optionalBool(&cfg.Cache.Enabled, "Cache Enabled"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.Cache.TTL, "30", "Cache TTL"); err != nil {
+		return
+	}
+
+	if ttl, _ := strconv.Atoi(cfg.Cache.TTL); ttl <= 0 {
+		err = errors.New("Parameter Cache TTL must be greater than 0")
+		return
+	}
+
+	if err = optionalNumber(&cfg.Cache.Size, "1000", "Cache Size"); err != nil {
+		return
+	}
+
+	// master key file contain base64 of 32 bytes key. ex: openssl rand -base64 32
+	cfg.Encryption.Keys = map[string][]byte{}
+	for _, entry := range strings.Split(cfg.Encryption.MasterKeys, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		kid, path, ok := strings.Cut(entry, "=")
+		if !ok || len(kid) == 0 || len(path) == 0 {
+			err = errors.New("Parameter Encryption MasterKeys invalid value")
+			return
+		}
+
+		rawKey, errRead := os.ReadFile(path)
+		if errRead != nil {
+			err = errors.New("Parameter Encryption MasterKeys not valid file")
+			return
+		}
+
+		key, errDecode := base64.StdEncoding.DecodeString(strings.TrimSpace(string(rawKey)))
+		if errDecode != nil || len(key) != 32 {
+			err = errors.New("Parameter Encryption MasterKeys must be base64 of 32 bytes key")
+			return
+		}
+		cfg.Encryption.Keys[kid] = key
+	}
+
+	if len(cfg.Encryption.Keys) > 0 {
+		if _, ok := cfg.Encryption.Keys[cfg.Encryption.ActiveKey]; !ok {
+			err = errors.New("Parameter Encryption ActiveKey not found on MasterKeys")
+			return
+		}
+	}
+
+	if err = optionalBool(&cfg.Encryption.EncryptTitle, "Encryption EncryptTitle"); err != nil {
+		return
+	}
+
+	if err = optionalBool(&cfg.Archive.Enabled, "Archive Enabled"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.Archive.AfterDays, "30", "Archive AfterDays"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.Archive.BatchSize, "500", "Archive BatchSize"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.Archive.Interval, "3600", "Archive Interval"); err != nil {
+		return
+	}
+
+	if interval, _ := strconv.Atoi(cfg.Archive.Interval); interval <= 0 {
+		err = errors.New("Parameter Archive Interval invalid value")
+		return
+	}
+
+	if batch, _ := strconv.Atoi(cfg.Archive.BatchSize); batch <= 0 {
+		err = errors.New("Parameter Archive BatchSize invalid value")
+		return
+	}
+
+	if err = optionalNumber(&cfg.Security.TimestampSkew, "300", "Security TimestampSkew"); err != nil {
+		return
+	}
+
+	if skew, _ := strconv.Atoi(cfg.Security.TimestampSkew); skew <= 0 {
+		err = errors.New("Parameter Security TimestampSkew invalid value")
+		return
+	}
+
+	switch cfg.Security.NonceStore {
+	case "":
+		cfg.Security.NonceStore = "memory"
+	case "memory", "database":
+	default:
+		err = errors.New("Parameter Security NonceStore must be memory or database")
+		return
+	}
+
+	switch cfg.Revocation.Store {
+	case "":
+		cfg.Revocation.Store = "memory"
+	case "memory", "database":
+	default:
+		err = errors.New("Parameter Revocation Store must be memory or database")
+		return
+	}
+
+	if len(cfg.RateLimit.Enabled) == 0 {
+		cfg.RateLimit.Enabled = "true"
+	}
+
+	if err = optionalBool(&cfg.RateLimit.Enabled, "RateLimit Enabled"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.RateLimit.Rate, "10", "RateLimit Rate"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.RateLimit.Burst, "20", "RateLimit Burst"); err != nil {
+		return
+	}
+
+	rate, _ := strconv.Atoi(cfg.RateLimit.Rate)
+	burst, _ := strconv.Atoi(cfg.RateLimit.Burst)
+	if rate <= 0 || burst <= 0 {
+		err = errors.New("Parameter RateLimit Rate and Burst must be greater than 0")
+		return
+	}
+	cfg.RateLimit.Default = RateRule{Rate: rate, Burst: burst}
+
+	if err = optionalNumber(&cfg.RateLimit.IPRate, "50", "RateLimit IPRate"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.RateLimit.IPBurst, "100", "RateLimit IPBurst"); err != nil {
+		return
+	}
+
+	rate, _ = strconv.Atoi(cfg.RateLimit.IPRate)
+	burst, _ = strconv.Atoi(cfg.RateLimit.IPBurst)
+	if rate <= 0 || burst <= 0 {
+		err = errors.New("Parameter RateLimit IPRate and IPBurst must be greater than 0")
+		return
+	}
+	cfg.RateLimit.IP = RateRule{Rate: rate, Burst: burst}
+
+	if err = optionalNumber(&cfg.RateLimit.MaxBuckets, "100000", "RateLimit MaxBuckets"); err != nil {
+		return
+	}
+
+	if maxBuckets, _ := strconv.Atoi(cfg.RateLimit.MaxBuckets); maxBuckets <= 0 {
+		err = errors.New("Parameter RateLimit MaxBuckets must be greater than 0")
+		return
+	}
+
+	if cfg.RateLimit.ClientRules, err = parseRateRules(cfg.RateLimit.Clients, "RateLimit Clients"); err != nil {
+		return
+	}
+
+	if cfg.RateLimit.RouteRules, err = parseRateRules(cfg.RateLimit.Routes, "RateLimit Routes"); err != nil {
+		return
+	}
+
+	if (len(cfg.TLS.CertFile) > 0) != (len(cfg.TLS.KeyFile) > 0) {
+		err = errors.New("Parameter TLS CertFile and KeyFile must be set together")
+		return
+	}
+
+	if len(cfg.TLS.ClientCA) > 0 {
+		if len(cfg.TLS.CertFile) == 0 {
+			err = errors.New("Parameter TLS ClientCA require TLS CertFile and KeyFile")
+			return
+		}
+
+		rawCA, errRead := os.ReadFile(cfg.TLS.ClientCA)
+		if errRead != nil {
+			err = errors.New("Parameter TLS ClientCA not valid file")
+			return
+		}
+
+		cfg.TLS.ClientCAs = x509.NewCertPool()
+		if !cfg.TLS.ClientCAs.AppendCertsFromPEM(rawCA) {
+			err = errors.New("Parameter TLS ClientCA has no PEM certificate")
+			return
+		}
+	}
+
+	switch cfg.TLS.ClientAuth {
+	case "":
+		cfg.TLS.ClientAuth = "none"
+		if cfg.TLS.ClientCAs != nil {
+			cfg.TLS.ClientAuth = "optional"
+		}
+	case "none":
+	case "optional", "require":
+		if cfg.TLS.ClientCAs == nil {
+			err = errors.New("Parameter TLS ClientAuth " + cfg.TLS.ClientAuth + " require TLS ClientCA")
+			return
+		}
+	default:
+		err = errors.New("Parameter TLS ClientAuth must be none, optional or require")
+		return
+	}
+
+	if err = optionalNumber(&cfg.Lockout.MaxFailures, "5", "Lockout MaxFailures"); err != nil {
+		return
+	}
+
+	if n, _ := strconv.Atoi(cfg.Lockout.MaxFailures); n <= 0 {
+		err = errors.New("Parameter Lockout MaxFailures must be greater than 0")
+		return
+	}
+
+	if err = optionalNumber(&cfg.Lockout.Window, "900", "Lockout Window"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.Lockout.Cooldown, "60", "Lockout Cooldown"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.Lockout.MaxCooldown, "3600", "Lockout MaxCooldown"); err != nil {
+		return
+	}
+
+	window, _ := strconv.Atoi(cfg.Lockout.Window)
+	cooldown, _ := strconv.Atoi(cfg.Lockout.Cooldown)
+	maxCooldown, _ := strconv.Atoi(cfg.Lockout.MaxCooldown)
+	if window <= 0 || cooldown <= 0 || maxCooldown < cooldown {
+		err = errors.New("Parameter Lockout Window and Cooldown must be greater than 0, MaxCooldown not less than Cooldown")
+		return
+	}
+
+	switch cfg.Lockout.Store {
+	case "":
+		cfg.Lockout.Store = "memory"
+	case "memory", "database":
+	default:
+		err = errors.New("Parameter Lockout Store must be memory or database")
+		return
+	}
+
+	// admin API is disabled when token hash is empty
+	if len(cfg.Admin.TokenHash) > 0 {
+		if _, errHex := hex.DecodeString(cfg.Admin.TokenHash); errHex != nil || len(cfg.Admin.TokenHash) != 64 {
+			err = errors.New("Parameter Admin TokenHash must be hex of sha256")
+			return
+		}
+	}
+
+	// single client on config is optional, clients are registered on database or clients file
+	if len(cfg.Client.Key) > 0 {
+		if len(cfg.Client.Secret) == 0 {
+			err = errors.New("Parameter Client Secret is empty")
+			return
+		}
+
+		if len(cfg.Client.PublicKey) == 0 {
+			err = errors.New("Parameter Client Public Key is empty")
+			return
+		}
+
+		rawSrvPubClient, errRead := os.ReadFile(cfg.Client.PublicKey)
+		if errRead != nil {
+			err = errors.New("Parameter Client Public Key not valid file")
+			return
+		}
+		cfg.Client.PublicKey = string(rawSrvPubClient)
+
+		if err = optionalSignatureMethod(&cfg.Client.SignatureMethod, "Client SignatureMethod"); err != nil {
+			return
+		}
+
+		if err = checkComponents(cfg.Client.SignatureComponents, "Client SignatureComponents"); err != nil {
+			return
+		}
+
+		if err = checkCertificate(&cfg.Client.TLSAuth, &cfg.Client.CertificateFingerprint, cfg.Client.CertificateSubject, "Client"); err != nil {
+			return
+		}
+	}
+
+	if len(cfg.Clients.Database) == 0 {
+		cfg.Clients.Database = "true"
+	}
+
+	if err = optionalBool(&cfg.Clients.Database, "Clients Database"); err != nil {
+		return
+	}
+
+	if len(cfg.Clients.File) > 0 {
+		if cfg.Clients.Registered, err = loadClientsFile(cfg.Clients.File); err != nil {
+			return
+		}
+	}
+
+	if err = optionalNumber(&cfg.TrustedIssuers.RefreshInterval, "3600", "TrustedIssuers RefreshInterval"); err != nil {
+		return
+	}
+
+	if err = optionalNumber(&cfg.TrustedIssuers.MinRefetch, "30", "TrustedIssuers MinRefetch"); err != nil {
+		return
+	}
+
+	if interval, _ := strconv.Atoi(cfg.TrustedIssuers.RefreshInterval); interval <= 0 {
+		err = errors.New("Parameter TrustedIssuers RefreshInterval must be greater than 0")
+		return
+	}
+
+	if minRefetch, _ := strconv.Atoi(cfg.TrustedIssuers.MinRefetch); minRefetch <= 0 {
+		err = errors.New("Parameter TrustedIssuers MinRefetch must be greater than 0")
+		return
+	}
+
+	if len(cfg.TrustedIssuers.File) > 0 {
+		if cfg.TrustedIssuers.Issuers, err = loadTrustedIssuers(cfg.TrustedIssuers.File, cfg.Token.Issuer); err != nil {
+			return
+		}
+	}
 
 	return
 }
@@ -152,13 +626,45 @@ type EnvParams struct {
 	Port          string `yaml:"port"`
 	ServerTimeout string `yaml:"serverTimeout"`
 	AppMode       string `yaml:"appMode"`
-	Token         struct {
+	// optional, serve HTTPS. Client certificate (mTLS) is verified with ClientCA
+	TLS struct {
+		// server certificate and private key (PEM), TLS is enabled when both are set
+		CertFile string `yaml:"certFile"`
+		KeyFile  string `yaml:"keyFile"`
+		// CA bundle (PEM) which client certificate must be issued by
+		ClientCA string `yaml:"clientCA"`
+		// none, optional (verify certificate when sent) or require. Default optional when ClientCA is set
+		ClientAuth string         `yaml:"clientAuth"`
+		ClientCAs  *x509.CertPool `mapstructure:"-"`
+	} `yaml:"tls"`
+	Token struct {
 		Expire string `yaml:"expire"`
 		Issuer string `yaml:"issuer"`
+		// aud claim of access token, default is Issuer
+		Audience string `yaml:"audience"`
+		// refresh token lifetime in seconds, 0 disable refresh token
+		RefreshExpire string `yaml:"refreshExpire"`
 	} `yaml:"token"`
 	Server struct {
+		// legacy key pair, registered as signing key "default"
 		PublicKey  string `yaml:"publicKey"`
 		PrivateKey string `yaml:"privateKey"`
+		// comma separated signing key, format: kid=path/to/key.pem[@ALG].
+		// Key may be private key or public key which only used to verify token.
+		// Default algorithm follow key type: RSA RS256, EC ES256/ES384/ES512, Ed25519 EdDSA
+		SigningKeys string `yaml:"signingKeys"`
+		// kid of private key which sign new token
+		ActiveKid string `yaml:"activeKid"`
+		// comma separated kid, token signed by retired key is rejected
+		RetiredKids string `yaml:"retiredKids"`
+		// PEM of signing keys by kid
+		Keys map[string][]byte `mapstructure:"-"`
+		// algorithm by kid, empty follow key type
+		Algorithms map[string]string `mapstructure:"-"`
+		// comma separated IP or CIDR of load balancer / reverse proxy. Source IP of request
+		// from trusted proxy is taken from X-Forwarded-For
+		TrustedProxies string         `yaml:"trustedProxies"`
+		Proxies        []netip.Prefix `mapstructure:"-"`
 	} `yaml:"server"`
 	DB struct {
 		Host     string `yaml:"host"`
@@ -167,10 +673,388 @@ type EnvParams struct {
 		Name     string `yaml:"name"`
 		MinPool  string `yaml:"minPool"`
 		MaxPool  string `yaml:"maxPool"`
+		// lifetime & idle time of pooled connection in seconds. 0 means no limit
+		ConnMaxLifetime string `yaml:"connMaxLifetime"`
+		ConnMaxIdleTime string `yaml:"connMaxIdleTime"`
+		// connect attempts at startup, backoff doubled from RetryInterval up to RetryMaxInterval
+		ConnectRetry     string `yaml:"connectRetry"`
+		RetryInterval    string `yaml:"retryInterval"`
+		RetryMaxInterval string `yaml:"retryMaxInterval"`
+		// when true, server start without database and reconnect in background
+		DegradedStart string `yaml:"degradedStart"`
+		// seconds between ping of primary, readiness follow the last ping
+		HealthCheckInterval string `yaml:"healthCheckInterval"`
+		// comma separated DSN of read replica
+		Replicas             string `yaml:"replicas"`
+		ReplicaCheckInterval string `yaml:"replicaCheckInterval"`
+		// seconds after write which client read is pinned to primary
+		ReadYourWritesWindow string `yaml:"readYourWritesWindow"`
 	} `yaml:"db"`
+	Cache struct {
+		Enabled string `yaml:"enabled"`
+		// entry lifetime in seconds
+		TTL string `yaml:"ttl"`
+		// max entries of in-process cache
+		Size string `yaml:"size"`
+	} `yaml:"cache"`
+	Encryption struct {
+		// comma separated master key, format: keyID=path/to/key
+		MasterKeys   string `yaml:"masterKeys"`
+		ActiveKey    string `yaml:"activeKey"`
+		EncryptTitle string `yaml:"encryptTitle"`
+		// decoded master keys by key ID
+		Keys map[string][]byte `mapstructure:"-"`
+	} `yaml:"encryption"`
+	Archive struct {
+		Enabled string `yaml:"enabled"`
+		// todo completed more than AfterDays ago is moved to todos_archive
+		AfterDays string `yaml:"afterDays"`
+		BatchSize string `yaml:"batchSize"`
+		// seconds between archive run
+		Interval string `yaml:"interval"`
+	} `yaml:"archive"`
+	Security struct {
+		// seconds of allowed difference between X-Timestamp and server time
+		TimestampSkew string `yaml:"timestampSkew"`
+		// store of used request nonce, "memory" or "database".
+		// Use database when running multiple replicas
+		NonceStore string `yaml:"nonceStore"`
+	} `yaml:"security"`
+	Revocation struct {
+		// store of revoked and refresh token, "memory" or "database".
+		// Use database when running multiple replicas
+		Store string `yaml:"store"`
+	} `yaml:"revocation"`
+	RateLimit struct {
+		// token bucket per client, client is X-Client-Key or access token subject
+		Enabled string `yaml:"enabled"`
+		// requests per second and bucket size of each client
+		Rate  string `yaml:"rate"`
+		Burst string `yaml:"burst"`
+		// comma separated limit per client, format: clientKey=rate:burst
+		Clients string `yaml:"clients"`
+		// comma separated limit per route of each client, format: METHOD /path=rate:burst
+		Routes string `yaml:"routes"`
+		// requests per second and bucket size of each source IP, client key is not authenticated
+		// when request is limited, so IP bucket cap the sender of made-up client keys
+		IPRate  string `yaml:"ipRate"`
+		IPBurst string `yaml:"ipBurst"`
+		// buckets kept in memory, client without bucket share one bucket when it is full
+		MaxBuckets  string              `yaml:"maxBuckets"`
+		Default     RateRule            `mapstructure:"-"`
+		IP          RateRule            `mapstructure:"-"`
+		ClientRules map[string]RateRule `mapstructure:"-"`
+		RouteRules  map[string]RateRule `mapstructure:"-"`
+	} `yaml:"rateLimit"`
+	Lockout struct {
+		// failed client authentication before lockout
+		MaxFailures string `yaml:"maxFailures"`
+		// seconds which failures are counted, counter and cooldown level reset after quiet window
+		Window string `yaml:"window"`
+		// seconds of the first lockout, doubled on each following lockout up to MaxCooldown
+		Cooldown    string `yaml:"cooldown"`
+		MaxCooldown string `yaml:"maxCooldown"`
+		// store of failure counter, "memory" or "database".
+		// Use database when running multiple replicas
+		Store string `yaml:"store"`
+	} `yaml:"lockout"`
+	Admin struct {
+		// sha256 hex of admin bearer token. ex: echo -n "token" | sha256sum
+		TokenHash string `yaml:"tokenHash"`
+	} `yaml:"admin"`
 	Client struct {
 		Key       string `yaml:"key"`
 		Secret    string `yaml:"secret"`
 		PublicKey string `yaml:"publicKey"`
+		Scopes    string `yaml:"scopes"`
+		// optional, hmac (default) or asymmetric
+		SignatureMethod string `yaml:"signatureMethod"`
+		// optional, space separated components which message signature must cover
+		SignatureComponents string `yaml:"signatureComponents"`
+		// optional, none (default), certificate or both. Authenticate token request by client certificate
+		TLSAuth string `yaml:"tlsAuth"`
+		// hex SHA-256 (colon allowed) and / or subject DN of client certificate
+		CertificateFingerprint string `yaml:"certificateFingerprint"`
+		CertificateSubject     string `yaml:"certificateSubject"`
 	} `yaml:"client"`
+	Clients struct {
+		// lookup client on clients table
+		Database string `yaml:"database"`
+		// optional yaml file of registered clients, used as fallback of database
+		File       string             `yaml:"file"`
+		Registered []RegisteredClient `mapstructure:"-"`
+	} `yaml:"clients"`
+	TrustedIssuers struct {
+		// optional yaml file of external identity providers which access token is accepted
+		File string `yaml:"file"`
+		// in seconds, background refresh of JWKS
+		RefreshInterval string `yaml:"refreshInterval"`
+		// in seconds, unknown kid fetch JWKS again at most once per MinRefetch
+		MinRefetch string          `yaml:"minRefetch"`
+		Issuers    []TrustedIssuer `mapstructure:"-"`
+	} `yaml:"trustedIssuers"`
+}
+
+// TrustedIssuer is external identity provider. Its token is verified by keys of JWKS URL or local JWKS file
+type TrustedIssuer struct {
+	Issuer   string `yaml:"issuer"`
+	JWKSURL  string `yaml:"jwksUrl"`
+	JWKSFile string `yaml:"jwksFile"`
+	Audience string `yaml:"audience"`
+	// optional, claim names of provider token. Default sub, scope and jti
+	Claims ClaimMapping `yaml:"claims"`
+}
+
+// ClaimMapping map claim of external token to client key, scopes and token ID
+type ClaimMapping struct {
+	ClientID string `yaml:"clientId"`
+	// value may be space separated string or array
+	Scope   string `yaml:"scope"`
+	TokenID string `yaml:"tokenId"`
+}
+
+// RateRule is token bucket refilled with Rate tokens per second, holding up to Burst tokens
+type RateRule struct {
+	Rate  int
+	Burst int
+}
+
+type RegisteredClient struct {
+	Key       string `yaml:"key"`
+	Secret    string `yaml:"secret"`
+	PublicKey string `yaml:"publicKey"`
+	Status    string `yaml:"status"`
+	Scopes    string `yaml:"scopes"`
+	// optional, hmac (default) or asymmetric
+	SignatureMethod string `yaml:"signatureMethod"`
+	// optional, space separated components which message signature must cover
+	SignatureComponents string `yaml:"signatureComponents"`
+	// optional, none (default), certificate or both. Authenticate token request by client certificate
+	TLSAuth string `yaml:"tlsAuth"`
+	// hex SHA-256 (colon allowed) and / or subject DN of client certificate
+	CertificateFingerprint string `yaml:"certificateFingerprint"`
+	CertificateSubject     string `yaml:"certificateSubject"`
+}
+
+// optionalNumber set default value when parameter is empty, otherwise the value must be a non negative number
+func optionalNumber(value *string, defValue string, name string) error {
+	if len(*value) == 0 {
+		*value = defValue
+		return nil
+	}
+
+	if n, err := strconv.Atoi(*value); err != nil || n < 0 {
+		return errors.New("Parameter " + name + " invalid value")
+	}
+
+	return nil
+}
+
+// optionalBool set "false" when parameter is empty, otherwise the value must be "true" or "false"
+func optionalBool(value *string, name string) error {
+	if len(*value) == 0 {
+		*value = "false"
+		return nil
+	}
+
+	b, err := strconv.ParseBool(*value)
+	if err != nil {
+		return errors.New("Parameter " + name + " invalid value")
+	}
+	*value = strconv.FormatBool(b)
+
+	return nil
+}
+
+// loadClientsFile read registered clients. Value may refer OS env, ex: ${PARTNER_SECRET}.
+// publicKey is path of client public key file
+// optionalSignatureMethod set hmac when signature method is empty, otherwise it must be hmac or asymmetric
+func optionalSignatureMethod(value *string, name string) error {
+	switch *value {
+	case "":
+		*value = "hmac"
+	case "hmac", "asymmetric":
+	default:
+		return errors.New("Parameter " + name + " must be hmac or asymmetric")
+	}
+	return nil
+}
+
+// checkCertificate default tlsAuth to none, normalize fingerprint to lowercase hex without colon
+// and make sure client which authenticate by certificate has the certificate mapped
+func checkCertificate(tlsAuth *string, fingerprint *string, subject string, name string) error {
+	switch *tlsAuth {
+	case "":
+		*tlsAuth = "none"
+	case "none", "certificate", "both":
+	default:
+		return errors.New("Parameter " + name + " TLSAuth must be none, certificate or both")
+	}
+
+	*fingerprint = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(*fingerprint), ":", ""))
+	if len(*fingerprint) > 0 {
+		if _, err := hex.DecodeString(*fingerprint); err != nil || len(*fingerprint) != 64 {
+			return errors.New("Parameter " + name + " CertificateFingerprint must be hex of sha256")
+		}
+	}
+
+	if *tlsAuth != "none" && len(*fingerprint) == 0 && len(strings.TrimSpace(subject)) == 0 {
+		return errors.New("Parameter " + name + " CertificateFingerprint or CertificateSubject is mandatory for TLSAuth " + *tlsAuth)
+	}
+	return nil
+}
+
+// parsePrefixes parse comma separated IP or CIDR, single IP is a prefix of one address
+func parsePrefixes(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, errors.New(entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, errors.New(entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseRateRules parse comma separated rules, format: name=rate:burst
+func parseRateRules(value string, name string) (map[string]RateRule, error) {
+	rules := map[string]RateRule{}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		// route contains space, ex: POST /v1.0/todo=5:10
+		key, rule, ok := strings.Cut(entry, "=")
+		rawRate, rawBurst, okRule := strings.Cut(rule, ":")
+		if !ok || !okRule || len(strings.TrimSpace(key)) == 0 {
+			return nil, errors.New("Parameter " + name + " invalid value")
+		}
+
+		rate, errRate := strconv.Atoi(rawRate)
+		burst, errBurst := strconv.Atoi(rawBurst)
+		if errRate != nil || errBurst != nil || rate <= 0 || burst <= 0 {
+			return nil, errors.New("Parameter " + name + " rate and burst must be greater than 0")
+		}
+		rules[strings.TrimSpace(key)] = RateRule{Rate: rate, Burst: burst}
+	}
+	return rules, nil
+}
+
+// checkComponents check every space separated message signature component is supported
+func checkComponents(value string, name string) error {
+	for _, component := range strings.Fields(value) {
+		if !httpsig.ValidComponent(component) {
+			return errors.New("Parameter " + name + " has invalid component " + component)
+		}
+	}
+	return nil
+}
+
+func loadClientsFile(path string) ([]RegisteredClient, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("Parameter Clients File not valid file")
+	}
+
+	var file struct {
+		Clients []RegisteredClient `yaml:"clients"`
+	}
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(raw))), &file); err != nil {
+		return nil, errors.New("Parameter Clients File invalid format")
+	}
+
+	for i, c := range file.Clients {
+		if len(c.Key) == 0 || len(c.Secret) == 0 || len(c.PublicKey) == 0 {
+			return nil, errors.New("Parameter Clients File key, secret and publicKey are mandatory")
+		}
+
+		rawPub, err := os.ReadFile(c.PublicKey)
+		if err != nil {
+			return nil, errors.New("Parameter Clients File publicKey not valid file")
+		}
+		file.Clients[i].PublicKey = string(rawPub)
+
+		if len(c.Status) == 0 {
+			file.Clients[i].Status = "active"
+		}
+
+		if err := optionalSignatureMethod(&file.Clients[i].SignatureMethod, "Clients File signatureMethod"); err != nil {
+			return nil, err
+		}
+
+		if err := checkComponents(c.SignatureComponents, "Clients File signatureComponents"); err != nil {
+			return nil, err
+		}
+
+		if err := checkCertificate(&file.Clients[i].TLSAuth, &file.Clients[i].CertificateFingerprint, c.CertificateSubject, "Clients File"); err != nil {
+			return nil, err
+		}
+	}
+
+	return file.Clients, nil
+}
+
+// loadTrustedIssuers read external identity providers. Value may refer OS env, ex: ${IDP_TENANT}
+func loadTrustedIssuers(path string, selfIssuer string) ([]TrustedIssuer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("Parameter TrustedIssuers File not valid file")
+	}
+
+	var file struct {
+		Issuers []TrustedIssuer `yaml:"issuers"`
+	}
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(raw))), &file); err != nil {
+		return nil, errors.New("Parameter TrustedIssuers File invalid format")
+	}
+
+	seen := map[string]bool{selfIssuer: true}
+	for i, issuer := range file.Issuers {
+		if len(issuer.Issuer) == 0 || len(issuer.Audience) == 0 {
+			return nil, errors.New("Parameter TrustedIssuers File issuer and audience are mandatory")
+		}
+
+		if seen[issuer.Issuer] {
+			return nil, errors.New("Parameter TrustedIssuers File issuer " + issuer.Issuer + " is duplicated or the token issuer")
+		}
+		seen[issuer.Issuer] = true
+
+		if (len(issuer.JWKSURL) > 0) == (len(issuer.JWKSFile) > 0) {
+			return nil, errors.New("Parameter TrustedIssuers File issuer " + issuer.Issuer + " must set either jwksUrl or jwksFile")
+		}
+
+		if len(issuer.JWKSURL) > 0 {
+			if u, err := url.Parse(issuer.JWKSURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return nil, errors.New("Parameter TrustedIssuers File jwksUrl of " + issuer.Issuer + " invalid value")
+			}
+		}
+
+		claims := &file.Issuers[i].Claims
+		if len(claims.ClientID) == 0 {
+			claims.ClientID = "sub"
+		}
+		if len(claims.Scope) == 0 {
+			claims.Scope = "scope"
+		}
+		if len(claims.TokenID) == 0 {
+			claims.TokenID = "jti"
+		}
+	}
+
+	return file.Issuers, nil
 }
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const todoColumns = `id, title, detail, created_date, updated_date,
+			st_completed, completed_date, key_id, data_key, enc_title`
+
+// ArchiveTodos move up to limit todos which completed and last updated before the given time into todos_archive.
+// Unarchived todo is updated on unarchive, so it is kept on the list until it become old again.
+// Return number of archived todos
+func ArchiveTodos(db *sqlx.DB, ctx context.Context, before time.Time, limit int) (int, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	// any error will be rollback
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var ids []string
+	err = tx.SelectContext(ctx, &ids, `SELECT id FROM todos
+			WHERE st_completed='1' AND completed_date < ? AND updated_date < ?
+			ORDER BY completed_date
+			LIMIT ?
+			FOR UPDATE`, before, before, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		err = tx.Commit()
+		return 0, err
+	}
+
+	if err = moveTodos(tx, ctx, "todos", "todos_archive", ", archived_date", ", UTC_TIMESTAMP()", ids); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
+// UnarchiveTodo move todo back from todos_archive and stamp its updated_date,
+// so archiver does not move it again on the next run. Return false when todo is not archived
+func UnarchiveTodo(db *sqlx.DB, ctx context.Context, id string) (bool, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	// any error will be rollback
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var ids []string
+	err = tx.SelectContext(ctx, &ids, "SELECT id FROM todos_archive WHERE id=? FOR UPDATE", id)
+	if err != nil {
+		return false, err
+	}
+
+	if len(ids) == 0 {
+		err = tx.Commit()
+		return false, err
+	}
+
+	if err = moveTodos(tx, ctx, "todos_archive", "todos", "", "", ids); err != nil {
+		return false, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE todos SET updated_date=UTC_TIMESTAMP() WHERE id=?", id); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ListArchivedTodo return rows of archived todos, caller must close the rows
+func ListArchivedTodo(db *sqlx.DB, ctx context.Context, id string) (*sqlx.Rows, error) {
+	var args []interface{}
+
+	sql := "SELECT " + todoColumns + " FROM todos_archive WHERE 1=1"
+
+	if id != "" {
+		args = append(args, id)
+		sql = strings.Join([]string{sql, "AND id=?"}, " ")
+	}
+
+	sql = strings.Join([]string{sql, "ORDER BY updated_date DESC"}, " ")
+
+	return db.QueryxContext(ctx, sql, args...)
+}
+
+// moveTodos copy todos from table to other table then delete it from the origin
+func moveTodos(tx *sqlx.Tx, ctx context.Context, from string, to string, extraColumn string, extraValue string, ids []string) error {
+	insert, args, err := sqlx.In(
+		"INSERT INTO "+to+"("+todoColumns+extraColumn+") "+
+			"SELECT "+todoColumns+extraValue+" FROM "+from+" WHERE id IN (?)", ids)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, insert, args...); err != nil {
+		return err
+	}
+
+	del, args, err := sqlx.In("DELETE FROM "+from+" WHERE id IN (?)", ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, del, args...)
+	return err
+}
+
+// TryLock take MySQL named lock without waiting. Lock is hold by the returned connection,
+// release it with Unlock. Return nil connection when lock is hold by other session
+func TryLock(db *sqlx.DB, ctx context.Context, name string) (*sqlx.Conn, error) {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked sql.NullInt64
+	if err := conn.GetContext(ctx, &locked, "SELECT GET_LOCK(?, 0)", name); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if !locked.Valid || locked.Int64 != 1 {
+		_ = conn.Close()
+		return nil, nil
+	}
+
+	return conn, nil
+}
+
+// Unlock release lock taken by TryLock and return the connection to pool
+func Unlock(conn *sqlx.Conn, name string) error {
+	defer conn.Close()
+
+	_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+	return err
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const clientColumns = `client_key, secret, key_id, data_key, public_key, status, scopes,
+			signature_method, signature_components, tls_auth, cert_fingerprint, cert_subject,
+			created_date, updated_date`
+
+// GetClient return registered client by key. Return nil when client is not found
+func GetClient(db *sqlx.DB, ctx context.Context, clientKey string) (*TableClients, error) {
+	query := "SELECT " + clientColumns + " FROM clients WHERE client_key=?"
+
+	var tb TableClients
+	if err := db.GetContext(ctx, &tb, query, clientKey); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &tb, nil
+}
+
+func ListClients(db *sqlx.DB, ctx context.Context) ([]*TableClients, error) {
+	query := "SELECT " + clientColumns + " FROM clients ORDER BY created_date"
+
+	resp := []*TableClients{}
+	err := db.SelectContext(ctx, &resp, query)
+	return resp, err
+}
+
+func AddClient(db *sqlx.DB, ctx context.Context, tb *TableClients) error {
+	query := `INSERT INTO clients(` + clientColumns + `)
+			VALUES(:client_key, :secret, :key_id, :data_key, :public_key, :status, :scopes,
+				:signature_method, :signature_components, :tls_auth, :cert_fingerprint, :cert_subject,
+				:created_date, :updated_date)`
+
+	_, err := db.NamedExecContext(ctx, query, tb)
+	return err
+}
+
+const updateClient = `UPDATE clients
+			SET secret=:secret, key_id=:key_id, data_key=:data_key, public_key=:public_key,
+				status=:status, scopes=:scopes, signature_method=:signature_method,
+				signature_components=:signature_components, tls_auth=:tls_auth,
+				cert_fingerprint=:cert_fingerprint, cert_subject=:cert_subject, updated_date=:updated_date
+			WHERE client_key=:client_key`
+
+// UpdateClient update every column except client_key and created_date
+func UpdateClient(db *sqlx.DB, ctx context.Context, tb *TableClients) error {
+	_, err := db.NamedExecContext(ctx, updateClient, tb)
+	return err
+}
+
+// ChangeClient lock client row with SELECT ... FOR UPDATE, apply change then update it in one transaction,
+// so concurrent changes of the same client never overwrite each other. Return nil when client is not found
+func ChangeClient(db *sqlx.DB, ctx context.Context, clientKey string, change func(tb *TableClients) error) (*TableClients, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// any error will be rollback
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var tb TableClients
+	err = tx.GetContext(ctx, &tb, "SELECT "+clientColumns+" FROM clients WHERE client_key=? FOR UPDATE", clientKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.Commit()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = change(&tb); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.NamedExecContext(ctx, updateClient, &tb); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &tb, nil
+}
@@ -3,49 +3,181 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"log/slog"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/arthben/http_jwt_crud/internal/config"
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
+// ready is true while database answer ping, see Monitor
+var ready atomic.Bool
+
+// BoostrapDatabase open connection to database and wait until database is reachable.
+// Connect is retried with exponential backoff up to DB.ConnectRetry attempts
 func BoostrapDatabase(cfg *config.EnvParams) (*sqlx.DB, error) {
+	dbase, err := OpenDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, _ := strconv.Atoi(cfg.DB.ConnectRetry)
+	if err := connect(context.Background(), dbase, cfg, attempts); err != nil {
+		_ = dbase.Close()
+		return nil, err
+	}
+
+	return dbase, nil
+}
+
+// OpenDatabase prepare connection pool without connecting to database
+func OpenDatabase(cfg *config.EnvParams) (*sqlx.DB, error) {
 	dsn := mysql.Config{
-		User:                 cfg.DB.Username,
-		Passwd:               cfg.DB.Password,
-		Net:                  "tcp",
-		Addr:                 cfg.DB.Host,
-		DBName:               cfg.DB.Name,
-		AllowNativePasswords: true,
-		CheckConnLiveness:    true,
+		User:   cfg.DB.Username,
+		Passwd: cfg.DB.Password,
+		Net:    "tcp",
+		Addr:   cfg.DB.Host,
+		DBName: cfg.DB.Name,
 	}
-	dbase, err := sqlx.Connect("mysql", dsn.FormatDSN())
+
+	return openPool(&dsn, cfg)
+}
+
+// openPool open connection pool using pool parameter from config.
+// Timestamp is parsed as time.Time and session use UTC, so value is not shifted by server time zone
+func openPool(dsn *mysql.Config, cfg *config.EnvParams) (*sqlx.DB, error) {
+	dsn.AllowNativePasswords = true
+	dsn.CheckConnLiveness = true
+	dsn.ParseTime = true
+	dsn.Loc = time.UTC
+	if dsn.Params == nil {
+		dsn.Params = map[string]string{}
+	}
+	dsn.Params["time_zone"] = "'+00:00'"
+
+	dbase, err := sqlx.Open("mysql", dsn.FormatDSN())
 	if err != nil || dbase == nil {
 		return nil, err
 	}
 
 	maxIdleConn, _ := strconv.Atoi(cfg.DB.MinPool)
 	maxOpenConn, _ := strconv.Atoi(cfg.DB.MaxPool)
+	maxLifetime, _ := strconv.Atoi(cfg.DB.ConnMaxLifetime)
+	maxIdleTime, _ := strconv.Atoi(cfg.DB.ConnMaxIdleTime)
 	dbase.SetMaxIdleConns(maxIdleConn)
 	dbase.SetMaxOpenConns(maxOpenConn)
+	dbase.SetConnMaxLifetime(time.Duration(maxLifetime) * time.Second)
+	dbase.SetConnMaxIdleTime(time.Duration(maxIdleTime) * time.Second)
 
 	return dbase, nil
 }
 
+// Reconnect keep trying to reach database in background until success or ctx is done.
+// Used when server started in degraded mode
+func Reconnect(ctx context.Context, db *sqlx.DB, cfg *config.EnvParams) error {
+	return connect(ctx, db, cfg, 0)
+}
+
+// IsReady report whether database has been reached
+func IsReady() bool {
+	return ready.Load()
+}
+
+// Monitor ping database every DB.HealthCheckInterval until ctx is done, so readiness
+// become false when database is lost and true again when it is back
+func Monitor(ctx context.Context, db *sqlx.DB, cfg *config.EnvParams) {
+	interval, _ := strconv.Atoi(cfg.DB.HealthCheckInterval)
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ping(ctx, db)
+	}
+}
+
+// ping update readiness with the result of database ping
+func ping(ctx context.Context, db *sqlx.DB) {
+	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	err := db.PingContext(pingCtx)
+	cancel()
+
+	healthy := err == nil
+	if ready.Swap(healthy) != healthy {
+		if healthy {
+			slog.Info("Database Reachable")
+		} else {
+			slog.Warn("Database Lost", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// connect ping database with exponential backoff. attempts <= 0 means retry forever
+func connect(ctx context.Context, db *sqlx.DB, cfg *config.EnvParams, attempts int) error {
+	interval, _ := strconv.Atoi(cfg.DB.RetryInterval)
+	maxInterval, _ := strconv.Atoi(cfg.DB.RetryMaxInterval)
+	wait := time.Duration(interval) * time.Second
+	maxWait := time.Duration(maxInterval) * time.Second
+	if wait <= 0 {
+		wait = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			ready.Store(true)
+			return nil
+		}
+
+		if attempts > 0 && attempt >= attempts {
+			return err
+		}
+
+		slog.Warn("Database not reachable",
+			slog.Int("attempt", attempt),
+			slog.String("retry_in", wait.String()),
+			slog.String("error", err.Error()),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+		if maxWait > 0 && wait > maxWait {
+			wait = maxWait
+		}
+	}
+}
+
+// IsMissingTable report whether err is MySQL "table doesn't exist", ex: migration is not run yet
+func IsMissingTable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1146
+}
+
 func CloseDatabase(db *sqlx.DB) error {
 	return db.Close()
 }
 
-func ListTodo(db *sqlx.DB, ctx context.Context, id string) ([]*TableTodos, error) {
+// ListTodo return rows of todos, caller must close the rows.
+// Rows is not buffered, so result set can be streamed to client
+func ListTodo(db *sqlx.DB, ctx context.Context, id string) (*sqlx.Rows, error) {
 	var args []interface{}
 
-	sql := `SELECT id, title, detail, 
-			CONCAT('', created_date) AS created_date, 
-			CONCAT('', updated_date) AS updated_date, st_completed
-			FROM todos
-			WHERE 1=1`
+	sql := "SELECT " + todoColumns + " FROM todos WHERE 1=1"
 
 	if id != "" {
 		args = append(args, id)
@@ -54,9 +186,7 @@ func ListTodo(db *sqlx.DB, ctx context.Context, id string) ([]*TableTodos, error
 
 	sql = strings.Join([]string{sql, "ORDER BY updated_date DESC"}, " ")
 
-	resp := []*TableTodos{}
-	err := db.SelectContext(ctx, &resp, sql, args...)
-	return resp, err
+	return db.QueryxContext(ctx, sql, args...)
 }
 
 func AddTodo(db *sqlx.DB, ctx context.Context, tb *TableTodos) error {
@@ -72,8 +202,10 @@ func AddTodo(db *sqlx.DB, ctx context.Context, tb *TableTodos) error {
 		}
 	}()
 
-	sql := `INSERT INTO todos(id, title, detail, created_date, updated_date, st_completed)
-			VALUES(:id, :title, :detail, :created_date, :updated_date, :st_completed)`
+	sql := `INSERT INTO todos(id, title, detail, created_date, updated_date, st_completed,
+				key_id, data_key, enc_title)
+			VALUES(:id, :title, :detail, :created_date, :updated_date, :st_completed,
+				:key_id, :data_key, :enc_title)`
 	prep, err := tx.PrepareNamedContext(ctx, sql)
 	if err != nil {
 		return err
@@ -90,3 +222,26 @@ func AddTodo(db *sqlx.DB, ctx context.Context, tb *TableTodos) error {
 
 	return nil
 }
+
+// ListTodoToReencrypt return todos of table ( todos or todos_archive ) which not encrypted by keyID
+// or title encryption differ with encTitle. Ordered by ID, use afterID for the next batch
+func ListTodoToReencrypt(db *sqlx.DB, ctx context.Context, table string, keyID string, encTitle string, afterID string, limit int) ([]*TableTodos, error) {
+	sql := `SELECT id, title, detail, key_id, data_key, enc_title
+			FROM ` + table + `
+			WHERE (key_id <> ? OR enc_title <> ?) AND id > ?
+			ORDER BY id
+			LIMIT ?`
+
+	resp := []*TableTodos{}
+	err := db.SelectContext(ctx, &resp, sql, keyID, encTitle, afterID, limit)
+	return resp, err
+}
+
+func UpdateTodoEncryption(db *sqlx.DB, ctx context.Context, table string, tb *TableTodos) error {
+	sql := `UPDATE ` + table + `
+			SET title=:title, detail=:detail, key_id=:key_id, data_key=:data_key, enc_title=:enc_title
+			WHERE id=:id`
+
+	_, err := db.NamedExecContext(ctx, sql, tb)
+	return err
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDriver only answer ping, result of ping is set per DSN with setDown
+type fakeDriver struct{}
+
+type fakeConn struct{ name string }
+
+var (
+	fakeMu   sync.Mutex
+	fakeDown = map[string]bool{}
+)
+
+func init() {
+	sql.Register("fake", fakeDriver{})
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return &fakeConn{name: name}, nil }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	fakeMu.Lock()
+	defer fakeMu.Unlock()
+
+	if fakeDown[c.name] {
+		// connection is dropped from pool, next ping open a new one
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func setDown(name string, down bool) {
+	fakeMu.Lock()
+	fakeDown[name] = down
+	fakeMu.Unlock()
+}
+
+func openFake(t *testing.T, name string) *sqlx.DB {
+	db, err := sqlx.Open("fake", name)
+	if err != nil {
+		t.Fatalf("open fake database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestConnectRetry(t *testing.T) {
+	db := openFake(t, "primary-retry")
+	cfg := &config.EnvParams{}
+	cfg.DB.RetryInterval = "1"
+
+	setDown("primary-retry", true)
+	ready.Store(false)
+	if err := connect(context.Background(), db, cfg, 2); err == nil {
+		t.Errorf("Expected error after 2 attempts of unreachable database")
+	}
+	if IsReady() {
+		t.Errorf("Expected not ready while database is unreachable")
+	}
+
+	setDown("primary-retry", false)
+	if err := connect(context.Background(), db, cfg, 2); err != nil {
+		t.Errorf("Expected database reachable, got %v", err)
+	}
+	if !IsReady() {
+		t.Errorf("Expected ready once database answer ping")
+	}
+}
+
+func TestReadinessFollowPing(t *testing.T) {
+	db := openFake(t, "primary-ping")
+	ctx := context.Background()
+
+	setDown("primary-ping", false)
+	ping(ctx, db)
+	if !IsReady() {
+		t.Errorf("Expected ready while database answer ping")
+	}
+
+	// readiness must not stay true after database is lost
+	setDown("primary-ping", true)
+	ping(ctx, db)
+	if IsReady() {
+		t.Errorf("Expected not ready after database is lost")
+	}
+
+	setDown("primary-ping", false)
+	ping(ctx, db)
+	if !IsReady() {
+		t.Errorf("Expected ready again once database is back")
+	}
+}
@@ -1,11 +1,95 @@
 package database
 
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
 type TableTodos struct {
-	ID              string `db:"id"`
-	Title           string `db:"title"`
-	Detail          string `db:"detail"`
-	CreatedDate     string `db:"created_date"`
-	UpdatedDate     string `db:"updated_date"`
-	StatusCompleted string `db:"st_completed"`
-	CompletedDate   string `db:"completed_date"`
+	ID              string    `db:"id"`
+	Title           string    `db:"title"`
+	Detail          string    `db:"detail"`
+	CreatedDate     time.Time `db:"created_date"`
+	UpdatedDate     time.Time `db:"updated_date"`
+	StatusCompleted string    `db:"st_completed"`
+	CompletedDate   NullTime  `db:"completed_date" swaggertype:"string" format:"date-time"`
+	// envelope encryption, empty KeyID means plaintext row
+	KeyID    string `db:"key_id" json:"-"`
+	DataKey  string `db:"data_key" json:"-"`
+	EncTitle string `db:"enc_title" json:"-"`
+}
+
+// NullTime is nullable timestamp which serialised as RFC 3339 or null
+type NullTime struct {
+	sql.NullTime
+}
+
+func (n NullTime) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.Time.Format(time.RFC3339))
+}
+
+func (n *NullTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		n.Valid = false
+		return nil
+	}
+
+	if err := json.Unmarshal(data, &n.Time); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+type TableClients struct {
+	ClientKey string `db:"client_key"`
+	// HMAC secret encrypted by data key
+	Secret    string `db:"secret"`
+	KeyID     string `db:"key_id"`
+	DataKey   string `db:"data_key"`
+	PublicKey string `db:"public_key"`
+	Status    string `db:"status"`
+	// space separated allowed scopes
+	Scopes string `db:"scopes"`
+	// hmac or asymmetric, signature method of service request
+	SignatureMethod string `db:"signature_method"`
+	// space separated components which message signature must cover
+	SignatureComponents string `db:"signature_components"`
+	// none, certificate or both, client certificate authentication on token endpoint
+	TLSAuth string `db:"tls_auth"`
+	// lowercase hex SHA-256 and subject DN of client certificate
+	CertificateFingerprint string    `db:"cert_fingerprint"`
+	CertificateSubject     string    `db:"cert_subject"`
+	CreatedDate            time.Time `db:"created_date"`
+	UpdatedDate            time.Time `db:"updated_date"`
+}
+
+type TableRefreshTokens struct {
+	// sha256 hex of the opaque refresh token, the token itself is never stored
+	TokenHash string `db:"token_hash"`
+	// every refresh token rotated from the same grant share the family
+	FamilyID  string `db:"family_id"`
+	ClientKey string `db:"client_key"`
+	Scope     string `db:"scope"`
+	// certificate thumbprint of the family, empty when not certificate-bound
+	Thumbprint string `db:"thumbprint"`
+	// access token issued along with the refresh token
+	AccessJTI         string    `db:"access_jti"`
+	AccessExpiredDate time.Time `db:"access_expired_date"`
+	StUsed            string    `db:"st_used"`
+	ExpiredDate       time.Time `db:"expired_date"`
+	CreatedDate       time.Time `db:"created_date"`
+}
+
+type TableLockouts struct {
+	// "client:<clientKey>" or "ip:<address>"
+	LockKey     string    `db:"lock_key"`
+	Failures    int       `db:"failures"`
+	Level       int       `db:"level"`
+	LastFailure time.Time `db:"last_failure"`
+	LockedUntil NullTime  `db:"locked_until"`
 }
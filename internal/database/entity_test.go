@@ -0,0 +1,48 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTodoJSON(t *testing.T) {
+	zone := time.FixedZone("WIB", 7*60*60)
+	created := time.Date(2024, 5, 1, 10, 30, 0, 0, zone)
+
+	raw, err := json.Marshal(&TableTodos{ID: "id-1", CreatedDate: created, UpdatedDate: created})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var out map[string]interface{}
+	json.Unmarshal(raw, &out)
+	if out["CreatedDate"] != "2024-05-01T10:30:00+07:00" {
+		t.Errorf("Expected RFC 3339 with offset, got %v", out["CreatedDate"])
+	}
+	if out["CompletedDate"] != nil {
+		t.Errorf("Expected null completed date, got %v", out["CompletedDate"])
+	}
+	if _, ok := out["KeyID"]; ok {
+		t.Errorf("Expected encryption columns are not serialised")
+	}
+}
+
+func TestNullTime(t *testing.T) {
+	completed := NullTime{sql.NullTime{Time: time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC), Valid: true}}
+
+	raw, _ := json.Marshal(completed)
+	if string(raw) != `"2024-05-01T03:00:00Z"` {
+		t.Errorf("Expected RFC 3339, got %s", raw)
+	}
+
+	var parsed NullTime
+	if err := json.Unmarshal(raw, &parsed); err != nil || !parsed.Valid || !parsed.Time.Equal(completed.Time) {
+		t.Errorf("Expected round trip, got %+v %v", parsed, err)
+	}
+
+	if err := json.Unmarshal([]byte("null"), &parsed); err != nil || parsed.Valid {
+		t.Errorf("Expected null is not valid, got %+v %v", parsed, err)
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const lockoutColumns = "lock_key, failures, level, last_failure, locked_until"
+
+// GetLockout return failure counter of key, nil when key never failed
+func GetLockout(db *sqlx.DB, ctx context.Context, lockKey string) (*TableLockouts, error) {
+	var tb TableLockouts
+	err := db.GetContext(ctx, &tb, "SELECT "+lockoutColumns+" FROM lockouts WHERE lock_key=?", lockKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tb, nil
+}
+
+// UpdateLockout apply change to failure counter of key while the row is locked, so replicas do not lose a failure.
+// Counter which does not exist yet is created empty before change
+func UpdateLockout(db *sqlx.DB, ctx context.Context, lockKey string, change func(*TableLockouts)) (*TableLockouts, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// any error will be rollback
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, "INSERT IGNORE INTO lockouts(lock_key, last_failure) VALUES(?, UTC_TIMESTAMP())", lockKey); err != nil {
+		return nil, err
+	}
+
+	var tb TableLockouts
+	if err = tx.GetContext(ctx, &tb, "SELECT "+lockoutColumns+" FROM lockouts WHERE lock_key=? FOR UPDATE", lockKey); err != nil {
+		return nil, err
+	}
+
+	change(&tb)
+
+	query := `UPDATE lockouts SET failures=:failures, level=:level, last_failure=:last_failure, locked_until=:locked_until
+			WHERE lock_key=:lock_key`
+	if _, err = tx.NamedExecContext(ctx, query, &tb); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &tb, nil
+}
+
+// DeleteLockouts remove failure counter and lockout of keys
+func DeleteLockouts(db *sqlx.DB, ctx context.Context, lockKeys ...string) error {
+	query, args, err := sqlx.In("DELETE FROM lockouts WHERE lock_key IN (?)", lockKeys)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, db.Rebind(query), args...)
+	return err
+}
+
+// PurgeLockouts delete counter which last failure and lockout are both before the given time
+func PurgeLockouts(db *sqlx.DB, ctx context.Context, before time.Time) error {
+	_, err := db.ExecContext(ctx, `DELETE FROM lockouts
+			WHERE last_failure < ? AND (locked_until IS NULL OR locked_until < ?) LIMIT 1000`, before, before)
+	return err
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RememberNonce store nonce of client. Return false when the nonce is already stored and not expired.
+// Expired nonce is overwritten, so the row is updated (2 affected rows) instead of inserted (1 affected row)
+func RememberNonce(db *sqlx.DB, ctx context.Context, clientKey string, nonce string, expired time.Time) (bool, error) {
+	result, err := db.ExecContext(ctx, `INSERT INTO request_nonces(client_key, nonce, expired_date)
+			VALUES(?, ?, ?)
+			ON DUPLICATE KEY UPDATE expired_date=IF(expired_date < UTC_TIMESTAMP(), VALUES(expired_date), expired_date)`,
+		clientKey, nonce, expired)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// PurgeNonces delete nonce which already expired
+func PurgeNonces(db *sqlx.DB, ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM request_nonces WHERE expired_date < UTC_TIMESTAMP() LIMIT 1000")
+	return err
+}
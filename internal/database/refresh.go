@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const refreshColumns = `token_hash, family_id, client_key, scope, thumbprint, access_jti, access_expired_date,
+			st_used, expired_date, created_date`
+
+func AddRefreshToken(db *sqlx.DB, ctx context.Context, tb *TableRefreshTokens) error {
+	query := `INSERT INTO refresh_tokens(` + refreshColumns + `)
+			VALUES(:token_hash, :family_id, :client_key, :scope, :thumbprint, :access_jti, :access_expired_date,
+				:st_used, :expired_date, :created_date)`
+
+	_, err := db.NamedExecContext(ctx, query, tb)
+	return err
+}
+
+// UseRefreshToken mark refresh token as used when valid accept it, and return it as it was before.
+// Row is locked while valid is checked. Return nil when token is not found.
+// StUsed "1" on the returned token means the token is reused
+func UseRefreshToken(db *sqlx.DB, ctx context.Context, tokenHash string, valid func(tb *TableRefreshTokens) bool) (*TableRefreshTokens, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// any error will be rollback
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var tb TableRefreshTokens
+	err = tx.GetContext(ctx, &tb, "SELECT "+refreshColumns+" FROM refresh_tokens WHERE token_hash=? FOR UPDATE", tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.Commit()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if tb.StUsed != "1" && valid(&tb) {
+		if _, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET st_used='1' WHERE token_hash=?", tokenHash); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &tb, nil
+}
+
+// UseRefreshFamily mark every refresh token of the family as used and return them
+func UseRefreshFamily(db *sqlx.DB, ctx context.Context, familyID string) ([]*TableRefreshTokens, error) {
+	if _, err := db.ExecContext(ctx, "UPDATE refresh_tokens SET st_used='1' WHERE family_id=?", familyID); err != nil {
+		return nil, err
+	}
+
+	resp := []*TableRefreshTokens{}
+	err := db.SelectContext(ctx, &resp, "SELECT "+refreshColumns+" FROM refresh_tokens WHERE family_id=?", familyID)
+	return resp, err
+}
+
+// PurgeRefreshTokens delete refresh token which already expired
+func PurgeRefreshTokens(db *sqlx.DB, ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expired_date < UTC_TIMESTAMP() LIMIT 1000")
+	return err
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Replicas route read query to healthy replica using round-robin.
+// Write query always use primary.
+type Replicas struct {
+	primary  *sqlx.DB
+	nodes    []*replica
+	next     atomic.Uint64
+	interval time.Duration
+
+	// read-your-writes: last write time per client
+	window    time.Duration
+	mu        sync.Mutex
+	writes    map[string]time.Time
+	lastPurge time.Time
+}
+
+type replica struct {
+	addr    string
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// NewReplicas open connection pool of every replica on DB.Replicas.
+// Replica is not used until health check mark it as healthy
+func NewReplicas(primary *sqlx.DB, cfg *config.EnvParams) *Replicas {
+	interval, _ := strconv.Atoi(cfg.DB.ReplicaCheckInterval)
+	window, _ := strconv.Atoi(cfg.DB.ReadYourWritesWindow)
+
+	r := &Replicas{
+		primary:  primary,
+		interval: time.Duration(interval) * time.Second,
+		window:   time.Duration(window) * time.Second,
+		writes:   map[string]time.Time{},
+	}
+
+	for _, dsn := range SplitDSN(cfg.DB.Replicas) {
+		// DSN already validated on config.LoadConfig
+		parsed, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			continue
+		}
+
+		db, err := openPool(parsed, cfg)
+		if err != nil {
+			slog.Error("Open Replica", slog.String("addr", parsed.Addr), slog.String("error", err.Error()))
+			continue
+		}
+		r.nodes = append(r.nodes, &replica{addr: parsed.Addr, db: db})
+	}
+
+	return r
+}
+
+// SplitDSN split comma separated replica DSN
+func SplitDSN(dsns string) []string {
+	var result []string
+	for _, dsn := range strings.Split(dsns, ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			result = append(result, dsn)
+		}
+	}
+	return result
+}
+
+// Primary return connection for write query
+func (r *Replicas) Primary() *sqlx.DB {
+	return r.primary
+}
+
+// Reader return connection for read query.
+// When readYourWrites is true and client has been write within the window, primary is used.
+// Primary is also used when there is no healthy replica
+func (r *Replicas) Reader(clientKey string, readYourWrites bool) *sqlx.DB {
+	if readYourWrites && r.recentlyWrite(clientKey) {
+		return r.primary
+	}
+
+	total := len(r.nodes)
+	for i := 0; i < total; i++ {
+		node := r.nodes[int(r.next.Add(1)%uint64(total))]
+		if node.healthy.Load() {
+			return node.db
+		}
+	}
+
+	return r.primary
+}
+
+// MarkWrite record write time of client for read-your-writes.
+// Nothing is recorded without replica, every read already use primary
+func (r *Replicas) MarkWrite(clientKey string) {
+	if r.window <= 0 || len(r.nodes) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastPurge) >= r.window {
+		// forget write time which already pass the window
+		for client, last := range r.writes {
+			if now.Sub(last) >= r.window {
+				delete(r.writes, client)
+			}
+		}
+		r.lastPurge = now
+	}
+	r.writes[clientKey] = now
+}
+
+func (r *Replicas) recentlyWrite(clientKey string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last, ok := r.writes[clientKey]
+	return ok && time.Since(last) < r.window
+}
+
+// HealthCheck ping every replica periodically until ctx is done, then close connection pool of every replica
+func (r *Replicas) HealthCheck(ctx context.Context) {
+	if len(r.nodes) == 0 {
+		return
+	}
+	defer r.Close()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replicas) check(ctx context.Context) {
+	for _, node := range r.nodes {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err := node.db.PingContext(pingCtx)
+		cancel()
+
+		healthy := err == nil
+		if node.healthy.Swap(healthy) != healthy {
+			if healthy {
+				slog.Info("Replica Healthy", slog.String("addr", node.addr))
+			} else {
+				slog.Warn("Replica Unhealthy", slog.String("addr", node.addr), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// Close close connection pool of every replica
+func (r *Replicas) Close() {
+	for _, node := range r.nodes {
+		_ = node.db.Close()
+	}
+}
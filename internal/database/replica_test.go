@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func newTestReplicas(t *testing.T, window time.Duration, names ...string) *Replicas {
+	r := &Replicas{
+		primary:  openFake(t, "primary"),
+		interval: time.Second,
+		window:   window,
+		writes:   map[string]time.Time{},
+	}
+	for _, name := range names {
+		setDown(name, false)
+		r.nodes = append(r.nodes, &replica{addr: name, db: openFake(t, name)})
+	}
+	return r
+}
+
+func TestReplicaSelection(t *testing.T) {
+	r := newTestReplicas(t, 0, "replica-a", "replica-b")
+	a, b := r.nodes[0].db, r.nodes[1].db
+
+	// replica is not used until health check mark it as healthy
+	if got := r.Reader("client", false); got != r.primary {
+		t.Errorf("Expected primary before health check")
+	}
+
+	r.check(context.Background())
+	seen := map[*sqlx.DB]int{}
+	for i := 0; i < 4; i++ {
+		seen[r.Reader("client", false)]++
+	}
+	if seen[a] != 2 || seen[b] != 2 {
+		t.Errorf("Expected round-robin between replicas, got a=%d b=%d primary=%d", seen[a], seen[b], seen[r.primary])
+	}
+
+	// failover to the healthy replica
+	setDown("replica-a", true)
+	r.check(context.Background())
+	for i := 0; i < 3; i++ {
+		if got := r.Reader("client", false); got != b {
+			t.Errorf("Expected healthy replica b after replica a is down")
+		}
+	}
+
+	// primary when every replica is down
+	setDown("replica-b", true)
+	r.check(context.Background())
+	if got := r.Reader("client", false); got != r.primary {
+		t.Errorf("Expected primary when every replica is down")
+	}
+
+	setDown("replica-a", false)
+	setDown("replica-b", false)
+	r.check(context.Background())
+	if got := r.Reader("client", false); got == r.primary {
+		t.Errorf("Expected replica again once replica is back")
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	r := newTestReplicas(t, 50*time.Millisecond, "replica-ryw")
+	r.check(context.Background())
+
+	r.MarkWrite("writer")
+	if got := r.Reader("writer", true); got != r.primary {
+		t.Errorf("Expected primary for client which just write")
+	}
+	if got := r.Reader("writer", false); got == r.primary {
+		t.Errorf("Expected replica when read-your-writes is not requested")
+	}
+	if got := r.Reader("other", true); got == r.primary {
+		t.Errorf("Expected replica for client which did not write")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got := r.Reader("writer", true); got == r.primary {
+		t.Errorf("Expected replica after the window")
+	}
+
+	// write time which pass the window is forgotten
+	r.MarkWrite("other")
+	if _, ok := r.writes["writer"]; ok || len(r.writes) != 1 {
+		t.Errorf("Expected expired write time is purged, got %v", r.writes)
+	}
+}
+
+func TestMarkWriteWithoutReplica(t *testing.T) {
+	r := newTestReplicas(t, time.Minute)
+
+	for _, client := range []string{"a", "b", "c"} {
+		r.MarkWrite(client)
+	}
+	if len(r.writes) != 0 {
+		t.Errorf("Expected no write time without replica, got %d", len(r.writes))
+	}
+	if got := r.Reader("a", true); got != r.primary {
+		t.Errorf("Expected primary without replica")
+	}
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AddRevokedToken store token ID on denylist. Revoke twice is not an error
+func AddRevokedToken(db *sqlx.DB, ctx context.Context, jti string, expired time.Time) error {
+	_, err := db.ExecContext(ctx, "INSERT IGNORE INTO revoked_tokens(jti, expired_date) VALUES(?, ?)", jti, expired)
+	return err
+}
+
+func IsRevokedToken(db *sqlx.DB, ctx context.Context, jti string) (bool, error) {
+	var total int
+	err := db.GetContext(ctx, &total, `SELECT COUNT(1) FROM revoked_tokens
+			WHERE jti=? AND expired_date > UTC_TIMESTAMP()`, jti)
+	return total > 0, err
+}
+
+// PurgeRevokedTokens delete token which already expired, the token is rejected anyway
+func PurgeRevokedTokens(db *sqlx.DB, ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expired_date < UTC_TIMESTAMP() LIMIT 1000")
+	return err
+}
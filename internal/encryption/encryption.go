@@ -0,0 +1,127 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// KeySize of master key and data key (AES-256)
+const KeySize = 32
+
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Keyring hold master keys used to wrap per-row data key (envelope encryption).
+// Only the active key wrap new data key, other keys are kept to unwrap old rows until re-encrypted
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+func NewKeyring(keys map[string][]byte, active string) *Keyring {
+	return &Keyring{keys: keys, active: active}
+}
+
+// ActiveKeyID return ID of master key used for new data key
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// DataKey is plain data key with its wrapped form which stored along with the row
+type DataKey struct {
+	KeyID   string
+	Wrapped string
+	key     []byte
+}
+
+// NewDataKey generate random data key wrapped by active master key
+func (k *Keyring) NewDataKey() (*DataKey, error) {
+	master, ok := k.keys[k.active]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := seal(master, key, []byte(k.active))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{KeyID: k.active, Wrapped: wrapped, key: key}, nil
+}
+
+// OpenDataKey unwrap data key using master key of keyID
+func (k *Keyring) OpenDataKey(keyID string, wrapped string) (*DataKey, error) {
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	key, err := open(master, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{KeyID: keyID, Wrapped: wrapped, key: key}, nil
+}
+
+// Encrypt plaintext with AES-256-GCM. aad bind the ciphertext to its row and column
+func (d *DataKey) Encrypt(plaintext string, aad string) (string, error) {
+	return seal(d.key, []byte(plaintext), []byte(aad))
+}
+
+// Decrypt ciphertext produced by Encrypt with the same aad
+func (d *DataKey) Decrypt(ciphertext string, aad string) (string, error) {
+	plaintext, err := open(d.key, ciphertext, []byte(aad))
+	return string(plaintext), err
+}
+
+// seal return base64(nonce + ciphertext)
+func seal(key []byte, plaintext []byte, aad []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, aad)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func open(key []byte, ciphertext string, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,101 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKeyring(active string, ids ...string) *Keyring {
+	keys := map[string][]byte{}
+	for i, id := range ids {
+		keys[id] = bytes.Repeat([]byte{byte(i + 1)}, KeySize)
+	}
+	return NewKeyring(keys, active)
+}
+
+func TestRoundTrip(t *testing.T) {
+	keyring := testKeyring("2024", "2024")
+
+	dataKey, err := keyring.NewDataKey()
+	if err != nil {
+		t.Fatalf("NewDataKey: %v", err)
+	}
+	if dataKey.KeyID != "2024" {
+		t.Errorf("Expected data key wrapped by active key, got %s", dataKey.KeyID)
+	}
+
+	ciphertext, err := dataKey.Encrypt("secret detail", "id-1:detail")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if ciphertext == "secret detail" {
+		t.Errorf("Expected ciphertext differ from plaintext")
+	}
+
+	opened, err := keyring.OpenDataKey(dataKey.KeyID, dataKey.Wrapped)
+	if err != nil {
+		t.Fatalf("OpenDataKey: %v", err)
+	}
+
+	plaintext, err := opened.Decrypt(ciphertext, "id-1:detail")
+	if err != nil || plaintext != "secret detail" {
+		t.Errorf("Expected 'secret detail', got '%s' %v", plaintext, err)
+	}
+}
+
+func TestAADBinding(t *testing.T) {
+	keyring := testKeyring("2024", "2024")
+	dataKey, _ := keyring.NewDataKey()
+	ciphertext, _ := dataKey.Encrypt("secret detail", "id-1:detail")
+
+	// ciphertext moved to other row or other column must fail
+	for _, aad := range []string{"id-2:detail", "id-1:title", ""} {
+		if _, err := dataKey.Decrypt(ciphertext, aad); err == nil {
+			t.Errorf("Expected decrypt with aad '%s' to fail", aad)
+		}
+	}
+
+	// wrapped data key is bound to its key ID
+	if _, err := keyring.OpenDataKey("2023", dataKey.Wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	if _, err := testKeyring("2025", "2024").NewDataKey(); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey of missing active key, got %v", err)
+	}
+
+	old := testKeyring("2023", "2023", "2024")
+	dataKey, _ := old.NewDataKey()
+
+	// master key removed after rotation
+	if _, err := testKeyring("2024", "2024").OpenDataKey("2023", dataKey.Wrapped); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey of removed key, got %v", err)
+	}
+
+	// the same key ID with other key material
+	other := NewKeyring(map[string][]byte{"2023": bytes.Repeat([]byte{9}, KeySize)}, "2023")
+	if _, err := other.OpenDataKey("2023", dataKey.Wrapped); err == nil {
+		t.Errorf("Expected unwrap with wrong master key to fail")
+	}
+}
+
+func TestTampered(t *testing.T) {
+	dataKey, _ := testKeyring("2024", "2024").NewDataKey()
+	ciphertext, _ := dataKey.Encrypt("secret detail", "id-1:detail")
+
+	raw, _ := base64.StdEncoding.DecodeString(ciphertext)
+	raw[len(raw)-1] ^= 1
+	if _, err := dataKey.Decrypt(base64.StdEncoding.EncodeToString(raw), "id-1:detail"); err == nil {
+		t.Errorf("Expected tampered ciphertext to fail")
+	}
+
+	for _, invalid := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := dataKey.Decrypt(invalid, "id-1:detail"); err == nil {
+			t.Errorf("Expected invalid ciphertext '%s' to fail", invalid)
+		}
+	}
+}
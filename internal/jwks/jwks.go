@@ -0,0 +1,258 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// limit of JWKS document, key set is small
+const maxSize = 1 << 20
+
+var (
+	ErrUnknownKid = errors.New("kid is not found on JWKS")
+	ErrKeyType    = errors.New("key type is not supported")
+)
+
+// Key is public key of JWKS with the only algorithm it is used for
+type Key struct {
+	Public crypto.PublicKey
+	Alg    string
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Cache keep keys of JWKS URL or local JWKS file by kid.
+// Keys are refreshed by Run, unknown kid refetch the set at most once per minRefetch
+type Cache struct {
+	url        string
+	file       string
+	client     *http.Client
+	minRefetch time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]Key
+	fetched time.Time
+}
+
+// New build cache of JWKS URL, or local JWKS file when url is empty
+func New(url string, file string, minRefetch time.Duration) *Cache {
+	return &Cache{
+		url:        url,
+		file:       file,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		minRefetch: minRefetch,
+		keys:       map[string]Key{},
+	}
+}
+
+// Key return key of kid. Key set is fetched again when kid is unknown, ex: IdP rotated its key
+func (c *Cache) Key(ctx context.Context, kid string) (Key, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	refetch := !ok && time.Since(c.fetched) >= c.minRefetch
+	c.mu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	if !refetch {
+		return Key{}, ErrUnknownKid
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		return Key{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok = c.keys[kid]; !ok {
+		return Key{}, ErrUnknownKid
+	}
+	return key, nil
+}
+
+// Refresh fetch the key set and replace cached keys. Cached keys are kept when fetch fail
+func (c *Cache) Refresh(ctx context.Context) error {
+	// failed fetch also count, so unknown kid does not hammer the IdP
+	c.mu.Lock()
+	c.fetched = time.Now()
+	c.mu.Unlock()
+
+	raw, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+	return nil
+}
+
+// Run refresh the key set every interval until ctx is done
+func (c *Cache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Refresh(ctx); err != nil {
+			slog.Warn("JWKS Refresh", slog.String("source", c.source()), slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cache) source() string {
+	if c.url != "" {
+		return c.url
+	}
+	return c.file
+}
+
+func (c *Cache) fetch(ctx context.Context) ([]byte, error) {
+	if c.url == "" {
+		return os.ReadFile(c.file)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSize))
+}
+
+// Parse parse JSON Web Key Set (RFC 7517). Key without kid, encryption key
+// and key type which is not supported are skipped
+func Parse(raw []byte) (map[string]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]Key{}
+	for _, k := range set.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		key, err := parseKey(k)
+		if err != nil {
+			slog.Warn("JWKS Key", slog.String("kid", k.Kid), slog.String("error", err.Error()))
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+// parseKey return public key of JWK. Algorithm follow key type when alg is not set:
+// RSA RS256, EC by curve, OKP (Ed25519) EdDSA
+func parseKey(k jwk) (Key, error) {
+	switch k.Kty {
+	case "RSA":
+		n, errN := decode(k.N)
+		e, errE := decode(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 {
+			return Key{}, ErrKeyType
+		}
+
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return Key{Public: public, Alg: orDefault(k.Alg, "RS256")}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		var alg string
+		switch k.Crv {
+		case "P-256":
+			curve, alg = elliptic.P256(), "ES256"
+		case "P-384":
+			curve, alg = elliptic.P384(), "ES384"
+		case "P-521":
+			curve, alg = elliptic.P521(), "ES512"
+		default:
+			return Key{}, ErrKeyType
+		}
+
+		x, errX := decode(k.X)
+		y, errY := decode(k.Y)
+		if errX != nil || errY != nil {
+			return Key{}, ErrKeyType
+		}
+
+		public := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(public.X, public.Y) {
+			return Key{}, ErrKeyType
+		}
+		return Key{Public: public, Alg: orDefault(k.Alg, alg)}, nil
+
+	case "OKP":
+		x, err := decode(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return Key{}, ErrKeyType
+		}
+		return Key{Public: ed25519.PublicKey(x), Alg: orDefault(k.Alg, "EdDSA")}, nil
+	}
+
+	return Key{}, ErrKeyType
+}
+
+func decode(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+func orDefault(value string, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
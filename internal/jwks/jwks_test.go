@@ -0,0 +1,162 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// provider is stand-in of identity provider JWKS endpoint
+type provider struct {
+	mu      sync.Mutex
+	keys    map[string]*ecdsa.PublicKey
+	status  int
+	fetches int
+}
+
+func (p *provider) publish(kid string) *ecdsa.PublicKey {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys[kid] = &key.PublicKey
+	return &key.PublicKey
+}
+
+func (p *provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetches++
+
+	if p.status != http.StatusOK {
+		w.WriteHeader(p.status)
+		return
+	}
+
+	keys := []jwk{}
+	for kid, key := range p.keys {
+		keys = append(keys, jwk{
+			Kty: "EC",
+			Use: "sig",
+			Kid: kid,
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+func (p *provider) fetched() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fetches
+}
+
+func newProvider(t *testing.T) (*provider, *httptest.Server) {
+	p := &provider{keys: map[string]*ecdsa.PublicKey{}, status: http.StatusOK}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	return p, srv
+}
+
+func TestRotation(t *testing.T) {
+	p, srv := newProvider(t)
+	first := p.publish("idp-1")
+	cache := New(srv.URL, "", time.Millisecond)
+
+	key, err := cache.Key(context.Background(), "idp-1")
+	if err != nil || !first.Equal(key.Public) || key.Alg != "ES256" {
+		t.Fatalf("Expected key of idp-1, got %+v %v", key, err)
+	}
+
+	// provider rotated its key, new kid is fetched without waiting for Run
+	rotated := p.publish("idp-2")
+	time.Sleep(2 * time.Millisecond)
+	key, err = cache.Key(context.Background(), "idp-2")
+	if err != nil || !rotated.Equal(key.Public) {
+		t.Errorf("Expected rotated key of idp-2, got %+v %v", key, err)
+	}
+
+	if fetches := p.fetched(); fetches != 2 {
+		t.Errorf("Expected 2 fetches, got %d", fetches)
+	}
+}
+
+func TestUnknownKid(t *testing.T) {
+	p, srv := newProvider(t)
+	p.publish("idp-1")
+	cache := New(srv.URL, "", time.Hour)
+
+	if _, err := cache.Key(context.Background(), "made-up"); !errors.Is(err, ErrUnknownKid) {
+		t.Errorf("Expected ErrUnknownKid, got %v", err)
+	}
+
+	// cached kid is not affected
+	if _, err := cache.Key(context.Background(), "idp-1"); err != nil {
+		t.Errorf("Expected key of idp-1, got %v", err)
+	}
+}
+
+func TestRefetchThrottle(t *testing.T) {
+	p, srv := newProvider(t)
+	p.publish("idp-1")
+	cache := New(srv.URL, "", time.Hour)
+
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// unknown kid within minRefetch does not fetch again, even after the provider rotated
+	p.publish("idp-2")
+	for i := 0; i < 5; i++ {
+		if _, err := cache.Key(context.Background(), "made-up"); !errors.Is(err, ErrUnknownKid) {
+			t.Errorf("Expected ErrUnknownKid, got %v", err)
+		}
+	}
+	if _, err := cache.Key(context.Background(), "idp-2"); !errors.Is(err, ErrUnknownKid) {
+		t.Errorf("Expected idp-2 is not fetched within minRefetch, got %v", err)
+	}
+
+	if fetches := p.fetched(); fetches != 1 {
+		t.Errorf("Expected 1 fetch, got %d", fetches)
+	}
+}
+
+func TestFetchFailure(t *testing.T) {
+	p, srv := newProvider(t)
+	first := p.publish("idp-1")
+	cache := New(srv.URL, "", time.Millisecond)
+
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	// cached keys are kept when provider is failing
+	p.mu.Lock()
+	p.status = http.StatusInternalServerError
+	p.mu.Unlock()
+	time.Sleep(2 * time.Millisecond)
+
+	if _, err := cache.Key(context.Background(), "idp-2"); err == nil || errors.Is(err, ErrUnknownKid) {
+		t.Errorf("Expected fetch error, got %v", err)
+	}
+	if err := cache.Refresh(context.Background()); err == nil {
+		t.Errorf("Expected fetch error on Refresh")
+	}
+
+	key, err := cache.Key(context.Background(), "idp-1")
+	if err != nil || !first.Equal(key.Public) {
+		t.Errorf("Expected cached key of idp-1, got %+v %v", key, err)
+	}
+}
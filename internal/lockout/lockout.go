@@ -0,0 +1,293 @@
+package lockout
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+// purge forgotten counter at most once per purgeInterval
+const purgeInterval = time.Minute
+
+// State is failure counter of one key
+type State struct {
+	// failures since the last lockout
+	Failures int
+	// number of lockouts in a row, cooldown is doubled on each level
+	Level       int
+	LastFailure time.Time
+	// zero when key was never locked
+	LockedUntil time.Time
+}
+
+// Store keep failure counter by key. Update apply change to state of key,
+// state which does not exist yet start empty
+type Store interface {
+	Get(ctx context.Context, key string) (State, error)
+	Update(ctx context.Context, key string, change func(*State)) (State, error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Lockout count failed client authentication per key (client key and source IP).
+// Key is locked for cooldown after MaxFailures failures within window, cooldown is doubled
+// on each lockout in a row up to maxCooldown. Quiet window reset the counter and the level
+type Lockout struct {
+	store       Store
+	maxFailures int
+	window      time.Duration
+	cooldown    time.Duration
+	maxCooldown time.Duration
+}
+
+// New build lockout based on Lockout config. Use database store when running multiple replicas
+func New(db *sqlx.DB, cfg *config.EnvParams) *Lockout {
+	maxFailures, _ := strconv.Atoi(cfg.Lockout.MaxFailures)
+	window, _ := strconv.Atoi(cfg.Lockout.Window)
+	cooldown, _ := strconv.Atoi(cfg.Lockout.Cooldown)
+	maxCooldown, _ := strconv.Atoi(cfg.Lockout.MaxCooldown)
+
+	var store Store = NewMemoryStore(time.Duration(window) * time.Second)
+	if cfg.Lockout.Store == "database" {
+		store = NewDBStore(db, time.Duration(window)*time.Second)
+	}
+
+	l := NewLockout(store, maxFailures, time.Duration(window)*time.Second, time.Duration(cooldown)*time.Second)
+	l.maxCooldown = time.Duration(maxCooldown) * time.Second
+	return l
+}
+
+func NewLockout(store Store, maxFailures int, window time.Duration, cooldown time.Duration) *Lockout {
+	return &Lockout{
+		store:       store,
+		maxFailures: maxFailures,
+		window:      window,
+		cooldown:    cooldown,
+		maxCooldown: 64 * cooldown,
+	}
+}
+
+// ClientKey return lock key of client
+func ClientKey(clientKey string) string {
+	return "client:" + clientKey
+}
+
+// IP return lock key of source address
+func IP(ip string) string {
+	return "ip:" + ip
+}
+
+// Check return the longest remaining lockout of keys, zero when none is locked
+func (l *Lockout) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	if l.maxFailures <= 0 {
+		return 0, nil
+	}
+
+	var remaining time.Duration
+	for _, key := range keys {
+		state, err := l.store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		if left := time.Until(state.LockedUntil); left > remaining {
+			remaining = left
+		}
+	}
+	return remaining, nil
+}
+
+// Fail count one failure on each key and lock the key which reach MaxFailures
+func (l *Lockout) Fail(ctx context.Context, keys ...string) error {
+	if l.maxFailures <= 0 {
+		return nil
+	}
+
+	for _, key := range keys {
+		var locked time.Duration
+		state, err := l.store.Update(ctx, key, func(s *State) {
+			locked = l.fail(s, time.Now())
+		})
+		if err != nil {
+			return err
+		}
+
+		if locked > 0 {
+			slog.Warn("Security Event",
+				slog.String("event", "lockout"),
+				slog.String("key", key),
+				slog.Int("level", state.Level),
+				slog.Duration("cooldown", locked),
+				slog.Time("lockedUntil", state.LockedUntil),
+			)
+		}
+	}
+	return nil
+}
+
+// fail count failure of state and return the cooldown when state become locked
+func (l *Lockout) fail(s *State, now time.Time) time.Duration {
+	last := s.LastFailure
+	if s.LockedUntil.After(last) {
+		last = s.LockedUntil
+	}
+
+	if now.Sub(last) > l.window {
+		s.Failures, s.Level = 0, 0
+	}
+
+	s.Failures++
+	s.LastFailure = now
+	if s.Failures < l.maxFailures {
+		return 0
+	}
+
+	s.Level++
+	cooldown := l.cooldown
+	for i := 1; i < s.Level && cooldown < l.maxCooldown; i++ {
+		cooldown *= 2
+	}
+	cooldown = min(cooldown, l.maxCooldown)
+
+	s.Failures = 0
+	s.LockedUntil = now.Add(cooldown)
+	return cooldown
+}
+
+// Reset forget failures and lockout of keys, ex: after successful authentication or by admin
+func (l *Lockout) Reset(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return l.store.Delete(ctx, keys...)
+}
+
+// MemoryStore keep counter on process memory. Each replica count on its own
+type MemoryStore struct {
+	mu        sync.Mutex
+	states    map[string]State
+	window    time.Duration
+	lastPurge time.Time
+}
+
+func NewMemoryStore(window time.Duration) *MemoryStore {
+	return &MemoryStore{states: map[string]State{}, window: window}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(ctx context.Context, key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.states[key], nil
+}
+
+// Update implements Store.
+func (s *MemoryStore) Update(ctx context.Context, key string, change func(*State)) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPurge) >= purgeInterval {
+		// counter is forgotten after quiet window anyway
+		for k, state := range s.states {
+			if now.Sub(state.LastFailure) > s.window && now.Sub(state.LockedUntil) > s.window {
+				delete(s.states, k)
+			}
+		}
+		s.lastPurge = now
+	}
+
+	state := s.states[key]
+	change(&state)
+	s.states[key] = state
+	return state, nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.states, key)
+	}
+	return nil
+}
+
+// DBStore keep counter on lockouts table, shared by every replica
+type DBStore struct {
+	db     *sqlx.DB
+	window time.Duration
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewDBStore(db *sqlx.DB, window time.Duration) *DBStore {
+	return &DBStore{db: db, window: window}
+}
+
+// Get implements Store.
+func (s *DBStore) Get(ctx context.Context, key string) (State, error) {
+	tb, err := dbs.GetLockout(s.db, ctx, key)
+	if err != nil || tb == nil {
+		return State{}, err
+	}
+	return toState(tb), nil
+}
+
+// Update implements Store.
+func (s *DBStore) Update(ctx context.Context, key string, change func(*State)) (State, error) {
+	var state State
+	_, err := dbs.UpdateLockout(s.db, ctx, key, func(tb *dbs.TableLockouts) {
+		state = toState(tb)
+		change(&state)
+
+		tb.Failures = state.Failures
+		tb.Level = state.Level
+		tb.LastFailure = state.LastFailure.UTC()
+		tb.LockedUntil.Time = state.LockedUntil.UTC()
+		tb.LockedUntil.Valid = !state.LockedUntil.IsZero()
+	})
+	if err != nil {
+		return State{}, err
+	}
+
+	s.mu.Lock()
+	purge := time.Since(s.lastPurge) >= purgeInterval
+	if purge {
+		s.lastPurge = time.Now()
+	}
+	s.mu.Unlock()
+
+	// forgotten counter is purged again on the next interval, failure must not fail the request
+	if purge {
+		if err := dbs.PurgeLockouts(s.db, ctx, time.Now().UTC().Add(-s.window)); err != nil {
+			slog.Warn("Purge Lockouts", slog.String("error", err.Error()))
+		}
+	}
+	return state, nil
+}
+
+// Delete implements Store.
+func (s *DBStore) Delete(ctx context.Context, keys ...string) error {
+	return dbs.DeleteLockouts(s.db, ctx, keys...)
+}
+
+func toState(tb *dbs.TableLockouts) State {
+	state := State{
+		Failures:    tb.Failures,
+		Level:       tb.Level,
+		LastFailure: tb.LastFailure,
+	}
+	if tb.LockedUntil.Valid {
+		state.LockedUntil = tb.LockedUntil.Time
+	}
+	return state
+}
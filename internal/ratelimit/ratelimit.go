@@ -0,0 +1,269 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/clientip"
+	"github.com/arthben/http_jwt_crud/internal/config"
+	res "github.com/arthben/http_jwt_crud/internal/response"
+)
+
+// purge full bucket at most once per purgeInterval
+const purgeInterval = time.Minute
+
+// overflowKey is the bucket shared by every key without bucket when memory store is full
+const overflowKey = "overflow"
+
+// Limit is token bucket refilled with Rate tokens per second, holding up to Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result of taking one token from bucket
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// time until bucket is full again
+	Reset time.Duration
+	// time until next token is available, zero when allowed
+	RetryAfter time.Duration
+}
+
+// Bucket is token bucket of key limited by Limit
+type Bucket struct {
+	Key   string
+	Limit Limit
+}
+
+// Store keep token buckets by key. Take one token from every bucket only when all of them have one,
+// so request rejected on one bucket does not use up the others. Bucket which does not exist yet start full.
+// Result is of the rejecting bucket, or of the bucket with less remaining when allowed
+type Store interface {
+	Take(ctx context.Context, buckets []Bucket) (Result, error)
+}
+
+// ClientFunc return verified client of request, false when request was not authenticated
+type ClientFunc func(r *http.Request) (string, bool)
+
+// Limiter limit request of each client with two buckets:
+// one for every route of the client and one for the route itself.
+// Source IP has its own bucket when IP limit is set
+type Limiter struct {
+	store   Store
+	enabled bool
+	def     Limit
+	ip      Limit
+	clients map[string]Limit
+	routes  map[string]Limit
+	// source IP behind trusted proxy, nil use remote address
+	clientIP *clientip.Resolver
+	// verified client, nil limit every request per source IP
+	client ClientFunc
+}
+
+// New build limiter based on RateLimit config, buckets are kept in memory.
+// client return the verified client of authenticated request
+func New(cfg *config.EnvParams, client ClientFunc) *Limiter {
+	maxBuckets, _ := strconv.Atoi(cfg.RateLimit.MaxBuckets)
+	l := NewLimiter(NewMemoryStore(maxBuckets), toLimit(cfg.RateLimit.Default))
+	l.enabled = cfg.RateLimit.Enabled == "true"
+	l.ip = toLimit(cfg.RateLimit.IP)
+	l.clientIP = clientip.New(cfg)
+	l.client = client
+
+	for key, rule := range cfg.RateLimit.ClientRules {
+		l.clients[key] = toLimit(rule)
+	}
+	for route, rule := range cfg.RateLimit.RouteRules {
+		l.routes[route] = toLimit(rule)
+	}
+	return l
+}
+
+func NewLimiter(store Store, def Limit) *Limiter {
+	return &Limiter{
+		store:   store,
+		enabled: true,
+		def:     def,
+		clients: map[string]Limit{},
+		routes:  map[string]Limit{},
+	}
+}
+
+func toLimit(rule config.RateRule) Limit {
+	return Limit{Rate: float64(rule.Rate), Burst: rule.Burst}
+}
+
+// Handler limit request to route (mux pattern, ex: "POST /v1.0/todo").
+// Rejected request is responded with HTTP 429 of serviceCode
+func (l *Limiter) Handler(route string, serviceCode string, next http.Handler) http.Handler {
+	if !l.enabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := l.clientIP.IP(r)
+		client := l.clientKey(r, ip)
+
+		limit, ok := l.clients[client]
+		if !ok {
+			limit = l.def
+		}
+
+		var buckets []Bucket
+		if l.ip.Burst > 0 {
+			buckets = append(buckets, Bucket{"ip:" + ip, l.ip})
+		}
+		if routeLimit, ok := l.routes[route]; ok {
+			buckets = append(buckets, Bucket{"route:" + route + ":" + client, routeLimit})
+		}
+		buckets = append(buckets, Bucket{"client:" + client, limit})
+
+		result, err := l.store.Take(r.Context(), buckets)
+		if err != nil {
+			// limiter must not take the API down, request is allowed when store is failing
+			slog.Warn("Rate Limit", slog.String("error", err.Error()))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+			res.Write(w).AbortWithJSON(res.BadResponse(http.StatusTooManyRequests, serviceCode, "00", "Too Many Requests"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientKey identify client by the verified client of request, or source IP when request
+// is not authenticated (yet). Client sent on header is never trusted here
+func (l *Limiter) clientKey(r *http.Request, ip string) string {
+	if l.client != nil {
+		if client, ok := l.client(r); ok {
+			return client
+		}
+	}
+	return "ip:" + ip
+}
+
+// seconds round duration up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// refill add tokens for time passed since last update
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*b.limit.Rate)
+	b.updated = now
+}
+
+// MemoryStore keep buckets on process memory. Each replica limit on its own.
+// When maxBuckets is reached, key without bucket share the overflow bucket
+// until full buckets are purged. 0 maxBuckets is unlimited
+type MemoryStore struct {
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	maxBuckets int
+	lastPurge  time.Time
+}
+
+func NewMemoryStore(maxBuckets int) *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, maxBuckets: maxBuckets}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(ctx context.Context, buckets []Bucket) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPurge) >= purgeInterval {
+		// full bucket is the same as bucket which does not exist
+		for k, b := range s.buckets {
+			if b.refill(now); b.tokens >= float64(b.limit.Burst) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastPurge = now
+	}
+
+	// several keys may share the overflow bucket, each of them take one token
+	taken := make([]*bucket, len(buckets))
+	need := map[*bucket]float64{}
+	for i, bl := range buckets {
+		key := bl.Key
+		b, ok := s.buckets[key]
+		if !ok && s.maxBuckets > 0 && len(s.buckets) >= s.maxBuckets {
+			b, ok = s.buckets[overflowKey]
+			key = overflowKey
+		}
+		if !ok {
+			b = &bucket{tokens: float64(bl.Limit.Burst), updated: now, limit: bl.Limit}
+			s.buckets[key] = b
+		}
+		if _, ok := need[b]; !ok {
+			b.refill(now)
+		}
+		taken[i] = b
+		need[b]++
+	}
+
+	allowed := true
+	for b, n := range need {
+		if b.tokens < n {
+			allowed = false
+		}
+	}
+
+	var result Result
+	for i, b := range taken {
+		current := Result{Limit: buckets[i].Limit.Burst}
+		if allowed {
+			b.tokens -= need[b]
+			need[b] = 0
+			current.Allowed = true
+		} else if b.tokens < need[b] {
+			current.RetryAfter = duration((need[b] - b.tokens) / buckets[i].Limit.Rate)
+		}
+		current.Remaining = int(b.tokens)
+		current.Reset = duration((float64(buckets[i].Limit.Burst) - b.tokens) / buckets[i].Limit.Rate)
+
+		// the rejecting bucket is reported, otherwise the bucket with less remaining
+		switch {
+		case i == 0:
+			result = current
+		case !allowed:
+			if current.RetryAfter > result.RetryAfter {
+				result = current
+			}
+		case current.Remaining < result.Remaining:
+			result = current
+		}
+	}
+	return result, nil
+}
+
+func duration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
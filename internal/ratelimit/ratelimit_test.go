@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestMemoryStoreMaxBuckets(t *testing.T) {
+	store := NewMemoryStore(2)
+	limit := Limit{Rate: 1, Burst: 2}
+
+	for _, key := range []string{"a", "b"} {
+		if result, _ := store.Take(context.Background(), []Bucket{{key, limit}}); !result.Allowed {
+			t.Errorf("Expected bucket of %s", key)
+		}
+	}
+
+	// store is full, made-up keys share the overflow bucket
+	for i, allowed := range []bool{true, true, false} {
+		if result, _ := store.Take(context.Background(), []Bucket{{"made-up-" + strconv.Itoa(i), limit}}); result.Allowed != allowed {
+			t.Errorf("Request %d expected allowed %v on overflow bucket", i+1, allowed)
+		}
+	}
+	if len(store.buckets) != 3 {
+		t.Errorf("Expected 2 buckets and the overflow bucket, got %d", len(store.buckets))
+	}
+
+	// client which has bucket keep its own
+	if result, _ := store.Take(context.Background(), []Bucket{{"a", limit}}); !result.Allowed {
+		t.Errorf("Expected bucket of a is not shared")
+	}
+}
+
+func TestIPBucket(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(0), Limit{Rate: 1, Burst: 2})
+	l.ip = Limit{Rate: 1, Burst: 3}
+	// verified client stand in for the principal of Authenticate
+	l.client = func(r *http.Request) (string, bool) {
+		return r.Header.Get("X-Client-Key"), true
+	}
+	handler := l.Handler("GET /v1.0/todo", "24", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// each request use another client key from the same IP
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodGet, "/v1.0/todo", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		request.Header.Set("X-Client-Key", "client-"+strconv.Itoa(i))
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != expected {
+			t.Errorf("Request %d expected HTTP %d, not HTTP %d", i+1, expected, responseRecorder.Code)
+		}
+	}
+
+	// other IP has its own bucket
+	request := httptest.NewRequest(http.MethodGet, "/v1.0/todo", nil)
+	request.RemoteAddr = "192.0.2.2:1234"
+	request.Header.Set("X-Client-Key", "client-0")
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, request)
+	if responseRecorder.Code != http.StatusOK {
+		t.Errorf("Expected request of other IP allowed, got HTTP %d", responseRecorder.Code)
+	}
+}
+
+func TestTakeAllOrNothing(t *testing.T) {
+	store := NewMemoryStore(0)
+	ip := Bucket{"ip", Limit{Rate: 1, Burst: 5}}
+	client := Bucket{"client", Limit{Rate: 1, Burst: 1}}
+
+	if result, _ := store.Take(context.Background(), []Bucket{ip, client}); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected allowed and remaining of client bucket, got %+v", result)
+	}
+
+	// rejected on client bucket, ip bucket is not used up
+	for i := 0; i < 3; i++ {
+		if result, _ := store.Take(context.Background(), []Bucket{ip, client}); result.Allowed || result.RetryAfter <= 0 {
+			t.Errorf("Request %d expected rejected with retry after, got %+v", i+2, result)
+		}
+	}
+
+	if tokens := int(store.buckets["ip"].tokens); tokens != 4 {
+		t.Errorf("Expected 4 tokens left on ip bucket, got %d", tokens)
+	}
+}
+
+func TestUnverifiedClient(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(0), Limit{Rate: 1, Burst: 1})
+	l.client = func(r *http.Request) (string, bool) {
+		return "", false
+	}
+	handler := l.Handler("POST /v1.0/access-token", "73", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// X-Client-Key of request which is not authenticated does not choose the bucket
+	for i, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		request.Header.Set("X-Client-Key", "client-"+strconv.Itoa(i))
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != expected {
+			t.Errorf("Request %d expected HTTP %d, not HTTP %d", i+1, expected, responseRecorder.Code)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package refresh
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+// purge expired token at most once per purgeInterval
+const purgeInterval = time.Minute
+
+// Token is state of opaque refresh token. Only hash of the token is kept
+type Token struct {
+	Hash      string
+	Family    string
+	ClientKey string
+	// space separated scope granted to the family
+	Scope string
+	// certificate thumbprint (RFC 8705) of the family, empty when token is not certificate-bound
+	Thumbprint string
+	// access token issued along with the refresh token
+	AccessJTI     string
+	AccessExpired time.Time
+	Used          bool
+	Expired       time.Time
+}
+
+// Store keep refresh tokens. Every token can be used once
+type Store interface {
+	Add(ctx context.Context, token *Token) error
+	// Use mark token as used when valid accept it, and return it as it was before.
+	// valid is only called for unused token, Used is true when the token is reused.
+	// Return nil when token is not found
+	Use(ctx context.Context, hash string, valid func(token *Token) bool) (*Token, error)
+	// UseFamily mark every token of the family as used and return them
+	UseFamily(ctx context.Context, family string) ([]*Token, error)
+}
+
+// New build refresh token store based on Revocation.Store, the same store of revoked access token
+func New(db *sqlx.DB, cfg *config.EnvParams) Store {
+	if cfg.Revocation.Store == "database" {
+		return NewDBStore(db)
+	}
+	return NewMemoryStore()
+}
+
+// MemoryStore keep refresh tokens on process memory
+type MemoryStore struct {
+	mu        sync.Mutex
+	items     map[string]*Token
+	lastPurge time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]*Token{}}
+}
+
+// Add implements Store.
+func (s *MemoryStore) Add(ctx context.Context, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPurge) >= purgeInterval {
+		for hash, t := range s.items {
+			if now.After(t.Expired) {
+				delete(s.items, hash)
+			}
+		}
+		s.lastPurge = now
+	}
+
+	stored := *token
+	s.items[token.Hash] = &stored
+	return nil
+}
+
+// Use implements Store.
+func (s *MemoryStore) Use(ctx context.Context, hash string, valid func(token *Token) bool) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.items[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	before := *token
+	if !token.Used {
+		checked := before
+		token.Used = valid(&checked)
+	}
+	return &before, nil
+}
+
+// UseFamily implements Store.
+func (s *MemoryStore) UseFamily(ctx context.Context, family string) ([]*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp []*Token
+	for _, token := range s.items {
+		if token.Family == family {
+			token.Used = true
+			t := *token
+			resp = append(resp, &t)
+		}
+	}
+	return resp, nil
+}
+
+// DBStore keep refresh tokens on refresh_tokens table, shared by every replica
+type DBStore struct {
+	db *sqlx.DB
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewDBStore(db *sqlx.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Add implements Store.
+func (s *DBStore) Add(ctx context.Context, token *Token) error {
+	tb := &dbs.TableRefreshTokens{
+		TokenHash:         token.Hash,
+		FamilyID:          token.Family,
+		ClientKey:         token.ClientKey,
+		Scope:             token.Scope,
+		Thumbprint:        token.Thumbprint,
+		AccessJTI:         token.AccessJTI,
+		AccessExpiredDate: token.AccessExpired.UTC(),
+		StUsed:            "0",
+		ExpiredDate:       token.Expired.UTC(),
+		CreatedDate:       time.Now().UTC().Truncate(time.Second),
+	}
+	if err := dbs.AddRefreshToken(s.db, ctx, tb); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	purge := time.Since(s.lastPurge) >= purgeInterval
+	if purge {
+		s.lastPurge = time.Now()
+	}
+	s.mu.Unlock()
+
+	// expired token is purged again on the next interval, failure must not fail the request
+	if purge {
+		if err := dbs.PurgeRefreshTokens(s.db, ctx); err != nil {
+			slog.Warn("Purge Refresh Tokens", slog.String("error", err.Error()))
+		}
+	}
+	return nil
+}
+
+// Use implements Store.
+func (s *DBStore) Use(ctx context.Context, hash string, valid func(token *Token) bool) (*Token, error) {
+	tb, err := dbs.UseRefreshToken(s.db, ctx, hash, func(tb *dbs.TableRefreshTokens) bool {
+		return valid(toToken(tb))
+	})
+	if err != nil || tb == nil {
+		return nil, err
+	}
+	return toToken(tb), nil
+}
+
+// UseFamily implements Store.
+func (s *DBStore) UseFamily(ctx context.Context, family string) ([]*Token, error) {
+	tbs, err := dbs.UseRefreshFamily(s.db, ctx, family)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*Token, 0, len(tbs))
+	for _, tb := range tbs {
+		resp = append(resp, toToken(tb))
+	}
+	return resp, nil
+}
+
+func toToken(tb *dbs.TableRefreshTokens) *Token {
+	return &Token{
+		Hash:          tb.TokenHash,
+		Family:        tb.FamilyID,
+		ClientKey:     tb.ClientKey,
+		Scope:         tb.Scope,
+		Thumbprint:    tb.Thumbprint,
+		AccessJTI:     tb.AccessJTI,
+		AccessExpired: tb.AccessExpiredDate,
+		Used:          tb.StUsed == "1",
+		Expired:       tb.ExpiredDate,
+	}
+}
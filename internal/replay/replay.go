@@ -0,0 +1,148 @@
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+// purge expired nonce at most once per purgeInterval
+const purgeInterval = time.Minute
+
+var (
+	ErrTimestamp = errors.New("timestamp is outside of allowed window")
+	ErrReplayed  = errors.New("request was already used")
+)
+
+// Store remember nonce of client until ttl pass.
+// Remember return false when the nonce is already remembered
+type Store interface {
+	Remember(ctx context.Context, clientKey string, nonce string, ttl time.Duration) (bool, error)
+}
+
+// Guard reject request which timestamp is too far from server time,
+// or which nonce (signature) was already used within the window
+type Guard struct {
+	store Store
+	skew  time.Duration
+}
+
+// New build guard based on Security config. Use database nonce store when running multiple replicas
+func New(db *sqlx.DB, cfg *config.EnvParams) *Guard {
+	skew, _ := strconv.Atoi(cfg.Security.TimestampSkew)
+
+	var store Store = NewMemoryStore()
+	if cfg.Security.NonceStore == "database" {
+		store = NewDBStore(db)
+	}
+
+	return NewGuard(store, time.Duration(skew)*time.Second)
+}
+
+func NewGuard(store Store, skew time.Duration) *Guard {
+	return &Guard{store: store, skew: skew}
+}
+
+// CheckTimestamp return ErrTimestamp when ts is more than skew before or after server time
+func (g *Guard) CheckTimestamp(ts time.Time) error {
+	diff := time.Since(ts)
+	if diff > g.skew || diff < -g.skew {
+		return ErrTimestamp
+	}
+	return nil
+}
+
+// Check remember nonce of client and return ErrReplayed when it was already used.
+// Call it only after the request signature is valid, so nonce can not be burned by others
+func (g *Guard) Check(ctx context.Context, clientKey string, nonce string) error {
+	// request older than the window is rejected by CheckTimestamp, so nonce is kept for both side of the window
+	sum := sha256.Sum256([]byte(nonce))
+	fresh, err := g.store.Remember(ctx, clientKey, hex.EncodeToString(sum[:]), 2*g.skew)
+	if err != nil {
+		return err
+	}
+
+	if !fresh {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// MemoryStore remember nonce on process memory
+type MemoryStore struct {
+	mu        sync.Mutex
+	items     map[string]time.Time
+	lastPurge time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]time.Time{}}
+}
+
+// Remember implements Store.
+func (s *MemoryStore) Remember(ctx context.Context, clientKey string, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPurge) >= purgeInterval {
+		for key, exp := range s.items {
+			if now.After(exp) {
+				delete(s.items, key)
+			}
+		}
+		s.lastPurge = now
+	}
+
+	key := clientKey + ":" + nonce
+	if exp, ok := s.items[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+
+	s.items[key] = now.Add(ttl)
+	return true, nil
+}
+
+// DBStore remember nonce on request_nonces table, shared by every replica
+type DBStore struct {
+	db *sqlx.DB
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewDBStore(db *sqlx.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Remember implements Store.
+func (s *DBStore) Remember(ctx context.Context, clientKey string, nonce string, ttl time.Duration) (bool, error) {
+	fresh, err := dbs.RememberNonce(s.db, ctx, clientKey, nonce, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	purge := time.Since(s.lastPurge) >= purgeInterval
+	if purge {
+		s.lastPurge = time.Now()
+	}
+	s.mu.Unlock()
+
+	// expired nonce is purged again on the next interval, failure must not fail the request
+	if purge {
+		if err := dbs.PurgeNonces(s.db, ctx); err != nil {
+			slog.Warn("Purge Nonces", slog.String("error", err.Error()))
+		}
+	}
+	return fresh, nil
+}
@@ -27,6 +27,13 @@ func (h *respHandler) JSON(msg any) {
 	json.NewEncoder(h.w).Encode(msg)
 }
 
+// Raw write body which already encoded, ex: from cache
+func (h *respHandler) Raw(contentType string, body []byte) {
+	h.w.Header().Add("Content-Type", contentType)
+	h.w.WriteHeader(http.StatusOK)
+	h.w.Write(body)
+}
+
 func (h *respHandler) AbortWithJSON(msg *Message) {
 	h.w.Header().Add("Content-Type", "application/json")
 	h.w.WriteHeader(msg.HttpStatus)
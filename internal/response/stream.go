@@ -0,0 +1,98 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	ContentTypeNDJSON = "application/x-ndjson"
+	// flush response to client every N rows
+	flushEvery = 100
+)
+
+// Rows is iterated by Stream. Scan return the current row to be encoded
+type Rows interface {
+	Next() bool
+	Scan() (any, error)
+	Err() error
+}
+
+// Stream encode rows one by one as JSON array, or NDJSON when ndjson is true.
+//
+// Status code is written when the first row is ready, so error before it
+// is responded with failMsg as usual. Once streaming started, status code can not be changed:
+//   - trailer X-Stream-Error is set with failMsg response code
+//   - NDJSON: failMsg is written as the last line
+//   - JSON array: closing bracket is not written, so partial result is never a valid JSON
+func (h *respHandler) Stream(rows Rows, ndjson bool, failMsg *Message) error {
+	ctrl := http.NewResponseController(h.w)
+	enc := json.NewEncoder(h.w)
+	count := 0
+
+	for rows.Next() {
+		row, err := rows.Scan()
+		if err != nil {
+			return h.abortStream(count > 0, ndjson, failMsg, err)
+		}
+
+		if count == 0 {
+			h.startStream(ndjson)
+		} else if !ndjson {
+			h.w.Write([]byte(","))
+		}
+
+		if err := enc.Encode(row); err != nil {
+			// client gone, nothing more can be written
+			return err
+		}
+
+		count++
+		if count%flushEvery == 0 {
+			_ = ctrl.Flush()
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return h.abortStream(count > 0, ndjson, failMsg, err)
+	}
+
+	if count == 0 {
+		h.startStream(ndjson)
+	}
+
+	if !ndjson {
+		h.w.Write([]byte("]\n"))
+	}
+
+	return nil
+}
+
+func (h *respHandler) startStream(ndjson bool) {
+	contentType := "application/json"
+	if ndjson {
+		contentType = ContentTypeNDJSON
+	}
+
+	h.w.Header().Add("Content-Type", contentType)
+	h.w.Header().Add("Trailer", "X-Stream-Error")
+	h.w.WriteHeader(http.StatusOK)
+
+	if !ndjson {
+		h.w.Write([]byte("["))
+	}
+}
+
+func (h *respHandler) abortStream(started bool, ndjson bool, failMsg *Message, err error) error {
+	if !started {
+		h.AbortWithJSON(failMsg)
+		return err
+	}
+
+	h.w.Header().Set("X-Stream-Error", failMsg.ResponseCode)
+	if ndjson {
+		json.NewEncoder(h.w).Encode(failMsg)
+	}
+
+	return err
+}
@@ -0,0 +1,157 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type row struct {
+	ID int `json:"id"`
+}
+
+// fakeRows return count rows. Scan fail on row scanErrAt (1 based) and Err return err after the last row
+type fakeRows struct {
+	count     int
+	scanErrAt int
+	err       error
+	current   int
+}
+
+func (f *fakeRows) Next() bool {
+	if f.current >= f.count {
+		return false
+	}
+	f.current++
+	return true
+}
+
+func (f *fakeRows) Scan() (any, error) {
+	if f.current == f.scanErrAt {
+		return nil, errors.New("scan failed")
+	}
+	return &row{ID: f.current}, nil
+}
+
+func (f *fakeRows) Err() error {
+	return f.err
+}
+
+// flushRecorder count flush of the response
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes++
+	f.ResponseRecorder.Flush()
+}
+
+func TestStream(t *testing.T) {
+	failMsg := BadResponse(http.StatusInternalServerError, "24", "00", "Error Internal Server")
+
+	for _, ts := range []struct {
+		name        string
+		rows        *fakeRows
+		ndjson      bool
+		err         bool
+		statusCode  int
+		contentType string
+		body        string
+		trailer     string
+	}{
+		{
+			name: "Empty JSON", rows: &fakeRows{},
+			statusCode: http.StatusOK, contentType: "application/json", body: "[]\n",
+		},
+		{
+			name: "Empty NDJSON", rows: &fakeRows{}, ndjson: true,
+			statusCode: http.StatusOK, contentType: ContentTypeNDJSON, body: "",
+		},
+		{
+			name: "JSON", rows: &fakeRows{count: 2},
+			statusCode: http.StatusOK, contentType: "application/json", body: "[{\"id\":1}\n,{\"id\":2}\n]\n",
+		},
+		{
+			name: "NDJSON", rows: &fakeRows{count: 2}, ndjson: true,
+			statusCode: http.StatusOK, contentType: ContentTypeNDJSON, body: "{\"id\":1}\n{\"id\":2}\n",
+		},
+		{
+			name: "Scan Error Before First Row", rows: &fakeRows{count: 2, scanErrAt: 1}, err: true,
+			statusCode: http.StatusInternalServerError, contentType: "application/json",
+			body: "{\"responseCode\":\"5002400\",\"responseMessage\":\"Error Internal Server\"}\n",
+		},
+		{
+			name: "Rows Error Before First Row", rows: &fakeRows{err: errors.New("connection lost")}, ndjson: true, err: true,
+			statusCode: http.StatusInternalServerError, contentType: "application/json",
+			body: "{\"responseCode\":\"5002400\",\"responseMessage\":\"Error Internal Server\"}\n",
+		},
+		{
+			name: "Scan Error Mid Stream JSON", rows: &fakeRows{count: 3, scanErrAt: 2}, err: true,
+			statusCode: http.StatusOK, contentType: "application/json",
+			body: "[{\"id\":1}\n", trailer: "5002400",
+		},
+		{
+			name: "Scan Error Mid Stream NDJSON", rows: &fakeRows{count: 3, scanErrAt: 2}, ndjson: true, err: true,
+			statusCode: http.StatusOK, contentType: ContentTypeNDJSON,
+			body: "{\"id\":1}\n{\"responseCode\":\"5002400\",\"responseMessage\":\"Error Internal Server\"}\n", trailer: "5002400",
+		},
+		{
+			name: "Rows Error Mid Stream JSON", rows: &fakeRows{count: 1, err: errors.New("connection lost")}, err: true,
+			statusCode: http.StatusOK, contentType: "application/json",
+			body: "[{\"id\":1}\n", trailer: "5002400",
+		},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			err := Write(rec).Stream(ts.rows, ts.ndjson, failMsg)
+			if (err != nil) != ts.err {
+				t.Errorf("Expected error %v, got %v", ts.err, err)
+			}
+
+			resp := rec.Result()
+			if resp.StatusCode != ts.statusCode {
+				t.Errorf("Expected status code %d, got %d", ts.statusCode, resp.StatusCode)
+			}
+
+			if contentType := resp.Header.Get("Content-Type"); contentType != ts.contentType {
+				t.Errorf("Expected content type '%s', got '%s'", ts.contentType, contentType)
+			}
+
+			if body := rec.Body.String(); body != ts.body {
+				t.Errorf("Expected body %q, got %q", ts.body, body)
+			}
+
+			if trailer := resp.Trailer.Get("X-Stream-Error"); trailer != ts.trailer {
+				t.Errorf("Expected trailer '%s', got '%s'", ts.trailer, trailer)
+			}
+
+			// partial JSON array must never be a valid JSON
+			if ts.trailer != "" && !ts.ndjson && json.Valid(rec.Body.Bytes()) {
+				t.Errorf("Expected invalid JSON on aborted stream, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestStreamFlush(t *testing.T) {
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	count := flushEvery*2 + flushEvery/2
+
+	if err := Write(rec).Stream(&fakeRows{count: count}, true, nil); err != nil {
+		t.Errorf("Stream: %v", err)
+		return
+	}
+
+	if rec.flushes != 2 {
+		t.Errorf("Expected flush every %d rows, got %d flushes for %d rows", flushEvery, rec.flushes, count)
+	}
+
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != count {
+		t.Errorf("Expected %d lines, got %d", count, lines)
+	}
+}
@@ -0,0 +1,107 @@
+package revocation
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/arthben/http_jwt_crud/internal/config"
+	dbs "github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+// purge expired entries at most once per purgeInterval
+const purgeInterval = time.Minute
+
+// Store is denylist of revoked token ID (jti). Entry is kept until the token expires
+type Store interface {
+	Revoke(ctx context.Context, jti string, expired time.Time) error
+	Revoked(ctx context.Context, jti string) (bool, error)
+}
+
+// New build denylist based on Revocation.Store. Use "database" when running multiple replicas
+func New(db *sqlx.DB, cfg *config.EnvParams) Store {
+	if cfg.Revocation.Store == "database" {
+		return NewDBStore(db)
+	}
+	return NewMemoryStore()
+}
+
+// MemoryStore keep denylist on process memory
+type MemoryStore struct {
+	mu        sync.Mutex
+	items     map[string]time.Time
+	lastPurge time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: map[string]time.Time{}}
+}
+
+// Revoke implements Store.
+func (s *MemoryStore) Revoke(ctx context.Context, jti string, expired time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPurge) >= purgeInterval {
+		for key, exp := range s.items {
+			if now.After(exp) {
+				delete(s.items, key)
+			}
+		}
+		s.lastPurge = now
+	}
+
+	s.items[jti] = expired
+	return nil
+}
+
+// Revoked implements Store.
+func (s *MemoryStore) Revoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.items[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+// DBStore keep denylist on revoked_tokens table, shared by every replica
+type DBStore struct {
+	db *sqlx.DB
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func NewDBStore(db *sqlx.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Revoke implements Store.
+func (s *DBStore) Revoke(ctx context.Context, jti string, expired time.Time) error {
+	if err := dbs.AddRevokedToken(s.db, ctx, jti, expired.UTC()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	purge := time.Since(s.lastPurge) >= purgeInterval
+	if purge {
+		s.lastPurge = time.Now()
+	}
+	s.mu.Unlock()
+
+	// expired token is purged again on the next interval, failure must not fail the request
+	if purge {
+		if err := dbs.PurgeRevokedTokens(s.db, ctx); err != nil {
+			slog.Warn("Purge Revoked Tokens", slog.String("error", err.Error()))
+		}
+	}
+	return nil
+}
+
+// Revoked implements Store.
+func (s *DBStore) Revoked(ctx context.Context, jti string) (bool, error) {
+	return dbs.IsRevokedToken(s.db, ctx, jti)
+}
@@ -0,0 +1,133 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var ErrKeyType = errors.New("key type is not supported")
+
+// Key is JWT signing key with the only algorithm it is used for.
+// Private is nil for public key which only verify token
+type Key struct {
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// ParseKey parse PEM private or public key. Empty alg follow the key type
+func ParseKey(raw []byte, alg string) (*Key, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+
+	key := &Key{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = private
+
+	case "EC PRIVATE KEY":
+		private, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = private
+
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Private = private
+
+	case "RSA PUBLIC KEY":
+		public, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = public
+
+	default:
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.Public = public
+	}
+
+	if key.Private != nil {
+		signer, ok := key.Private.(crypto.Signer)
+		if !ok {
+			return nil, ErrKeyType
+		}
+		key.Public = signer.Public()
+	}
+
+	method, err := keyMethod(key.Public, alg)
+	if err != nil {
+		return nil, err
+	}
+	key.Method = method
+
+	return key, nil
+}
+
+// keyMethod return signing method of key. alg must match the key type,
+// so token can never be verified using other algorithm than the key is made for
+func keyMethod(public crypto.PublicKey, alg string) (jwt.SigningMethod, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		if alg == "" {
+			alg = jwt.SigningMethodRS256.Alg()
+		}
+
+		if strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS") {
+			if method := jwt.GetSigningMethod(alg); method != nil {
+				return method, nil
+			}
+		}
+
+	case *ecdsa.PublicKey:
+		// curve decide the algorithm
+		var curveAlg string
+		switch k.Curve {
+		case elliptic.P256():
+			curveAlg = jwt.SigningMethodES256.Alg()
+		case elliptic.P384():
+			curveAlg = jwt.SigningMethodES384.Alg()
+		case elliptic.P521():
+			curveAlg = jwt.SigningMethodES512.Alg()
+		default:
+			return nil, ErrKeyType
+		}
+
+		if alg == "" || alg == curveAlg {
+			return jwt.GetSigningMethod(curveAlg), nil
+		}
+
+	case ed25519.PublicKey:
+		if alg == "" || alg == jwt.SigningMethodEdDSA.Alg() {
+			return jwt.SigningMethodEdDSA, nil
+		}
+
+	default:
+		return nil, ErrKeyType
+	}
+
+	return nil, fmt.Errorf("algorithm %s does not match key type", alg)
+}
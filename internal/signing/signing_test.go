@@ -0,0 +1,86 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func encodePrivate(t *testing.T, key crypto.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func encodePublic(t *testing.T, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	rsaPKCS1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	for _, ts := range []struct {
+		name    string
+		raw     []byte
+		alg     string
+		method  string
+		private bool
+	}{
+		{"RSA Default", rsaPKCS1, "", "RS256", true},
+		{"RSA PS256", encodePrivate(t, rsaKey), "PS256", "PS256", true},
+		{"RSA Public Key", encodePublic(t, &rsaKey.PublicKey), "RS512", "RS512", false},
+		{"EC P-256 Default", encodePrivate(t, p256), "", "ES256", true},
+		{"EC P-384", encodePrivate(t, p384), "ES384", "ES384", true},
+		{"Ed25519 Default", encodePrivate(t, edKey), "", "EdDSA", true},
+		{"Ed25519 Public Key", encodePublic(t, edKey.Public()), "EdDSA", "EdDSA", false},
+
+		{"Failed. Not PEM", []byte("not a key"), "", "", false},
+		{"Failed. Broken PEM", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("broken")}), "", "", false},
+		{"Failed. PS256 On EC Key", encodePrivate(t, p256), "PS256", "", false},
+		{"Failed. ES384 On P-256 Key", encodePrivate(t, p256), "ES384", "", false},
+		{"Failed. EdDSA On RSA Key", rsaPKCS1, "EdDSA", "", false},
+		{"Failed. RS256 On Ed25519 Key", encodePrivate(t, edKey), "RS256", "", false},
+		{"Failed. HS256 On RSA Key", rsaPKCS1, "HS256", "", false},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			key, err := ParseKey(ts.raw, ts.alg)
+			if ts.method == "" {
+				if err == nil {
+					t.Errorf("Expected error, got method %s", key.Method.Alg())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Expected key is parsed, got %v", err)
+				return
+			}
+			if key.Method.Alg() != ts.method {
+				t.Errorf("Expected method %s, got %s", ts.method, key.Method.Alg())
+			}
+			if (key.Private != nil) != ts.private {
+				t.Errorf("Expected private key %v", ts.private)
+			}
+			if key.Public == nil {
+				t.Errorf("Expected public key")
+			}
+		})
+	}
+}
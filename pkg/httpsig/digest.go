@@ -0,0 +1,56 @@
+package httpsig
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+)
+
+var ErrDigest = errors.New("content digest does not match")
+
+// ContentDigest return Content-Digest header value (RFC 9530) of body using sha-256
+func ContentDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=" + serializeBare(sum[:])
+}
+
+// VerifyContentDigest check every supported digest (sha-256, sha-512) on Content-Digest header.
+// At least one supported digest must be sent
+func VerifyContentDigest(header string, body []byte) error {
+	members, err := parseDictionary(header)
+	if err != nil {
+		return err
+	}
+
+	verified := false
+	for _, m := range members {
+		var sum []byte
+		switch m.key {
+		case "sha-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "sha-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			// unknown algorithm is ignored
+			continue
+		}
+
+		digest, ok := m.item.value.([]byte)
+		if m.isList || !ok {
+			return ErrFormat
+		}
+
+		if subtle.ConstantTimeCompare(digest, sum) != 1 {
+			return ErrDigest
+		}
+		verified = true
+	}
+
+	if !verified {
+		return ErrDigest
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package httpsig
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyContentDigest(t *testing.T) {
+	body := []byte(testBody)
+	// sha-256 of RFC 9530 Appendix B
+	sha256Digest := "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"
+
+	if ContentDigest(body) != sha256Digest {
+		t.Errorf("Expected Content-Digest %s, got %s", sha256Digest, ContentDigest(body))
+	}
+
+	for _, ts := range []struct {
+		name   string
+		header string
+		body   []byte
+		err    error
+	}{
+		{"Success. sha-256", sha256Digest, body, nil},
+		{"Success. sha-512", testDigest, body, nil},
+		{"Success. Both", sha256Digest + ", " + testDigest, body, nil},
+		{"Success. Unknown Algorithm Ignored", "md5=:Sd/dVLAcvNLSq16eXua5uQ==:, " + sha256Digest, body, nil},
+
+		{"Failed. Other Body", sha256Digest, []byte(`{"hello": "world!"}`), ErrDigest},
+		{"Failed. Empty Body", testDigest, nil, ErrDigest},
+		{"Failed. One Digest Mismatch", sha256Digest + ", sha-512=:b3RoZXI=:", body, ErrDigest},
+		{"Failed. Truncated Digest", "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9D:", body, ErrDigest},
+		{"Failed. Unknown Algorithm Only", "md5=:Sd/dVLAcvNLSq16eXua5uQ==:", body, ErrDigest},
+		{"Failed. Empty Header", "", body, ErrDigest},
+		{"Failed. Digest Is Not Byte Sequence", `sha-256="X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE="`, body, ErrFormat},
+		{"Failed. Digest Is Inner List", "sha-256=(:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:)", body, ErrFormat},
+		{"Failed. Malformed Header", "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=", body, ErrFormat},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			if err := VerifyContentDigest(ts.header, ts.body); !errors.Is(err, ts.err) {
+				t.Errorf("Expected %v, got %v", ts.err, err)
+			}
+		})
+	}
+}
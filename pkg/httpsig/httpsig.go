@@ -0,0 +1,473 @@
+// Package httpsig verify and create HTTP Message Signatures (RFC 9421)
+// on Signature-Input / Signature header, along with Content-Digest (RFC 9530)
+package httpsig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Algorithms of RFC 9421 section 3.3
+const (
+	AlgHMACSHA256      = "hmac-sha256"
+	AlgRSAV15SHA256    = "rsa-v1_5-sha256"
+	AlgRSAPSSSHA512    = "rsa-pss-sha512"
+	AlgECDSAP256SHA256 = "ecdsa-p256-sha256"
+	AlgECDSAP384SHA384 = "ecdsa-p384-sha384"
+	AlgEd25519         = "ed25519"
+)
+
+var (
+	ErrNoSignature      = errors.New("request has no message signature")
+	ErrComponent        = errors.New("covered component is not supported or not available")
+	ErrMissingComponent = errors.New("required component is not covered")
+	ErrAlgorithm        = errors.New("algorithm does not match the key")
+	ErrExpired          = errors.New("signature is expired")
+	ErrVerify           = errors.New("signature verification failed")
+)
+
+// derived components which can be covered, header fields are covered by lowercase name
+var derived = []string{"@method", "@target-uri", "@authority", "@scheme", "@request-target", "@path", "@query", "@query-param"}
+
+// Params is signature parameters of one signature on Signature-Input
+type Params struct {
+	Label string
+	// covered components in order, ex: "@method", "content-digest", `@query-param;name="id"`
+	Components []string
+	// unix time, zero when not sent
+	Created int64
+	Expires int64
+	KeyID   string
+	Alg     string
+	Nonce   string
+	Tag     string
+}
+
+// ValidComponent report whether component can be covered by signature
+func ValidComponent(component string) bool {
+	it, err := componentItem(component)
+	if err != nil {
+		return false
+	}
+
+	name := it.value.(string)
+	if strings.HasPrefix(name, "@") {
+		return checkComponentParams(it) == nil
+	}
+
+	return len(it.params) == 0 && name != "" && strings.ToLower(name) == name && !strings.ContainsAny(name, " \t\"(),;:")
+}
+
+// Verify verify message signatures of request. The first signature which covers every
+// required component and is verified with key is returned.
+// key is []byte HMAC secret or public key (RSA, ECDSA P-256 / P-384 or Ed25519)
+func Verify(r *http.Request, key any, required []string) (*Params, error) {
+	inputs, err := parseDictionary(strings.Join(r.Header.Values("Signature-Input"), ", "))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inputs) == 0 {
+		return nil, ErrNoSignature
+	}
+
+	signatures, err := parseDictionary(strings.Join(r.Header.Values("Signature"), ", "))
+	if err != nil {
+		return nil, err
+	}
+
+	err = ErrNoSignature
+	for _, input := range inputs {
+		if !input.isList {
+			return nil, ErrFormat
+		}
+
+		idx := slices.IndexFunc(signatures, func(m member) bool { return m.key == input.key })
+		if idx < 0 {
+			continue
+		}
+
+		signature, ok := signatures[idx].item.value.([]byte)
+		if signatures[idx].isList || !ok {
+			return nil, ErrFormat
+		}
+
+		params, errParams := toParams(input)
+		if errParams != nil {
+			return nil, errParams
+		}
+
+		if err = covers(params, required); err != nil {
+			continue
+		}
+
+		if params.Expires > 0 && time.Now().Unix() > params.Expires {
+			err = ErrExpired
+			continue
+		}
+
+		base, errBase := signatureBase(r, input.list, input.item.params)
+		if errBase != nil {
+			err = errBase
+			continue
+		}
+
+		if err = verifyWith(key, params.Alg, []byte(base), signature); err == nil {
+			return params, nil
+		}
+	}
+
+	return nil, err
+}
+
+// Sign add Signature-Input and Signature of params to request.
+// key is []byte HMAC secret or private key (RSA, ECDSA P-256 / P-384 or Ed25519)
+func Sign(r *http.Request, params *Params, key any) error {
+	items := make([]item, 0, len(params.Components))
+	for _, component := range params.Components {
+		it, err := componentItem(component)
+		if err != nil {
+			return err
+		}
+		items = append(items, it)
+	}
+
+	var sigParams []param
+	if params.Created > 0 {
+		sigParams = append(sigParams, param{name: "created", value: params.Created})
+	}
+	if params.Expires > 0 {
+		sigParams = append(sigParams, param{name: "expires", value: params.Expires})
+	}
+	for _, p := range []param{{"nonce", params.Nonce}, {"alg", params.Alg}, {"keyid", params.KeyID}, {"tag", params.Tag}} {
+		if p.value != "" {
+			sigParams = append(sigParams, p)
+		}
+	}
+
+	base, err := signatureBase(r, items, sigParams)
+	if err != nil {
+		return err
+	}
+
+	signature, err := signWith(key, params.Alg, []byte(base))
+	if err != nil {
+		return err
+	}
+
+	r.Header.Add("Signature-Input", params.Label+"="+serializeInnerList(items, sigParams))
+	r.Header.Add("Signature", params.Label+"="+serializeBare(signature))
+	return nil
+}
+
+// componentItem parse component identifier, ex: `@query-param;name="id"`
+func componentItem(component string) (item, error) {
+	name, rest, _ := strings.Cut(component, ";")
+	if rest != "" {
+		rest = ";" + rest
+	}
+
+	p := &parser{s: rest}
+	params, err := p.params()
+	if err != nil || !p.eof() {
+		return item{}, ErrComponent
+	}
+
+	return item{value: name, params: params}, nil
+}
+
+// checkComponentParams allow only name parameter of @query-param
+func checkComponentParams(it item) error {
+	name := it.value.(string)
+	if !slices.Contains(derived, name) && strings.HasPrefix(name, "@") {
+		return ErrComponent
+	}
+
+	if name == "@query-param" {
+		if len(it.params) != 1 || it.params[0].name != "name" {
+			return ErrComponent
+		}
+		if _, ok := it.params[0].value.(string); !ok {
+			return ErrComponent
+		}
+		return nil
+	}
+
+	if len(it.params) > 0 {
+		return ErrComponent
+	}
+	return nil
+}
+
+func toParams(input member) (*Params, error) {
+	params := &Params{Label: input.key}
+	for _, it := range input.list {
+		if _, ok := it.value.(string); !ok {
+			return nil, ErrFormat
+		}
+		params.Components = append(params.Components, it.value.(string)+serializeParams(it.params))
+	}
+
+	for _, p := range input.item.params {
+		switch v := p.value.(type) {
+		case int64:
+			switch p.name {
+			case "created":
+				params.Created = v
+			case "expires":
+				params.Expires = v
+			}
+
+		case string:
+			switch p.name {
+			case "keyid":
+				params.KeyID = v
+			case "alg":
+				params.Alg = v
+			case "nonce":
+				params.Nonce = v
+			case "tag":
+				params.Tag = v
+			}
+		}
+	}
+
+	return params, nil
+}
+
+func covers(params *Params, required []string) error {
+	for _, component := range required {
+		if !slices.Contains(params.Components, component) {
+			return ErrMissingComponent
+		}
+	}
+	return nil
+}
+
+// signatureBase create signature base of RFC 9421 section 2.5
+func signatureBase(r *http.Request, items []item, params []param) (string, error) {
+	var b strings.Builder
+	seen := map[string]bool{}
+
+	for _, it := range items {
+		if err := checkComponentParams(it); err != nil {
+			return "", err
+		}
+
+		identifier := serializeItem(it)
+		if seen[identifier] {
+			return "", ErrFormat
+		}
+		seen[identifier] = true
+
+		value, err := componentValue(r, it)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(identifier + ": " + value + "\n")
+	}
+
+	b.WriteString(`"@signature-params": ` + serializeInnerList(items, params))
+	return b.String(), nil
+}
+
+func componentValue(r *http.Request, it item) (string, error) {
+	switch name := it.value.(string); name {
+	case "@method":
+		return r.Method, nil
+
+	case "@target-uri":
+		return scheme(r) + "://" + strings.ToLower(r.Host) + r.URL.RequestURI(), nil
+
+	case "@authority":
+		return strings.ToLower(r.Host), nil
+
+	case "@scheme":
+		return scheme(r), nil
+
+	case "@request-target":
+		return r.URL.RequestURI(), nil
+
+	case "@path":
+		if path := r.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+
+	case "@query-param":
+		values, err := url.ParseQuery(r.URL.RawQuery)
+		if err != nil {
+			return "", ErrComponent
+		}
+
+		// parameter which is sent more than once is not supported
+		list := values[it.params[0].value.(string)]
+		if len(list) != 1 {
+			return "", ErrComponent
+		}
+		return strings.ReplaceAll(url.QueryEscape(list[0]), "+", "%20"), nil
+
+	default:
+		// Values share the slice of the header, trim a copy
+		values := slices.Clone(r.Header.Values(name))
+		if len(values) == 0 {
+			return "", ErrComponent
+		}
+
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		return strings.Join(values, ", "), nil
+	}
+}
+
+func scheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return strings.ToLower(r.URL.Scheme)
+	}
+
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// verifyWith verify signature with key. Empty alg follow the key type, RSA key is rsa-v1_5-sha256
+func verifyWith(key any, alg string, base []byte, signature []byte) error {
+	switch k := key.(type) {
+	case []byte:
+		if alg != "" && alg != AlgHMACSHA256 {
+			return ErrAlgorithm
+		}
+
+		mac := hmac.New(sha256.New, k)
+		mac.Write(base)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrVerify
+		}
+		return nil
+
+	case *rsa.PublicKey:
+		switch alg {
+		case "", AlgRSAV15SHA256:
+			hashed := sha256.Sum256(base)
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, hashed[:], signature) != nil {
+				return ErrVerify
+			}
+			return nil
+
+		case AlgRSAPSSSHA512:
+			hashed := sha512.Sum512(base)
+			opts := &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512}
+			if rsa.VerifyPSS(k, crypto.SHA512, hashed[:], signature, opts) != nil {
+				return ErrVerify
+			}
+			return nil
+		}
+
+	case *ecdsa.PublicKey:
+		curveAlg, hashed, size := ecdsaHash(k.Curve, base)
+		if curveAlg == "" || (alg != "" && alg != curveAlg) {
+			return ErrAlgorithm
+		}
+
+		// signature is r || s, each padded to the curve size
+		if len(signature) != 2*size {
+			return ErrVerify
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, hashed, r, s) {
+			return ErrVerify
+		}
+		return nil
+
+	case ed25519.PublicKey:
+		if alg != "" && alg != AlgEd25519 {
+			return ErrAlgorithm
+		}
+
+		if !ed25519.Verify(k, base, signature) {
+			return ErrVerify
+		}
+		return nil
+	}
+
+	return ErrAlgorithm
+}
+
+func signWith(key any, alg string, base []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case []byte:
+		if alg != "" && alg != AlgHMACSHA256 {
+			return nil, ErrAlgorithm
+		}
+
+		mac := hmac.New(sha256.New, k)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+
+	case *rsa.PrivateKey:
+		switch alg {
+		case "", AlgRSAV15SHA256:
+			hashed := sha256.Sum256(base)
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hashed[:])
+
+		case AlgRSAPSSSHA512:
+			hashed := sha512.Sum512(base)
+			return rsa.SignPSS(rand.Reader, k, crypto.SHA512, hashed[:], &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512})
+		}
+
+	case *ecdsa.PrivateKey:
+		curveAlg, hashed, size := ecdsaHash(k.Curve, base)
+		if curveAlg == "" || (alg != "" && alg != curveAlg) {
+			return nil, ErrAlgorithm
+		}
+
+		r, s, err := ecdsa.Sign(rand.Reader, k, hashed)
+		if err != nil {
+			return nil, err
+		}
+		return append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...), nil
+
+	case ed25519.PrivateKey:
+		if alg != "" && alg != AlgEd25519 {
+			return nil, ErrAlgorithm
+		}
+		return ed25519.Sign(k, base), nil
+	}
+
+	return nil, ErrAlgorithm
+}
+
+// ecdsaHash return algorithm, hash of base and coordinate size of curve
+func ecdsaHash(curve elliptic.Curve, base []byte) (string, []byte, int) {
+	switch curve {
+	case elliptic.P256():
+		hashed := sha256.Sum256(base)
+		return AlgECDSAP256SHA256, hashed[:], 32
+
+	case elliptic.P384():
+		hashed := sha512.Sum384(base)
+		return AlgECDSAP384SHA384, hashed[:], 48
+	}
+	return "", nil, 0
+}
@@ -0,0 +1,261 @@
+package httpsig
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// keys and request of RFC 9421 Appendix B
+const (
+	testSharedSecret = "uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ=="
+	testBody         = `{"hello": "world"}`
+	testDigest       = "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:"
+)
+
+func testRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/foo?param=Value&Pet=dog", strings.NewReader(testBody))
+	r.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Digest", testDigest)
+	r.Header.Set("Content-Length", "18")
+	return r
+}
+
+func readKey(t *testing.T, name string) []byte {
+	raw, err := os.ReadFile("testdata/" + name + ".pem")
+	if err != nil {
+		t.Fatalf("read key: %v", err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		t.Fatalf("decode key %s", name)
+	}
+	return block.Bytes
+}
+
+// testKeyRSAPSS parse test-key-rsa-pss, x509 does not parse PKCS#8 of RSASSA-PSS
+func testKeyRSAPSS(t *testing.T) *rsa.PrivateKey {
+	var pkcs8 struct {
+		Version    int
+		Algo       pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}
+	if _, err := asn1.Unmarshal(readKey(t, "test-key-rsa-pss"), &pkcs8); err != nil {
+		t.Fatalf("parse test-key-rsa-pss: %v", err)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(pkcs8.PrivateKey)
+	if err != nil {
+		t.Fatalf("parse test-key-rsa-pss: %v", err)
+	}
+	return key
+}
+
+func testKeyECCP256(t *testing.T) *ecdsa.PrivateKey {
+	key, err := x509.ParseECPrivateKey(readKey(t, "test-key-ecc-p256"))
+	if err != nil {
+		t.Fatalf("parse test-key-ecc-p256: %v", err)
+	}
+	return key
+}
+
+func testKeyEd25519(t *testing.T) ed25519.PrivateKey {
+	key, err := x509.ParsePKCS8PrivateKey(readKey(t, "test-key-ed25519"))
+	if err != nil {
+		t.Fatalf("parse test-key-ed25519: %v", err)
+	}
+	return key.(ed25519.PrivateKey)
+}
+
+func TestVectors(t *testing.T) {
+	secret, _ := base64.StdEncoding.DecodeString(testSharedSecret)
+	rsaKey := testKeyRSAPSS(t)
+	ecKey := testKeyECCP256(t)
+	edKey := testKeyEd25519(t)
+
+	for _, ts := range []struct {
+		name      string
+		alg       string
+		key       any
+		input     string
+		signature string
+		base      string
+		// alg follow the key, RSA key without alg parameter is rsa-v1_5-sha256
+		verify bool
+	}{
+		{
+			name:      "B.2.1 Minimal Signature Using rsa-pss-sha512",
+			alg:       AlgRSAPSSSHA512,
+			key:       &rsaKey.PublicKey,
+			input:     `sig-b21=();created=1618884473;keyid="test-key-rsa-pss";nonce="b3k2pp5k7z-50gnwp.yemd"`,
+			signature: "sig-b21=:d2pmTvmbncD3xQm8E9ZV2828BjQWGgiwAaw5bAkgibUopemLJcWDy/lkbbHAve4cRAtx31Iq786U7it++wgGxbtRxf8Udx7zFZsckzXaJMkA7ChG52eSkFxykJeNqsrWH5S+oxNFlD4dzVuwe8DhTSja8xxbR/Z2cOGdCbzR72rgFWhzx2VjBqJzsPLMIQKhO4DGezXehhWwE56YCE+O6c0mKZsfxVrogUvA4HELjVKWmAvtl6UnCh8jYzuVG5WSb/QEVPnP5TmcAnLH1g+s++v6d4s8m0gCw1fV5/SITLq9mhho8K3+7EPYTU8IU1bLhdxO5Nyt8C8ssinQ98Xw9Q==:",
+			base:      `"@signature-params": ();created=1618884473;keyid="test-key-rsa-pss";nonce="b3k2pp5k7z-50gnwp.yemd"`,
+		},
+		{
+			name:      "B.2.2 Selective Covered Components Using rsa-pss-sha512",
+			alg:       AlgRSAPSSSHA512,
+			key:       &rsaKey.PublicKey,
+			input:     `sig-b22=("@authority" "content-digest" "@query-param";name="Pet");created=1618884473;keyid="test-key-rsa-pss";tag="header-example"`,
+			signature: "sig-b22=:LjbtqUbfmvjj5C5kr1Ugj4PmLYvx9wVjZvD9GsTT4F7GrcQEdJzgI9qHxICagShLRiLMlAJjtq6N4CDfKtjvuJyE5qH7KT8UCMkSowOB4+ECxCmT8rtAmj/0PIXxi0A0nxKyB09RNrCQibbUjsLS/2YyFYXEu4TRJQzRw1rLEuEfY17SARYhpTlaqwZVtR8NV7+4UKkjqpcAoFqWFQh62s7Cl+H2fjBSpqfZUJcsIk4N6wiKYd4je2U/lankenQ99PZfB4jY3I5rSV2DSBVkSFsURIjYErOs0tFTQosMTAoxk//0RoKUqiYY8Bh0aaUEb0rQl3/XaVe4bXTugEjHSw==:",
+			base: `"@authority": example.com
+"content-digest": ` + testDigest + `
+"@query-param";name="Pet": dog
+"@signature-params": ("@authority" "content-digest" "@query-param";name="Pet");created=1618884473;keyid="test-key-rsa-pss";tag="header-example"`,
+		},
+		{
+			name:      "B.2.5 Signing a Request Using hmac-sha256",
+			alg:       AlgHMACSHA256,
+			key:       secret,
+			input:     `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`,
+			signature: "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:",
+			base: `"date": Tue, 20 Apr 2021 02:07:55 GMT
+"@authority": example.com
+"content-type": application/json
+"@signature-params": ("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`,
+			verify: true,
+		},
+		{
+			name:      "B.2.6 Signing a Request Using ed25519",
+			alg:       AlgEd25519,
+			key:       edKey.Public(),
+			input:     `sig-b26=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`,
+			signature: "sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:",
+			base: `"date": Tue, 20 Apr 2021 02:07:55 GMT
+"@method": POST
+"@path": /foo
+"@authority": example.com
+"content-type": application/json
+"content-length": 18
+"@signature-params": ("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`,
+			verify: true,
+		},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			r := testRequest()
+			r.Header.Set("Signature-Input", ts.input)
+			r.Header.Set("Signature", ts.signature)
+
+			inputs, err := parseDictionary(ts.input)
+			if err != nil || len(inputs) != 1 {
+				t.Fatalf("parse Signature-Input: %v", err)
+			}
+			base, err := signatureBase(r, inputs[0].list, inputs[0].item.params)
+			if err != nil || base != ts.base {
+				t.Fatalf("Expected signature base\n%s\ngot %v\n%s", ts.base, err, base)
+			}
+
+			signatures, _ := parseDictionary(ts.signature)
+			signature := signatures[0].item.value.([]byte)
+			if err := verifyWith(ts.key, ts.alg, []byte(base), signature); err != nil {
+				t.Errorf("Expected signature verified, got %v", err)
+			}
+
+			if ts.verify {
+				if _, err := Verify(r, ts.key, nil); err != nil {
+					t.Errorf("Expected request verified, got %v", err)
+				}
+
+				// covered component is changed
+				r.Header.Set("Content-Type", "text/plain")
+				if _, err := Verify(r, ts.key, nil); !errors.Is(err, ErrVerify) {
+					t.Errorf("Expected tampered request is rejected, got %v", err)
+				}
+			}
+		})
+	}
+
+	// B.2.4 sign a response, only the signature base of a request is supported
+	t.Run("B.2.4 Signing a Response Using ecdsa-p256-sha256", func(t *testing.T) {
+		base := `"@status": 200
+"content-type": application/json
+"content-digest": sha-512=:mEWXIS7MaLRuGgxOBdODa3xqM1XdEvxoYhvlCFJ41QJgJc4GTsPp29l5oGX69wWdXymyU0rjJuahq4l5aGgfLQ==:
+"content-length": 23
+"@signature-params": ("@status" "content-type" "content-digest" "content-length");created=1618884473;keyid="test-key-ecc-p256"`
+		signature, _ := base64.StdEncoding.DecodeString("wNmSUAhwb5LxtOtOpNa6W5xj067m5hFrj0XQ4fvpaCLx0NKocgPquLgyahnzDnDAUy5eCdlYUEkLIj+32oiasw==")
+
+		if err := verifyWith(&ecKey.PublicKey, AlgECDSAP256SHA256, []byte(base), signature); err != nil {
+			t.Errorf("Expected signature verified, got %v", err)
+		}
+		if err := verifyWith(&ecKey.PublicKey, AlgECDSAP384SHA384, []byte(base), signature); !errors.Is(err, ErrAlgorithm) {
+			t.Errorf("Expected algorithm of other curve is rejected, got %v", err)
+		}
+	})
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey := testKeyRSAPSS(t)
+	ecKey := testKeyECCP256(t)
+	edKey := testKeyEd25519(t)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	secret, _ := base64.StdEncoding.DecodeString(testSharedSecret)
+
+	components := []string{"@method", "@path", "@query", "@authority", `@query-param;name="Pet"`, "content-type", "content-digest"}
+	for _, ts := range []struct {
+		alg     string
+		private any
+		public  any
+	}{
+		{AlgHMACSHA256, secret, secret},
+		{AlgRSAV15SHA256, rsaKey, &rsaKey.PublicKey},
+		{AlgRSAPSSSHA512, rsaKey, &rsaKey.PublicKey},
+		{AlgECDSAP256SHA256, ecKey, &ecKey.PublicKey},
+		{AlgECDSAP384SHA384, p384, &p384.PublicKey},
+		{AlgEd25519, edKey, edKey.Public()},
+	} {
+		t.Run(ts.alg, func(t *testing.T) {
+			r := testRequest()
+			params := &Params{Label: "sig1", Components: components, Created: 1618884473, KeyID: "test", Alg: ts.alg}
+			if err := Sign(r, params, ts.private); err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			verified, err := Verify(r, ts.public, []string{"@method", "content-digest"})
+			if err != nil {
+				t.Fatalf("Expected request verified, got %v", err)
+			}
+			if verified.Alg != ts.alg || verified.KeyID != "test" || strings.Join(verified.Components, " ") != strings.Join(components, " ") {
+				t.Errorf("Expected signed params, got %+v", verified)
+			}
+
+			if _, err := Verify(r, ts.public, []string{"content-length"}); !errors.Is(err, ErrMissingComponent) {
+				t.Errorf("Expected required component not covered, got %v", err)
+			}
+
+			r.URL.RawQuery = "param=Value&Pet=cat"
+			if _, err := Verify(r, ts.public, nil); !errors.Is(err, ErrVerify) {
+				t.Errorf("Expected tampered query is rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyHeaderValue(t *testing.T) {
+	secret, _ := base64.StdEncoding.DecodeString(testSharedSecret)
+	r := testRequest()
+	r.Header["X-Example"] = []string{"  one ", "two  "}
+
+	if err := Sign(r, &Params{Label: "sig1", Components: []string{"x-example"}}, secret); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := Verify(r, secret, nil); err != nil {
+		t.Errorf("Expected request verified, got %v", err)
+	}
+
+	// value is trimmed on the signature base only
+	if values := r.Header.Values("X-Example"); values[0] != "  one " || values[1] != "two  " {
+		t.Errorf("Expected header is not modified, got %q", values)
+	}
+}
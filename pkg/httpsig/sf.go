@@ -0,0 +1,324 @@
+package httpsig
+
+// Minimal structured field values (RFC 8941), only what Signature-Input,
+// Signature and Content-Digest need: dictionary of inner lists or byte sequences
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrFormat = errors.New("invalid structured field")
+
+// token is structured field token, serialized without quotes
+type token string
+
+type param struct {
+	name  string
+	value any
+}
+
+type item struct {
+	value  any
+	params []param
+}
+
+// member is dictionary member, list is nil when member is bare item
+type member struct {
+	key    string
+	item   item
+	list   []item
+	isList bool
+}
+
+type parser struct {
+	s string
+	i int
+}
+
+func parseDictionary(s string) ([]member, error) {
+	p := &parser{s: s}
+	p.skipSP()
+
+	var members []member
+	for !p.eof() {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+
+		m := member{key: key}
+		if p.peek() == '=' {
+			p.i++
+			if p.peek() == '(' {
+				m.isList = true
+				if m.list, m.item.params, err = p.innerList(); err != nil {
+					return nil, err
+				}
+			} else if m.item, err = p.item(); err != nil {
+				return nil, err
+			}
+		} else {
+			// member without value is boolean true
+			m.item.value = true
+			if m.item.params, err = p.params(); err != nil {
+				return nil, err
+			}
+		}
+		members = append(members, m)
+
+		p.skipOWS()
+		if p.eof() {
+			break
+		}
+		if p.peek() != ',' {
+			return nil, ErrFormat
+		}
+		p.i++
+		p.skipOWS()
+		if p.eof() {
+			return nil, ErrFormat
+		}
+	}
+
+	return members, nil
+}
+
+func (p *parser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *parser) skipSP() {
+	for p.peek() == ' ' {
+		p.i++
+	}
+}
+
+func (p *parser) skipOWS() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.i++
+	}
+}
+
+func (p *parser) key() (string, error) {
+	c := p.peek()
+	if !(c >= 'a' && c <= 'z') && c != '*' {
+		return "", ErrFormat
+	}
+
+	start := p.i
+	for !p.eof() {
+		c := p.peek()
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && !strings.ContainsRune("_-.*", rune(c)) {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *parser) innerList() ([]item, []param, error) {
+	// skip "("
+	p.i++
+
+	var items []item
+	for {
+		p.skipSP()
+		if p.eof() {
+			return nil, nil, ErrFormat
+		}
+
+		if p.peek() == ')' {
+			p.i++
+			params, err := p.params()
+			return items, params, err
+		}
+
+		it, err := p.item()
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, it)
+
+		if c := p.peek(); c != ' ' && c != ')' {
+			return nil, nil, ErrFormat
+		}
+	}
+}
+
+func (p *parser) item() (item, error) {
+	value, err := p.bareItem()
+	if err != nil {
+		return item{}, err
+	}
+
+	params, err := p.params()
+	return item{value: value, params: params}, err
+}
+
+func (p *parser) params() ([]param, error) {
+	var params []param
+	for p.peek() == ';' {
+		p.i++
+		p.skipSP()
+
+		name, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+
+		var value any = true
+		if p.peek() == '=' {
+			p.i++
+			if value, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params = append(params, param{name: name, value: value})
+	}
+	return params, nil
+}
+
+func (p *parser) bareItem() (any, error) {
+	c := p.peek()
+	switch {
+	case c == '"':
+		return p.string()
+
+	case c == ':':
+		return p.byteSequence()
+
+	case c == '?':
+		p.i++
+		switch p.peek() {
+		case '1':
+			p.i++
+			return true, nil
+		case '0':
+			p.i++
+			return false, nil
+		}
+		return nil, ErrFormat
+
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.i
+		p.i++
+		for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+			p.i++
+		}
+		return strconv.ParseInt(p.s[start:p.i], 10, 64)
+
+	case c == '*' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		start := p.i
+		for !p.eof() {
+			c := p.peek()
+			if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),;<=>?@[\]{}`, rune(c)) {
+				break
+			}
+			p.i++
+		}
+		return token(p.s[start:p.i]), nil
+	}
+
+	return nil, ErrFormat
+}
+
+func (p *parser) string() (string, error) {
+	// skip opening quote
+	p.i++
+
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.i]
+		p.i++
+
+		switch {
+		case c == '\\':
+			if p.eof() || (p.peek() != '"' && p.peek() != '\\') {
+				return "", ErrFormat
+			}
+			b.WriteByte(p.s[p.i])
+			p.i++
+
+		case c == '"':
+			return b.String(), nil
+
+		case c < 0x20 || c >= 0x7f:
+			return "", ErrFormat
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", ErrFormat
+}
+
+func (p *parser) byteSequence() ([]byte, error) {
+	// skip opening colon
+	p.i++
+
+	end := strings.IndexByte(p.s[p.i:], ':')
+	if end < 0 {
+		return nil, ErrFormat
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(p.s[p.i : p.i+end])
+	if err != nil {
+		return nil, ErrFormat
+	}
+	p.i += end + 1
+	return raw, nil
+}
+
+// serializeItem serialize bare item with its parameters
+func serializeItem(it item) string {
+	return serializeBare(it.value) + serializeParams(it.params)
+}
+
+func serializeInnerList(items []item, params []param) string {
+	values := make([]string, 0, len(items))
+	for _, it := range items {
+		values = append(values, serializeItem(it))
+	}
+	return "(" + strings.Join(values, " ") + ")" + serializeParams(params)
+}
+
+func serializeParams(params []param) string {
+	var b strings.Builder
+	for _, p := range params {
+		b.WriteString(";" + p.name)
+		if v, ok := p.value.(bool); ok && v {
+			continue
+		}
+		b.WriteString("=" + serializeBare(p.value))
+	}
+	return b.String()
+}
+
+func serializeBare(value any) string {
+	switch v := value.(type) {
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	case token:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		if v {
+			return "?1"
+		}
+		return "?0"
+	case []byte:
+		return ":" + base64.StdEncoding.EncodeToString(v) + ":"
+	}
+	return ""
+}
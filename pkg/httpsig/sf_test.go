@@ -0,0 +1,65 @@
+package httpsig
+
+import (
+	"testing"
+)
+
+func TestParseDictionary(t *testing.T) {
+	members, err := parseDictionary(`sig1=("@method" "@query-param";name="id");created=1618884473;keyid="test", sig2=:AQID:, flag;a=?0`)
+	if err != nil || len(members) != 3 {
+		t.Fatalf("Expected 3 members, got %d %v", len(members), err)
+	}
+
+	sig1 := members[0]
+	if !sig1.isList || len(sig1.list) != 2 || sig1.list[1].params[0].value != "id" || sig1.item.params[0].value != int64(1618884473) {
+		t.Errorf("Expected inner list with params, got %+v", sig1)
+	}
+	if value, ok := members[1].item.value.([]byte); !ok || string(value) != "\x01\x02\x03" {
+		t.Errorf("Expected byte sequence, got %+v", members[1])
+	}
+	if members[2].item.value != true || members[2].item.params[0].value != false {
+		t.Errorf("Expected boolean member with boolean param, got %+v", members[2])
+	}
+
+	for _, s := range []string{
+		`sig1=("@method"`,
+		`sig1=:not base64:`,
+		`sig1="unterminated`,
+		`Sig1=:AQID:`,
+		`sig1=:AQID: sig2=:AQID:`,
+		`sig1=:AQID:,`,
+	} {
+		if _, err := parseDictionary(s); err == nil {
+			t.Errorf("Expected %q is rejected", s)
+		}
+	}
+}
+
+func FuzzParseDictionary(f *testing.F) {
+	for _, seed := range []string{
+		`sig-b21=();created=1618884473;keyid="test-key-rsa-pss";nonce="b3k2pp5k7z-50gnwp.yemd"`,
+		`sig-b22=("@authority" "content-digest" "@query-param";name="Pet");created=1618884473;keyid="test-key-rsa-pss";tag="header-example"`,
+		`sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:`,
+		testDigest,
+		`a=1, b=-2.5;x, c=?1, d=tok/en, e="say \"hi\""`,
+		``,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		members, err := parseDictionary(s)
+		if err != nil {
+			return
+		}
+
+		for _, m := range members {
+			if m.key == "" {
+				t.Errorf("Expected member key, got %+v", m)
+			}
+			if !m.isList && m.list != nil {
+				t.Errorf("Expected bare item without list, got %+v", m)
+			}
+		}
+	})
+}
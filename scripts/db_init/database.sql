@@ -1,11 +1,84 @@
 USE db_todo;
 CREATE TABLE todos (
 	id varchar(64),
-	title varchar(256),
+	title varchar(1536),
 	detail text,
 	created_date timestamp,
 	updated_date timestamp,
 	st_completed char(1),
 	completed_date timestamp,
+	key_id varchar(64) not null default '',
+	data_key varchar(128) not null default '',
+	enc_title char(1) not null default '0',
 	primary key(id)
 ) engine=Innodb;
+
+CREATE TABLE todos_archive (
+	id varchar(64),
+	title varchar(1536),
+	detail text,
+	created_date timestamp,
+	updated_date timestamp,
+	st_completed char(1),
+	completed_date timestamp,
+	key_id varchar(64) not null default '',
+	data_key varchar(128) not null default '',
+	enc_title char(1) not null default '0',
+	archived_date timestamp,
+	primary key(id)
+) engine=Innodb;
+
+CREATE TABLE clients (
+	client_key varchar(64),
+	secret varchar(512) not null,
+	key_id varchar(64) not null default '',
+	data_key varchar(128) not null default '',
+	public_key text not null,
+	status varchar(16) not null default 'active',
+	scopes varchar(512) not null default '',
+	signature_method varchar(16) not null default 'hmac',
+	signature_components varchar(512) not null default '',
+	tls_auth varchar(16) not null default 'none',
+	cert_fingerprint varchar(64) not null default '',
+	cert_subject varchar(512) not null default '',
+	created_date timestamp default current_timestamp,
+	updated_date timestamp default current_timestamp,
+	primary key(client_key)
+) engine=Innodb;
+
+CREATE TABLE revoked_tokens (
+	jti varchar(64),
+	expired_date timestamp not null,
+	primary key(jti)
+) engine=Innodb;
+
+CREATE TABLE refresh_tokens (
+	token_hash varchar(64),
+	family_id varchar(64) not null,
+	client_key varchar(64) not null,
+	scope varchar(512) not null default '',
+	thumbprint varchar(64) not null default '',
+	access_jti varchar(64) not null,
+	access_expired_date timestamp not null,
+	st_used char(1) not null default '0',
+	expired_date timestamp not null,
+	created_date timestamp default current_timestamp,
+	primary key(token_hash),
+	key(family_id)
+) engine=Innodb;
+
+CREATE TABLE request_nonces (
+	client_key varchar(64),
+	nonce varchar(64),
+	expired_date timestamp not null,
+	primary key(client_key, nonce)
+) engine=Innodb;
+
+CREATE TABLE lockouts (
+	lock_key varchar(128),
+	failures int not null default 0,
+	level int not null default 0,
+	last_failure timestamp not null,
+	locked_until timestamp null,
+	primary key(lock_key)
+) engine=Innodb;
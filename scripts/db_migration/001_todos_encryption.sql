@@ -0,0 +1,8 @@
+USE db_todo;
+-- encryption at rest, for database created before todos has key_id, data_key and enc_title.
+-- existing rows stay plaintext ( key_id '' ) until 'reencrypt' command is run
+ALTER TABLE todos
+	MODIFY title varchar(1536),
+	ADD COLUMN key_id varchar(64) not null default '' AFTER completed_date,
+	ADD COLUMN data_key varchar(128) not null default '' AFTER key_id,
+	ADD COLUMN enc_title char(1) not null default '0' AFTER data_key;
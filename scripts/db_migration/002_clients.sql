@@ -0,0 +1,13 @@
+USE db_todo;
+-- client registry, for database created before clients table.
+-- until it exists, only clients file and client on config are accepted
+CREATE TABLE IF NOT EXISTS clients (
+	client_key varchar(64),
+	secret varchar(512) not null,
+	public_key text not null,
+	status varchar(16) not null default 'active',
+	scopes varchar(512) not null default '',
+	created_date timestamp default current_timestamp,
+	updated_date timestamp default current_timestamp,
+	primary key(client_key)
+) engine=Innodb;
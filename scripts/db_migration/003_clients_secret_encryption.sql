@@ -0,0 +1,6 @@
+USE db_todo;
+-- client secret encryption, for database created before clients has key_id and data_key.
+-- existing secrets stay plaintext ( key_id '' ) until 'reencrypt' command is run
+ALTER TABLE clients
+	ADD COLUMN key_id varchar(64) not null default '' AFTER secret,
+	ADD COLUMN data_key varchar(128) not null default '' AFTER key_id;
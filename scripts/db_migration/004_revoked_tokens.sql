@@ -0,0 +1,8 @@
+USE db_todo;
+-- denylist of revoked access token, only used with REVOCATION_STORE=database.
+-- row is kept until the token expires
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti varchar(64),
+	expired_date timestamp not null,
+	primary key(jti)
+) engine=Innodb;
@@ -0,0 +1,16 @@
+USE db_todo;
+-- rotating refresh token, only used with REVOCATION_STORE=database.
+-- thumbprint keep certificate binding (RFC 8705) of the family on refresh
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token_hash varchar(64),
+	family_id varchar(64) not null,
+	client_key varchar(64) not null,
+	thumbprint varchar(64) not null default '',
+	access_jti varchar(64) not null,
+	access_expired_date timestamp not null,
+	st_used char(1) not null default '0',
+	expired_date timestamp not null,
+	created_date timestamp default current_timestamp,
+	primary key(token_hash),
+	key(family_id)
+) engine=Innodb;
@@ -0,0 +1,5 @@
+USE db_todo;
+-- scope granted to the refresh token family, refresh can only narrow it.
+-- token issued before has no scope, client need a new client_credentials grant to get scoped token
+ALTER TABLE refresh_tokens
+	ADD COLUMN scope varchar(512) not null default '' AFTER client_key;
@@ -0,0 +1,17 @@
+USE db_todo;
+-- archive of completed todo, for database created before todo archiving.
+-- table is filled by the archiver when Archive.Enabled is true
+CREATE TABLE IF NOT EXISTS todos_archive (
+	id varchar(64),
+	title varchar(1536),
+	detail text,
+	created_date timestamp,
+	updated_date timestamp,
+	st_completed char(1),
+	completed_date timestamp,
+	key_id varchar(64) not null default '',
+	data_key varchar(128) not null default '',
+	enc_title char(1) not null default '0',
+	archived_date timestamp,
+	primary key(id)
+) engine=Innodb;
@@ -0,0 +1,9 @@
+USE db_todo;
+-- nonce of signed request, only used with SECURITY_NONCE_STORE=database.
+-- row is kept until the timestamp window is over
+CREATE TABLE IF NOT EXISTS request_nonces (
+	client_key varchar(64),
+	nonce varchar(64),
+	expired_date timestamp not null,
+	primary key(client_key, nonce)
+) engine=Innodb;
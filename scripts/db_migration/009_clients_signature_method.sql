@@ -0,0 +1,5 @@
+USE db_todo;
+-- service signature method of client, for database created before clients has signature_method.
+-- existing clients keep HMAC signature
+ALTER TABLE clients
+	ADD COLUMN signature_method varchar(16) not null default 'hmac' AFTER scopes;
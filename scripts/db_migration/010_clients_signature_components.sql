@@ -0,0 +1,5 @@
+USE db_todo;
+-- components which message signature must cover, for database created before clients has signature_components.
+-- empty is the default components
+ALTER TABLE clients
+	ADD COLUMN signature_components varchar(512) not null default '' AFTER signature_method;
@@ -0,0 +1,11 @@
+USE db_todo;
+-- failure counter of client authentication, only used with LOCKOUT_STORE=database.
+-- row is kept until the key is quiet for the lockout window
+CREATE TABLE IF NOT EXISTS lockouts (
+	lock_key varchar(128),
+	failures int not null default 0,
+	level int not null default 0,
+	last_failure timestamp not null,
+	locked_until timestamp null,
+	primary key(lock_key)
+) engine=Innodb;
@@ -0,0 +1,7 @@
+USE db_todo;
+-- client certificate (mTLS) of token endpoint, for database created before clients has tls_auth.
+-- none is the default, client authenticate with X-Signature only
+ALTER TABLE clients
+	ADD COLUMN tls_auth varchar(16) not null default 'none' AFTER signature_components,
+	ADD COLUMN cert_fingerprint varchar(64) not null default '' AFTER tls_auth,
+	ADD COLUMN cert_subject varchar(512) not null default '' AFTER cert_fingerprint;
@@ -2,38 +2,55 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/arthben/http_jwt_crud/api/auth"
 	"github.com/arthben/http_jwt_crud/api/handlers"
 	"github.com/arthben/http_jwt_crud/api/todo"
+	"github.com/arthben/http_jwt_crud/internal/clients"
 	"github.com/arthben/http_jwt_crud/internal/config"
 	"github.com/arthben/http_jwt_crud/internal/database"
+	"github.com/arthben/http_jwt_crud/internal/encryption"
+	"github.com/arthben/http_jwt_crud/internal/lockout"
+	"github.com/arthben/http_jwt_crud/internal/replay"
 	"github.com/arthben/http_jwt_crud/internal/response"
+	"github.com/arthben/http_jwt_crud/pkg/httpsig"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 )
 
 const (
 	chars    = "ABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
-	TSLayout = "2006-01-02T15:04:05+07:00"
+	TSLayout = time.RFC3339Nano
 )
 
 var (
@@ -67,6 +84,18 @@ func TestGetToken(t *testing.T) {
 			expectRespCode: "2007300",
 			statusCode:     http.StatusOK,
 		},
+		{
+			name:    "Success. Timestamp with other offset and millisecond",
+			payload: payload,
+			header: &auth.TokenHeader{
+				ContentType: "application/json",
+				ClientKey:   cfg.Client.Key,
+				Timestamp:   now.In(time.FixedZone("", -5*60*60)).Format("2006-01-02T15:04:05.000Z07:00"),
+				Signature:   "", // will be generate
+			},
+			expectRespCode: "2007300",
+			statusCode:     http.StatusOK,
+		},
 		{
 			name:    "Failed. Empty Body",
 			payload: &auth.TokenRequest{},
@@ -151,6 +180,7 @@ func TestGetToken(t *testing.T) {
 			request.Header.Add("X-CLIENT-KEY", ts.header.ClientKey)
 			request.Header.Add("X-TIMESTAMP", ts.header.Timestamp)
 			request.Header.Add("X-SIGNATURE", signature)
+			request.Header.Add("X-EXTERNAL-ID", externalID())
 			responseRecorder := httptest.NewRecorder()
 
 			authSerice := handlers.NewHandlers(db, cfg)
@@ -177,8 +207,9 @@ func TestAddTodo(t *testing.T) {
 	now := time.Now()
 	endpoint := "/v1.0/todo"
 	srv := handlers.NewHandlers(db, cfg)
+	router, _ := srv.BuildRouter()
 
-	accessToken, err := getToken(srv, now.Format(TSLayout))
+	accessToken, err := getToken(srv, timestamp())
 	if err != nil {
 		t.Error("Failed Get Access Token")
 		return
@@ -306,9 +337,10 @@ func TestAddTodo(t *testing.T) {
 			request.Header.Add("X-CLIENT-KEY", ts.header.ClientKey)
 			request.Header.Add("X-TIMESTAMP", ts.header.Timestamp)
 			request.Header.Add("X-SIGNATURE", signature)
+			request.Header.Add("X-EXTERNAL-ID", externalID())
 			responseRecorder := httptest.NewRecorder()
 
-			srv.NewTodo(responseRecorder, request)
+			router.ServeHTTP(responseRecorder, request)
 			if responseRecorder.Code != ts.statusCode {
 				t.Errorf("Expected status code %d, not HTTP %d", ts.statusCode, responseRecorder.Code)
 				return
@@ -329,8 +361,9 @@ func TestAddTodo(t *testing.T) {
 func TestGetTodo(t *testing.T) {
 	now := time.Now()
 	srv := handlers.NewHandlers(db, cfg)
+	router, _ := srv.BuildRouter()
 
-	accessToken, err := getToken(srv, now.Format(TSLayout))
+	accessToken, err := getToken(srv, timestamp())
 	if err != nil {
 		t.Error("Failed Get Access Token")
 		return
@@ -340,6 +373,8 @@ func TestGetTodo(t *testing.T) {
 		name           string
 		header         *todo.RequestHeader
 		todoID         string
+		query          string
+		accept         string
 		expectRespCode string
 		statusCode     int
 	}{
@@ -350,7 +385,7 @@ func TestGetTodo(t *testing.T) {
 				Authorization: "Bearer " + accessToken,
 				ClientKey:     cfg.Client.Key,
 				Timestamp:     now.Format(TSLayout),
-				Signature:     "signature",
+				Signature:     "",
 			},
 			todoID:         "",
 			expectRespCode: "2002400",
@@ -363,12 +398,68 @@ func TestGetTodo(t *testing.T) {
 				Authorization: "Bearer " + accessToken,
 				ClientKey:     cfg.Client.Key,
 				Timestamp:     now.Format(TSLayout),
-				Signature:     "signature",
+				Signature:     "",
 			},
 			todoID:         "uuid",
 			expectRespCode: "2002400",
 			statusCode:     http.StatusOK,
 		},
+		{
+			name: "Success. Get Archived Todos",
+			header: &todo.RequestHeader{
+				ContentType:   "application/json",
+				Authorization: "Bearer " + accessToken,
+				ClientKey:     cfg.Client.Key,
+				Timestamp:     now.Format(TSLayout),
+				Signature:     "",
+			},
+			todoID:         "",
+			query:          "archived=true",
+			expectRespCode: "2002400",
+			statusCode:     http.StatusOK,
+		},
+		{
+			name: "Success. Get All Todos as NDJSON",
+			header: &todo.RequestHeader{
+				ContentType:   "application/json",
+				Authorization: "Bearer " + accessToken,
+				ClientKey:     cfg.Client.Key,
+				// same target as get all todos, signed request is only accepted once
+				Timestamp: now.Add(time.Second).Format(TSLayout),
+				Signature: "",
+			},
+			todoID:         "",
+			accept:         "application/x-ndjson",
+			expectRespCode: "2002400",
+			statusCode:     http.StatusOK,
+		},
+		{
+			name: "Failed. Tampered Query",
+			header: &todo.RequestHeader{
+				ContentType:   "application/json",
+				Authorization: "Bearer " + accessToken,
+				ClientKey:     cfg.Client.Key,
+				Timestamp:     now.Format(TSLayout),
+				Signature:     todoSignature(http.MethodGet, "/v1.0/todo?archived=false", accessToken, nil, now.Format(TSLayout)),
+			},
+			todoID:         "",
+			query:          "archived=true",
+			expectRespCode: "4012400",
+			statusCode:     http.StatusUnauthorized,
+		},
+		{
+			name: "Failed. Malformed Authorization",
+			header: &todo.RequestHeader{
+				ContentType:   "application/json",
+				Authorization: "Bearer",
+				ClientKey:     cfg.Client.Key,
+				Timestamp:     now.Format(TSLayout),
+				Signature:     "",
+			},
+			todoID:         "",
+			expectRespCode: "4002401",
+			statusCode:     http.StatusBadRequest,
+		},
 		{
 			name: "Failed. Invalid Access Token",
 			header: &todo.RequestHeader{
@@ -376,7 +467,7 @@ func TestGetTodo(t *testing.T) {
 				Authorization: "Bearer ABC" + accessToken,
 				ClientKey:     cfg.Client.Key,
 				Timestamp:     now.Format(TSLayout),
-				Signature:     "signature",
+				Signature:     "",
 			},
 			todoID:         "",
 			expectRespCode: "4012401",
@@ -384,24 +475,37 @@ func TestGetTodo(t *testing.T) {
 		},
 	}
 
+	// single todo ID is taken from the previous scenario
+	var tempID string
 	for _, ts := range scenario {
-		var tempID string
-
 		t.Run(ts.name, func(t *testing.T) {
-			request := httptest.NewRequest(http.MethodGet, "/v1.0/todo", nil)
+			target := "/v1.0/todo"
+			if ts.todoID != "" && tempID != "" {
+				target += "/" + tempID
+			}
+			if ts.query != "" {
+				target += "?" + ts.query
+			}
+
+			signature := strings.TrimSpace(ts.header.Signature)
+			if signature == "" {
+				signature = todoSignature(http.MethodGet, target, accessToken, nil, ts.header.Timestamp)
+			}
+
+			request := httptest.NewRequest(http.MethodGet, target, nil)
 			request.Header.Add("Content-Type", ts.header.ContentType)
 			request.Header.Add("Authorization", ts.header.Authorization)
 			request.Header.Add("X-CLIENT-KEY", ts.header.ClientKey)
 			request.Header.Add("X-TIMESTAMP", ts.header.Timestamp)
-			request.Header.Add("X-SIGNATURE", "signature")
-
-			if ts.todoID != "" {
-				request.SetPathValue("ID", tempID)
+			request.Header.Add("X-SIGNATURE", signature)
+			request.Header.Add("X-EXTERNAL-ID", externalID())
+			if ts.accept != "" {
+				request.Header.Add("Accept", ts.accept)
 			}
 
 			responseRecorder := httptest.NewRecorder()
 
-			srv.GetTodoList(responseRecorder, request)
+			router.ServeHTTP(responseRecorder, request)
 			if responseRecorder.Code != ts.statusCode {
 				t.Errorf("Expected status code %d, not HTTP %d", ts.statusCode, responseRecorder.Code)
 				return
@@ -416,6 +520,14 @@ func TestGetTodo(t *testing.T) {
 				}
 			}
 
+			if ts.accept == "application/x-ndjson" {
+				contentType := responseRecorder.Header().Get("Content-Type")
+				if contentType != ts.accept {
+					t.Errorf("Expected content type '%s', got '%s'", ts.accept, contentType)
+				}
+				return
+			}
+
 			// take single todo ID for later use on scenario get single data todo
 			var data []*database.TableTodos
 			json.Unmarshal(responseRecorder.Body.Bytes(), &data)
@@ -426,32 +538,1303 @@ func TestGetTodo(t *testing.T) {
 	}
 }
 
-func getToken(srv *handlers.Handlers, ts string) (string, error) {
-	payload := &auth.TokenRequest{
-		GrantType: "client_credentials",
+func TestRevokeToken(t *testing.T) {
+	now := time.Now()
+	srv := handlers.NewHandlers(db, cfg)
+	router, _ := srv.BuildRouter()
+
+	accessToken, err := getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
 	}
-	var buff bytes.Buffer
-	_ = json.NewEncoder(&buff).Encode(payload)
 
-	signature, err := generateSignature(strings.Join([]string{
-		cfg.Client.Key, ts,
-	}, "|"))
+	introspect := func() *auth.IntrospectResponse {
+		request, err := tokenActionRequest("/v1.0/access-token/introspect", accessToken, timestamp())
+		if err != nil {
+			t.Fatalf("Error Generate Signature - %v", err)
+		}
+		responseRecorder := httptest.NewRecorder()
+		srv.IntrospectAccessToken(responseRecorder, request)
+
+		var resp auth.IntrospectResponse
+		json.Unmarshal(responseRecorder.Body.Bytes(), &resp)
+		return &resp
+	}
+
+	if resp := introspect(); !resp.Active || resp.ClientID != cfg.Client.Key {
+		t.Errorf("Expected active token of client '%s', got %+v", cfg.Client.Key, resp)
+		return
+	}
+
+	request, err := tokenActionRequest("/v1.0/access-token/revoke", accessToken, timestamp())
 	if err != nil {
-		return "", err
+		t.Errorf("Error Generate Signature - %v", err)
+		return
+	}
+	responseRecorder := httptest.NewRecorder()
+	srv.RevokeAccessToken(responseRecorder, request)
+	if responseRecorder.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, not HTTP %d", http.StatusOK, responseRecorder.Code)
+		return
 	}
 
-	request := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", &buff)
+	if resp := introspect(); resp.Active {
+		t.Errorf("Expected revoked token is not active")
+		return
+	}
+
+	// revoked token is rejected by resource endpoint
+	request = httptest.NewRequest(http.MethodGet, "/v1.0/todo", nil)
 	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", "Bearer "+accessToken)
 	request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
-	request.Header.Add("X-TIMESTAMP", ts)
-	request.Header.Add("X-SIGNATURE", signature)
+	request.Header.Add("X-TIMESTAMP", now.Format(TSLayout))
+	request.Header.Add("X-SIGNATURE", "signature")
+	responseRecorder = httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, request)
+
+	var errCode response.Message
+	json.Unmarshal(responseRecorder.Body.Bytes(), &errCode)
+	if errCode.ResponseCode != "4012401" {
+		t.Errorf("Expected response code '4012401', got '%s - %s'", errCode.ResponseCode, errCode.ResponseMessage)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	srv := handlers.NewHandlers(db, cfg)
+
+	// every signed request get its own timestamp, signature is the nonce
+	signed := func(payload *auth.TokenRequest) (*auth.TokenResponse, int) {
+		ts := timestamp()
+		signature, err := generateSignature(strings.Join([]string{cfg.Client.Key, ts}, "|"))
+		if err != nil {
+			t.Fatalf("Error Generate Signature - %v", err)
+		}
+		return tokenRequest(srv, payload, ts, signature)
+	}
+
+	first, code := signed(&auth.TokenRequest{GrantType: auth.GrantType})
+	if code != http.StatusOK || first.RefreshToken == "" {
+		t.Errorf("Expected refresh token, got HTTP %d", code)
+		return
+	}
+
+	refreshGrant := &auth.TokenRequest{GrantType: auth.GrantTypeRefresh, RefreshToken: first.RefreshToken}
+
+	// refresh token alone does not authenticate the client
+	for _, ts := range []struct {
+		name         string
+		signature    string
+		statusCode   int
+		responseCode string
+	}{
+		{"Failed. Unsigned Refresh", "", http.StatusBadRequest, "4007302"},
+		{"Failed. Invalid Signature", "invalid", http.StatusUnauthorized, "4017300"},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			resp, code := tokenRequest(srv, refreshGrant, timestamp(), ts.signature)
+			if code != ts.statusCode || resp.ResponseCode != ts.responseCode {
+				t.Errorf("Expected HTTP %d '%s', got HTTP %d '%s'", ts.statusCode, ts.responseCode, code, resp.ResponseCode)
+			}
+		})
+	}
+
+	// rejected refresh does not use the refresh token
+	second, code := signed(refreshGrant)
+	if code != http.StatusOK || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Errorf("Expected rotated refresh token, got HTTP %d", code)
+		return
+	}
+
+	// rotation does not extend lifetime of the family
+	firstExpiresIn, _ := strconv.Atoi(first.RefreshExpiresIn)
+	if expiresIn, _ := strconv.Atoi(second.RefreshExpiresIn); expiresIn <= 0 || expiresIn > firstExpiresIn {
+		t.Errorf("Expected remaining lifetime of the family, got %s after %s", second.RefreshExpiresIn, first.RefreshExpiresIn)
+	}
+
+	// reuse revoke the whole family
+	if _, code := signed(refreshGrant); code != http.StatusUnauthorized {
+		t.Errorf("Expected reused refresh token is rejected, got HTTP %d", code)
+		return
+	}
+
+	refreshGrant.RefreshToken = second.RefreshToken
+	if _, code := signed(refreshGrant); code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh token of revoked family is rejected, got HTTP %d", code)
+	}
+}
+
+func TestScope(t *testing.T) {
+	now := time.Now()
+	srv := handlers.NewHandlers(db, cfg)
+	router, _ := srv.BuildRouter()
+
+	signature, err := generateSignature(strings.Join([]string{cfg.Client.Key, now.Format(TSLayout)}, "|"))
+	if err != nil {
+		t.Errorf("Error Generate Signature - %v", err)
+		return
+	}
+
+	readOnly := &auth.TokenRequest{GrantType: auth.GrantType, Scope: auth.ScopeTodoRead}
+	token, code := tokenRequest(srv, readOnly, now.Format(TSLayout), signature)
+	if code != http.StatusOK || token.Scope != auth.ScopeTodoRead {
+		t.Errorf("Expected token with scope '%s', got HTTP %d scope '%s'", auth.ScopeTodoRead, code, token.Scope)
+		return
+	}
+
+	// scope is checked before the request signature
+	request := httptest.NewRequest(http.MethodPost, "/v1.0/todo", strings.NewReader("{}"))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", "Bearer "+token.AccessToken)
+	request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+	request.Header.Add("X-TIMESTAMP", now.Format(TSLayout))
+	request.Header.Add("X-SIGNATURE", "signature")
 	responseRecorder := httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, request)
 
-	srv.GetAccessToken(responseRecorder, request)
+	var errCode response.Message
+	json.Unmarshal(responseRecorder.Body.Bytes(), &errCode)
+	if errCode.ResponseCode != "4032400" {
+		t.Errorf("Expected response code '4032400', got '%s - %s'", errCode.ResponseCode, errCode.ResponseMessage)
+	}
 
-	var tokenResp auth.TokenResponse
-	json.Unmarshal(responseRecorder.Body.Bytes(), &tokenResp)
-	return tokenResp.AccessToken, nil
+	notAllowedTS := now.Add(time.Second).Format(TSLayout)
+	signature, err = generateSignature(strings.Join([]string{cfg.Client.Key, notAllowedTS}, "|"))
+	if err != nil {
+		t.Errorf("Error Generate Signature - %v", err)
+		return
+	}
+
+	notAllowed := &auth.TokenRequest{GrantType: auth.GrantType, Scope: "admin"}
+	if _, code := tokenRequest(srv, notAllowed, notAllowedTS, signature); code != http.StatusBadRequest {
+		t.Errorf("Expected scope not allowed is rejected, got HTTP %d", code)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	now := time.Now()
+	srv := handlers.NewHandlers(db, cfg)
+	router, _ := srv.BuildRouter()
+
+	accessToken, err := getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
+	}
+
+	scenario := []struct {
+		name           string
+		timestamp      time.Time
+		externalID     string
+		expectRespCode string
+		statusCode     int
+	}{
+		{
+			name:       "Success",
+			timestamp:  now,
+			externalID: externalID(),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:           "Failed. Timestamp Out Of Window",
+			timestamp:      now.Add(-time.Hour),
+			externalID:     externalID(),
+			expectRespCode: "4012400",
+			statusCode:     http.StatusUnauthorized,
+		},
+	}
+	// replay the first request, X-External-ID is not signed and does not make it unique
+	scenario = append(scenario, scenario[0])
+	scenario[2].name = "Failed. Duplicate Request"
+	scenario[2].externalID = externalID()
+	scenario[2].expectRespCode = "4092400"
+	scenario[2].statusCode = http.StatusConflict
+
+	body := []byte(`{"title":"replay","detail_todo":"replay"}`)
+	for _, ts := range scenario {
+		t.Run(ts.name, func(t *testing.T) {
+			h := sha256.Sum256(body)
+			strToSign := strings.Join([]string{
+				http.MethodPost,
+				"/v1.0/todo",
+				accessToken,
+				hex.EncodeToString(h[:]),
+				ts.timestamp.Format(TSLayout),
+			}, ":")
+			mac := hmac.New(sha512.New, []byte(cfg.Client.Secret))
+			mac.Write([]byte(strToSign))
+
+			request := httptest.NewRequest(http.MethodPost, "/v1.0/todo", bytes.NewReader(body))
+			request.Header.Add("Content-Type", "application/json")
+			request.Header.Add("Authorization", "Bearer "+accessToken)
+			request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+			request.Header.Add("X-TIMESTAMP", ts.timestamp.Format(TSLayout))
+			request.Header.Add("X-SIGNATURE", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			request.Header.Add("X-EXTERNAL-ID", ts.externalID)
+			responseRecorder := httptest.NewRecorder()
+
+			router.ServeHTTP(responseRecorder, request)
+			if responseRecorder.Code != ts.statusCode {
+				t.Errorf("Expected status code %d, not HTTP %d", ts.statusCode, responseRecorder.Code)
+				return
+			}
+
+			if responseRecorder.Code != http.StatusOK {
+				var errCode response.Message
+				json.Unmarshal(responseRecorder.Body.Bytes(), &errCode)
+				if errCode.ResponseCode != ts.expectRespCode {
+					t.Errorf("Expected response code '%s', got '%s - %s'", ts.expectRespCode, errCode.ResponseCode, errCode.ResponseMessage)
+				}
+			}
+		})
+	}
+
+	// captured token request replayed with other X-External-ID
+	tokenTS := timestamp()
+	signature, err := generateSignature(strings.Join([]string{cfg.Client.Key, tokenTS}, "|"))
+	if err != nil {
+		t.Errorf("Error Generate Signature - %v", err)
+		return
+	}
+	payload := &auth.TokenRequest{GrantType: auth.GrantType}
+	if _, code := tokenRequest(srv, payload, tokenTS, signature); code != http.StatusOK {
+		t.Errorf("Expected token is issued, got HTTP %d", code)
+		return
+	}
+	if resp, code := tokenRequest(srv, payload, tokenTS, signature); code != http.StatusConflict || resp.ResponseCode != "4097300" {
+		t.Errorf("Expected duplicate token request is rejected, got HTTP %d '%s'", code, resp.ResponseCode)
+	}
+}
+
+func TestAsymmetricSignature(t *testing.T) {
+	now := time.Now()
+
+	// client on config signs service request with its private key
+	asymmetric := *cfg
+	asymmetric.Client.SignatureMethod = clients.SignatureAsymmetric
+	asymmetric.Clients.Database = "false"
+	srv := handlers.NewHandlers(db, &asymmetric)
+	router, _ := srv.BuildRouter()
+
+	accessToken, err := getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
+	}
+
+	body := []byte(`{"title":"asymmetric","detail_todo":"asymmetric"}`)
+	h := sha256.Sum256(body)
+	strToSign := strings.Join([]string{
+		http.MethodPost,
+		"/v1.0/todo",
+		accessToken,
+		hex.EncodeToString(h[:]),
+		now.Format(TSLayout),
+	}, ":")
+
+	signature, err := generateSignature(strToSign)
+	if err != nil {
+		t.Errorf("Error Generate Signature - %v", err)
+		return
+	}
+
+	scenario := []struct {
+		name           string
+		signature      string
+		expectRespCode string
+		statusCode     int
+	}{
+		{
+			name:       "Success",
+			signature:  signature,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:           "Failed. HMAC Signature",
+			signature:      todoSignature(http.MethodPost, "/v1.0/todo", accessToken, body, now.Format(TSLayout)),
+			expectRespCode: "4012400",
+			statusCode:     http.StatusUnauthorized,
+		},
+	}
+
+	for _, ts := range scenario {
+		t.Run(ts.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/v1.0/todo", bytes.NewReader(body))
+			request.Header.Add("Content-Type", "application/json")
+			request.Header.Add("Authorization", "Bearer "+accessToken)
+			request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+			request.Header.Add("X-TIMESTAMP", now.Format(TSLayout))
+			request.Header.Add("X-SIGNATURE", ts.signature)
+			request.Header.Add("X-EXTERNAL-ID", externalID())
+			responseRecorder := httptest.NewRecorder()
+
+			router.ServeHTTP(responseRecorder, request)
+			if responseRecorder.Code != ts.statusCode {
+				t.Errorf("Expected status code %d, not HTTP %d", ts.statusCode, responseRecorder.Code)
+				return
+			}
+
+			if responseRecorder.Code != http.StatusOK {
+				var errCode response.Message
+				json.Unmarshal(responseRecorder.Body.Bytes(), &errCode)
+				if errCode.ResponseCode != ts.expectRespCode {
+					t.Errorf("Expected response code '%s', got '%s - %s'", ts.expectRespCode, errCode.ResponseCode, errCode.ResponseMessage)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageSignature(t *testing.T) {
+	now := time.Now()
+	srv := handlers.NewHandlers(db, cfg)
+	router, _ := srv.BuildRouter()
+
+	accessToken, err := getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
+	}
+
+	body := []byte(`{"title":"message signature","detail_todo":"rfc 9421"}`)
+	components := []string{"@method", "@path", "@query", "authorization", "content-digest"}
+
+	scenario := []struct {
+		name           string
+		method         string
+		target         string
+		body           []byte
+		digest         string
+		components     []string
+		created        time.Time
+		expectRespCode string
+		statusCode     int
+	}{
+		{
+			name:       "Success. Add Todo",
+			method:     http.MethodPost,
+			target:     "/v1.0/todo",
+			body:       body,
+			digest:     httpsig.ContentDigest(body),
+			components: components,
+			created:    now,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Success. Get Todo List",
+			method:     http.MethodGet,
+			target:     "/v1.0/todo?archived=true",
+			components: []string{"@method", "@path", "@query", "authorization"},
+			created:    now,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:           "Failed. Content-Digest Does Not Match",
+			method:         http.MethodPost,
+			target:         "/v1.0/todo",
+			body:           body,
+			digest:         httpsig.ContentDigest([]byte(`{"title":"other"}`)),
+			components:     components,
+			created:        now,
+			expectRespCode: "4012400",
+			statusCode:     http.StatusUnauthorized,
+		},
+		{
+			name:           "Failed. Required Component Not Covered",
+			method:         http.MethodPost,
+			target:         "/v1.0/todo",
+			body:           body,
+			digest:         httpsig.ContentDigest(body),
+			components:     []string{"@method", "@path", "content-digest"},
+			created:        now,
+			expectRespCode: "4012400",
+			statusCode:     http.StatusUnauthorized,
+		},
+		{
+			name:           "Failed. Created Out Of Window",
+			method:         http.MethodPost,
+			target:         "/v1.0/todo",
+			body:           body,
+			digest:         httpsig.ContentDigest(body),
+			components:     components,
+			created:        now.Add(-time.Hour),
+			expectRespCode: "4012400",
+			statusCode:     http.StatusUnauthorized,
+		},
+	}
+
+	for _, ts := range scenario {
+		t.Run(ts.name, func(t *testing.T) {
+			request := httptest.NewRequest(ts.method, ts.target, bytes.NewReader(ts.body))
+			request.Header.Add("Content-Type", "application/json")
+			request.Header.Add("Authorization", "Bearer "+accessToken)
+			request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+			request.Header.Add("X-TIMESTAMP", now.Format(TSLayout))
+			request.Header.Add("X-EXTERNAL-ID", externalID())
+			if ts.digest != "" {
+				request.Header.Add("Content-Digest", ts.digest)
+			}
+
+			err := httpsig.Sign(request, &httpsig.Params{
+				Label:      "sig1",
+				Components: ts.components,
+				Created:    ts.created.Unix(),
+				KeyID:      cfg.Client.Key,
+			}, []byte(cfg.Client.Secret))
+			if err != nil {
+				t.Errorf("Error Generate Signature - %v", err)
+				return
+			}
+
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != ts.statusCode {
+				t.Errorf("Expected status code %d, not HTTP %d", ts.statusCode, responseRecorder.Code)
+				return
+			}
+
+			if responseRecorder.Code != http.StatusOK {
+				var errCode response.Message
+				json.Unmarshal(responseRecorder.Body.Bytes(), &errCode)
+				if errCode.ResponseCode != ts.expectRespCode {
+					t.Errorf("Expected response code '%s', got '%s - %s'", ts.expectRespCode, errCode.ResponseCode, errCode.ResponseMessage)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limited := *cfg
+	limited.RateLimit.Enabled = "true"
+	limited.RateLimit.Default = config.RateRule{Rate: 1, Burst: 2}
+	srv := handlers.NewHandlers(db, &limited)
+
+	router, err := srv.BuildRouter()
+	if err != nil {
+		t.Errorf("Error Build Router - %v", err)
+		return
+	}
+
+	// token route is limited per source IP, request is rejected after the burst
+	// before the header is validated, whatever X-Client-Key is sent
+	for i, expected := range []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", nil)
+		request.Header.Add("X-CLIENT-KEY", "ratelimit-"+externalID())
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != expected {
+			t.Errorf("Request %d expected HTTP %d, not HTTP %d", i+1, expected, responseRecorder.Code)
+			return
+		}
+
+		if remaining := responseRecorder.Header().Get("RateLimit-Remaining"); remaining == "" {
+			t.Errorf("Request %d expected RateLimit-Remaining header", i+1)
+		}
+	}
+}
+
+func TestCertificateAuth(t *testing.T) {
+	now := time.Now()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Errorf("Error Generate Key - %v", err)
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "partner", Organization: []string{"Bank"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Errorf("Error Create Certificate - %v", err)
+		return
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	// client on config authenticate by certificate instead of X-Signature
+	mtls := *cfg
+	mtls.Client.TLSAuth = clients.TLSAuthCertificate
+	mtls.Client.CertificateFingerprint = clients.Fingerprint(cert)
+	mtls.Clients.Database = "false"
+	srv := handlers.NewHandlers(db, &mtls)
+
+	requestToken := func(withCert bool) (*auth.TokenResponse, int) {
+		var buff bytes.Buffer
+		_ = json.NewEncoder(&buff).Encode(&auth.TokenRequest{GrantType: auth.GrantType})
+
+		request := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", &buff)
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+		request.Header.Add("X-TIMESTAMP", now.Format(TSLayout))
+		request.Header.Add("X-EXTERNAL-ID", externalID())
+		if withCert {
+			request.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			}
+		}
+		responseRecorder := httptest.NewRecorder()
+		srv.GetAccessToken(responseRecorder, request)
+
+		var tokenResp auth.TokenResponse
+		json.Unmarshal(responseRecorder.Body.Bytes(), &tokenResp)
+		return &tokenResp, responseRecorder.Code
+	}
+
+	if _, code := requestToken(false); code != http.StatusUnauthorized {
+		t.Errorf("Expected request without certificate is rejected, got HTTP %d", code)
+		return
+	}
+
+	resp, code := requestToken(true)
+	if code != http.StatusOK {
+		t.Errorf("Expected access token, got HTTP %d", code)
+		return
+	}
+
+	// token is bound to the certificate (RFC 8705)
+	sum := sha256.Sum256(cert.Raw)
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(resp.AccessToken, claims); err != nil {
+		t.Errorf("Error Parse Access Token - %v", err)
+		return
+	}
+
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	if cnf[auth.ThumbprintClaim] != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Expected cnf %s of the certificate, got %v", auth.ThumbprintClaim, claims["cnf"])
+	}
+}
+
+func TestLockout(t *testing.T) {
+	now := time.Now()
+	locked := *cfg
+	locked.Lockout.MaxFailures = "2"
+	locked.Lockout.Store = "memory"
+	srv := handlers.NewHandlers(db, &locked)
+
+	signature, err := generateSignature(strings.Join([]string{cfg.Client.Key, now.Format(TSLayout)}, "|"))
+	if err != nil {
+		t.Errorf("Error Generate Signature - %v", err)
+		return
+	}
+
+	// valid signature is rejected as well once the client is locked out
+	payload := &auth.TokenRequest{GrantType: auth.GrantType}
+	for i, attempt := range []struct {
+		signature string
+		expected  int
+	}{
+		{"aW52YWxpZA==", http.StatusUnauthorized},
+		{"aW52YWxpZA==", http.StatusUnauthorized},
+		{signature, http.StatusTooManyRequests},
+	} {
+		if _, code := tokenRequest(srv, payload, now.Format(TSLayout), attempt.signature); code != attempt.expected {
+			t.Errorf("Attempt %d expected HTTP %d, not HTTP %d", i+1, attempt.expected, code)
+			return
+		}
+	}
+}
+
+func TestTrustedIssuer(t *testing.T) {
+	now := time.Now()
+	idpKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rotatedKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	// stand-in of identity provider JWKS endpoint, rotated key is published after the first fetch
+	var mu sync.Mutex
+	var published []*rsa.PrivateKey
+	jwksSet := func() []byte {
+		mu.Lock()
+		defer mu.Unlock()
+
+		keys := []map[string]string{}
+		for i, key := range published {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": fmt.Sprintf("idp-%d", i+1),
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		raw, _ := json.Marshal(map[string]interface{}{"keys": keys})
+		return raw
+	}
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwksSet())
+	}))
+	defer idp.Close()
+
+	published = []*rsa.PrivateKey{idpKey}
+	jwksFile := t.TempDir() + "/jwks.json"
+	if err := os.WriteFile(jwksFile, jwksSet(), 0o600); err != nil {
+		t.Errorf("Error Write JWKS - %v", err)
+		return
+	}
+
+	trusted := *cfg
+	trusted.TrustedIssuers.MinRefetch = "0"
+	trusted.TrustedIssuers.Issuers = []config.TrustedIssuer{
+		{
+			Issuer:   "https://idp.example.com",
+			JWKSURL:  idp.URL,
+			Audience: "api://http-jwt-crud",
+			Claims:   config.ClaimMapping{ClientID: "azp", Scope: "scp", TokenID: "uti"},
+		},
+		{
+			Issuer:   "https://offline.example.com",
+			JWKSFile: jwksFile,
+			Audience: "api://http-jwt-crud",
+			Claims:   config.ClaimMapping{ClientID: "sub", Scope: "scope", TokenID: "jti"},
+		},
+	}
+	srv := handlers.NewHandlers(db, &trusted)
+	router, _ := srv.BuildRouter()
+
+	idpToken := func(key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, _ := token.SignedString(key)
+		return signed
+	}
+
+	scenario := []struct {
+		name           string
+		accessToken    string
+		rotate         bool
+		statusCode     int
+		expectRespCode string
+	}{
+		{
+			name: "Success. JWKS URL",
+			accessToken: idpToken(idpKey, "idp-1", jwt.MapClaims{
+				"iss": "https://idp.example.com", "aud": "api://http-jwt-crud", "azp": cfg.Client.Key,
+				"scp": []string{auth.ScopeTodoRead}, "uti": uuid.NewString(), "exp": now.Add(time.Minute).Unix(),
+			}),
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "Success. Local JWKS File",
+			accessToken: idpToken(idpKey, "idp-1", jwt.MapClaims{
+				"iss": "https://offline.example.com", "aud": "api://http-jwt-crud", "sub": cfg.Client.Key,
+				"scope": auth.ScopeTodoRead, "jti": uuid.NewString(), "exp": now.Add(time.Minute).Unix(),
+			}),
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "Success. Rotated Key Refetched",
+			accessToken: idpToken(rotatedKey, "idp-2", jwt.MapClaims{
+				"iss": "https://idp.example.com", "aud": "api://http-jwt-crud", "azp": cfg.Client.Key,
+				"scp": auth.ScopeTodoRead, "uti": uuid.NewString(), "exp": now.Add(time.Minute).Unix(),
+			}),
+			rotate:     true,
+			statusCode: http.StatusOK,
+		},
+		{
+			name: "Failed. Wrong Audience",
+			accessToken: idpToken(idpKey, "idp-1", jwt.MapClaims{
+				"iss": "https://idp.example.com", "aud": "api://other", "azp": cfg.Client.Key,
+				"scp": auth.ScopeTodoRead, "uti": uuid.NewString(), "exp": now.Add(time.Minute).Unix(),
+			}),
+			statusCode:     http.StatusUnauthorized,
+			expectRespCode: "4012401",
+		},
+		{
+			name: "Failed. Untrusted Issuer",
+			accessToken: idpToken(idpKey, "idp-1", jwt.MapClaims{
+				"iss": "https://unknown.example.com", "aud": "api://http-jwt-crud", "azp": cfg.Client.Key,
+				"scp": auth.ScopeTodoRead, "uti": uuid.NewString(), "exp": now.Add(time.Minute).Unix(),
+			}),
+			statusCode:     http.StatusUnauthorized,
+			expectRespCode: "4012401",
+		},
+		{
+			name: "Failed. Without Expiry",
+			accessToken: idpToken(idpKey, "idp-1", jwt.MapClaims{
+				"iss": "https://idp.example.com", "aud": "api://http-jwt-crud", "azp": cfg.Client.Key,
+				"scp": auth.ScopeTodoRead, "uti": uuid.NewString(),
+			}),
+			statusCode:     http.StatusUnauthorized,
+			expectRespCode: "4012401",
+		},
+		{
+			name: "Failed. Without Token ID",
+			accessToken: idpToken(idpKey, "idp-1", jwt.MapClaims{
+				"iss": "https://idp.example.com", "aud": "api://http-jwt-crud", "azp": cfg.Client.Key,
+				"scp": auth.ScopeTodoRead, "exp": now.Add(time.Minute).Unix(),
+			}),
+			statusCode:     http.StatusUnauthorized,
+			expectRespCode: "4012401",
+		},
+		{
+			name: "Failed. Mapped Scope",
+			accessToken: idpToken(idpKey, "idp-1", jwt.MapClaims{
+				"iss": "https://idp.example.com", "aud": "api://http-jwt-crud", "azp": cfg.Client.Key,
+				"scope": auth.ScopeTodoRead, "uti": uuid.NewString(), "exp": now.Add(time.Minute).Unix(),
+			}),
+			statusCode:     http.StatusForbidden,
+			expectRespCode: "4032400",
+		},
+	}
+
+	for _, ts := range scenario {
+		t.Run(ts.name, func(t *testing.T) {
+			if ts.rotate {
+				mu.Lock()
+				published = []*rsa.PrivateKey{idpKey, rotatedKey}
+				mu.Unlock()
+			}
+
+			target := "/v1.0/todo"
+			request := httptest.NewRequest(http.MethodGet, target, nil)
+			request.Header.Add("Content-Type", "application/json")
+			request.Header.Add("Authorization", "Bearer "+ts.accessToken)
+			request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+			request.Header.Add("X-TIMESTAMP", now.Format(TSLayout))
+			request.Header.Add("X-SIGNATURE", todoSignature(http.MethodGet, target, ts.accessToken, nil, now.Format(TSLayout)))
+			request.Header.Add("X-EXTERNAL-ID", externalID())
+			responseRecorder := httptest.NewRecorder()
+
+			router.ServeHTTP(responseRecorder, request)
+			if responseRecorder.Code != ts.statusCode {
+				t.Errorf("Expected status code %d, not HTTP %d", ts.statusCode, responseRecorder.Code)
+				return
+			}
+
+			if responseRecorder.Code != http.StatusOK {
+				var errCode response.Message
+				json.Unmarshal(responseRecorder.Body.Bytes(), &errCode)
+				if errCode.ResponseCode != ts.expectRespCode {
+					t.Errorf("Expected response code '%s', got '%s - %s'", ts.expectRespCode, errCode.ResponseCode, errCode.ResponseMessage)
+				}
+			}
+		})
+	}
+}
+
+func TestTodoTimestamps(t *testing.T) {
+	srv := handlers.NewHandlers(db, cfg)
+	router, _ := srv.BuildRouter()
+
+	accessToken, err := getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
+	}
+
+	body, _ := json.Marshal(&todo.AddTodosRequest{Title: "timestamp " + uuid.NewString()})
+	resp := todoRequest(router, http.MethodPost, "/v1.0/todo", accessToken, body, timestamp())
+	var added database.TableTodos
+	if err := json.Unmarshal(resp.Body.Bytes(), &added); err != nil || resp.Code != http.StatusOK {
+		t.Errorf("Expected todo is added, got HTTP %d %v", resp.Code, err)
+		return
+	}
+
+	resp = todoRequest(router, http.MethodGet, "/v1.0/todo/"+added.ID, accessToken, nil, timestamp())
+	var data []map[string]interface{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &data); err != nil || len(data) != 1 {
+		t.Errorf("Expected single todo, got HTTP %d %s", resp.Code, resp.Body.String())
+		return
+	}
+
+	// RFC 3339 with offset, not "2006-01-02 15:04:05"
+	for _, field := range []string{"CreatedDate", "UpdatedDate"} {
+		value, _ := data[0][field].(string)
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			t.Errorf("Expected %s on RFC 3339, got '%v'", field, data[0][field])
+		}
+	}
+
+	if data[0]["CompletedDate"] != nil {
+		t.Errorf("Expected CompletedDate null on todo which is not completed, got '%v'", data[0]["CompletedDate"])
+	}
+}
+
+func TestArchive(t *testing.T) {
+	now := time.Now()
+	archived := *cfg
+	archived.Archive.AfterDays = "1"
+	archived.Archive.BatchSize = "10"
+	srv := handlers.NewHandlers(db, &archived)
+	router, _ := srv.BuildRouter()
+	service := todo.NewTodoService(db, &archived, replay.New(db, &archived), lockout.New(db, &archived))
+
+	accessToken, err := getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
+	}
+
+	// todo completed 2 days ago is old enough to archive
+	id := uuid.NewString()
+	completed := now.UTC().AddDate(0, 0, -2)
+	_, err = db.Exec(`INSERT INTO todos(id, title, detail, created_date, updated_date, st_completed, completed_date)
+			VALUES(?, ?, '', ?, ?, '1', ?)`, id, "archive "+id, completed, completed, completed)
+	if err != nil {
+		t.Errorf("Insert Todo - %v", err)
+		return
+	}
+
+	// only one replica run the archiver, the lock is hold by other session
+	conn, err := database.TryLock(db, context.Background(), "todo_archiver")
+	if err != nil || conn == nil {
+		t.Errorf("Expected archive lock, got %v", err)
+		return
+	}
+	if total, err := service.Archive(context.Background()); err != nil || total != 0 {
+		t.Errorf("Expected nothing archived while lock is hold, got %d %v", total, err)
+	}
+	database.Unlock(conn, "todo_archiver")
+
+	if total, err := service.Archive(context.Background()); err != nil || total < 1 {
+		t.Errorf("Expected completed todo is archived, got %d %v", total, err)
+		return
+	}
+
+	// read of single todo which not found is an empty list
+	scenario := []struct {
+		name       string
+		method     string
+		target     string
+		statusCode int
+		found      bool
+	}{
+		{"Archived Todo Not On List", http.MethodGet, "/v1.0/todo/" + id, http.StatusOK, false},
+		{"Archived Todo On Archive", http.MethodGet, "/v1.0/todo/" + id + "?archived=true", http.StatusOK, true},
+		{"Unarchive", http.MethodPost, "/v1.0/todo/" + id + "/unarchive", http.StatusOK, false},
+		{"Unarchive Todo Which Not Archived", http.MethodPost, "/v1.0/todo/" + id + "/unarchive", http.StatusNotFound, false},
+		{"Unknown Todo", http.MethodPost, "/v1.0/todo/" + uuid.NewString() + "/unarchive", http.StatusNotFound, false},
+		{"Unarchived Todo On List", http.MethodGet, "/v1.0/todo/" + id, http.StatusOK, true},
+		{"Unarchived Todo Not On Archive", http.MethodGet, "/v1.0/todo/" + id + "?archived=true", http.StatusOK, false},
+	}
+
+	for _, ts := range scenario {
+		t.Run(ts.name, func(t *testing.T) {
+			resp := todoRequest(router, ts.method, ts.target, accessToken, nil, timestamp())
+			if resp.Code != ts.statusCode {
+				t.Errorf("Expected status code %d, not HTTP %d %s", ts.statusCode, resp.Code, resp.Body.String())
+				return
+			}
+
+			if ts.method != http.MethodGet {
+				return
+			}
+
+			var data []*database.TableTodos
+			json.Unmarshal(resp.Body.Bytes(), &data)
+			if !ts.found {
+				if len(data) != 0 {
+					t.Errorf("Expected empty list, got %s", resp.Body.String())
+				}
+				return
+			}
+
+			if len(data) != 1 || data[0].ID != id || !data[0].CompletedDate.Valid {
+				t.Errorf("Expected completed todo '%s', got %s", id, resp.Body.String())
+			}
+		})
+	}
+
+	// unarchived todo is updated, so the next run does not archive it again
+	if _, err := service.Archive(context.Background()); err != nil {
+		t.Errorf("Archive: %v", err)
+		return
+	}
+
+	var listed int
+	if err := db.Get(&listed, "SELECT COUNT(*) FROM todos WHERE id=?", id); err != nil || listed != 1 {
+		t.Errorf("Expected unarchived todo stay on the list, got %d %v", listed, err)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	cached := *cfg
+	cached.Cache.Enabled = "true"
+	cached.Cache.TTL = "60"
+	cached.Cache.Size = "100"
+	srv := handlers.NewHandlers(db, &cached)
+	router, _ := srv.BuildRouter()
+
+	accessToken, err := getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
+	}
+
+	list := func() []*database.TableTodos {
+		var data []*database.TableTodos
+		resp := todoRequest(router, http.MethodGet, "/v1.0/todo", accessToken, nil, timestamp())
+		json.Unmarshal(resp.Body.Bytes(), &data)
+		return data
+	}
+
+	// the second list is served from cache
+	before := list()
+	list()
+
+	title := "cache " + uuid.NewString()
+	body, _ := json.Marshal(&todo.AddTodosRequest{Title: title})
+	if resp := todoRequest(router, http.MethodPost, "/v1.0/todo", accessToken, body, timestamp()); resp.Code != http.StatusOK {
+		t.Errorf("Expected todo is added, got HTTP %d", resp.Code)
+		return
+	}
+
+	// write must invalidate the cached list
+	after := list()
+	if len(after) != len(before)+1 || !slices.ContainsFunc(after, func(tb *database.TableTodos) bool { return tb.Title == title }) {
+		t.Errorf("Expected new todo on list after write, got %d todos before and %d after", len(before), len(after))
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	oldKey, newKey := make([]byte, encryption.KeySize), make([]byte, encryption.KeySize)
+	rand.Read(oldKey)
+	rand.Read(newKey)
+
+	encrypted := func(active string, keys map[string][]byte) *config.EnvParams {
+		c := *cfg
+		c.Encryption.Keys = keys
+		c.Encryption.ActiveKey = active
+		c.Encryption.EncryptTitle = "false"
+		return &c
+	}
+
+	// todo is written with the old master key
+	before := encrypted("old", map[string][]byte{"old": oldKey})
+	srv := handlers.NewHandlers(db, before)
+	router, _ := srv.BuildRouter()
+	accessToken, err := getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
+	}
+
+	title := "reencrypt " + uuid.NewString()
+	body, _ := json.Marshal(&todo.AddTodosRequest{Title: title, DetailTodo: "secret detail"})
+	if resp := todoRequest(router, http.MethodPost, "/v1.0/todo", accessToken, body, timestamp()); resp.Code != http.StatusOK {
+		t.Errorf("Expected todo is added, got HTTP %d", resp.Code)
+		return
+	}
+
+	var row database.TableTodos
+	if err := db.Get(&row, "SELECT id, detail, key_id FROM todos WHERE title=?", title); err != nil || row.KeyID != "old" || row.Detail == "secret detail" {
+		t.Errorf("Expected detail encrypted by old key, got %+v %v", row, err)
+		return
+	}
+
+	// archived todo is re-encrypted too
+	archivedTitle := "reencrypt archived " + uuid.NewString()
+	body, _ = json.Marshal(&todo.AddTodosRequest{Title: archivedTitle, DetailTodo: "archived detail"})
+	if resp := todoRequest(router, http.MethodPost, "/v1.0/todo", accessToken, body, timestamp()); resp.Code != http.StatusOK {
+		t.Errorf("Expected todo is added, got HTTP %d", resp.Code)
+		return
+	}
+
+	var archived database.TableTodos
+	if err := db.Get(&archived, "SELECT id FROM todos WHERE title=?", archivedTitle); err != nil {
+		t.Errorf("Get Todo - %v", err)
+		return
+	}
+	_, err = db.Exec(`INSERT INTO todos_archive(id, title, detail, created_date, updated_date, st_completed, completed_date, key_id, data_key, enc_title, archived_date)
+			SELECT id, title, detail, created_date, updated_date, st_completed, completed_date, key_id, data_key, enc_title, UTC_TIMESTAMP()
+			FROM todos WHERE id=?`, archived.ID)
+	if err == nil {
+		_, err = db.Exec("DELETE FROM todos WHERE id=?", archived.ID)
+	}
+	if err != nil {
+		t.Errorf("Archive Todo - %v", err)
+		return
+	}
+
+	// client secret is sealed with the same keyring
+	client, err := clients.NewManager(db, before).Create(context.Background(), "todo:read", "", clients.SignatureHMAC)
+	if err != nil {
+		t.Errorf("Create Client: %v", err)
+		return
+	}
+
+	// rotate, both keys are configured until re-encrypt is done
+	rotated := encrypted("new", map[string][]byte{"old": oldKey, "new": newKey})
+	if _, err := todo.Reencrypt(context.Background(), db, rotated, slog.Default()); err != nil {
+		t.Errorf("Reencrypt: %v", err)
+		return
+	}
+	if _, err := clients.NewManager(db, rotated).Reencrypt(context.Background(), slog.Default()); err != nil {
+		t.Errorf("Reencrypt Clients: %v", err)
+		return
+	}
+
+	if err := db.Get(&row, "SELECT id, detail, key_id FROM todos WHERE id=?", row.ID); err != nil || row.KeyID != "new" {
+		t.Errorf("Expected todo re-encrypted by new key, got %+v %v", row, err)
+		return
+	}
+
+	if err := db.Get(&archived, "SELECT id, detail, key_id FROM todos_archive WHERE id=?", archived.ID); err != nil || archived.KeyID != "new" {
+		t.Errorf("Expected archived todo re-encrypted by new key, got %+v %v", archived, err)
+		return
+	}
+
+	// old master key can be removed
+	after := encrypted("new", map[string][]byte{"new": newKey})
+	srv = handlers.NewHandlers(db, after)
+	router, _ = srv.BuildRouter()
+	accessToken, err = getToken(srv, timestamp())
+	if err != nil {
+		t.Error("Failed Get Access Token")
+		return
+	}
+
+	resp := todoRequest(router, http.MethodGet, "/v1.0/todo/"+row.ID, accessToken, nil, timestamp())
+	var data []*database.TableTodos
+	json.Unmarshal(resp.Body.Bytes(), &data)
+	if resp.Code != http.StatusOK || len(data) != 1 || data[0].Detail != "secret detail" {
+		t.Errorf("Expected detail readable with new key only, got HTTP %d %s", resp.Code, resp.Body.String())
+	}
+
+	resp = todoRequest(router, http.MethodGet, "/v1.0/todo/"+archived.ID+"?archived=true", accessToken, nil, timestamp())
+	data = nil
+	json.Unmarshal(resp.Body.Bytes(), &data)
+	if resp.Code != http.StatusOK || len(data) != 1 || data[0].Detail != "archived detail" {
+		t.Errorf("Expected archived detail readable with new key only, got HTTP %d %s", resp.Code, resp.Body.String())
+	}
+
+	stored, err := clients.NewDBStore(db, clients.NewKeyring(after)).Get(context.Background(), client.Key)
+	if err != nil || stored.Secret != client.Secret {
+		t.Errorf("Expected client secret readable with new key only, got %v", err)
+	}
+}
+
+func TestDebugVars(t *testing.T) {
+	adminToken := "admin-" + uuid.NewString()
+	sum := sha256.Sum256([]byte(adminToken))
+	admin := *cfg
+	admin.Admin.TokenHash = hex.EncodeToString(sum[:])
+	srv := handlers.NewHandlers(db, &admin)
+	router, _ := srv.BuildRouter()
+
+	for _, ts := range []struct {
+		name       string
+		target     string
+		token      string
+		statusCode int
+	}{
+		{"Failed. Public Path", "/debug/vars", "", http.StatusNotFound},
+		{"Failed. Without Admin Token", "/admin/v1.0/debug/vars", "", http.StatusBadRequest},
+		{"Failed. Invalid Admin Token", "/admin/v1.0/debug/vars", "invalid", http.StatusUnauthorized},
+		{"Success", "/admin/v1.0/debug/vars", adminToken, http.StatusOK},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, ts.target, nil)
+			request.Header.Add("Content-Type", "application/json")
+			if ts.token != "" {
+				request.Header.Add("Authorization", "Bearer "+ts.token)
+			}
+			responseRecorder := httptest.NewRecorder()
+
+			router.ServeHTTP(responseRecorder, request)
+			if responseRecorder.Code != ts.statusCode {
+				t.Errorf("Expected status code %d, not HTTP %d", ts.statusCode, responseRecorder.Code)
+			}
+		})
+	}
+}
+
+func TestAdminClients(t *testing.T) {
+	adminToken := "admin-" + uuid.NewString()
+	sum := sha256.Sum256([]byte(adminToken))
+	admin := *cfg
+	admin.Admin.TokenHash = hex.EncodeToString(sum[:])
+	srv := handlers.NewHandlers(db, &admin)
+	router, _ := srv.BuildRouter()
+
+	adminRequest := func(method, target, token, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Add("Content-Type", "application/json")
+		if token != "" {
+			request.Header.Add("Authorization", "Bearer "+token)
+		}
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		return responseRecorder
+	}
+
+	resp := adminRequest(http.MethodPost, "/admin/v1.0/clients", adminToken, `{"scopes":"todo:read"}`)
+	var created struct {
+		ClientKey    string `json:"clientKey"`
+		ClientSecret string `json:"clientSecret"`
+	}
+	json.Unmarshal(resp.Body.Bytes(), &created)
+	if resp.Code != http.StatusOK || created.ClientKey == "" || created.ClientSecret == "" {
+		t.Errorf("Expected client is created with secret, got HTTP %d %s", resp.Code, resp.Body.String())
+		return
+	}
+
+	for _, ts := range []struct {
+		name         string
+		method       string
+		target       string
+		token        string
+		body         string
+		statusCode   int
+		responseCode string
+	}{
+		{"Failed. Without Admin Token", http.MethodGet, "/admin/v1.0/clients", "", "", http.StatusBadRequest, "4009002"},
+		{"Failed. Invalid Admin Token", http.MethodGet, "/admin/v1.0/clients", "invalid", "", http.StatusUnauthorized, "4019000"},
+		{"Failed. Create With Unknown Scope", http.MethodPost, "/admin/v1.0/clients", adminToken, `{"scopes":"todo:read todo:delete"}`, http.StatusBadRequest, "4009001"},
+		{"Failed. Create With Unknown Signature Method", http.MethodPost, "/admin/v1.0/clients", adminToken, `{"signatureMethod":"rsa"}`, http.StatusBadRequest, "4009001"},
+		{"Failed. Create Asymmetric Without Public Key", http.MethodPost, "/admin/v1.0/clients", adminToken, `{"signatureMethod":"asymmetric"}`, http.StatusBadRequest, "4009002"},
+		{"Failed. Invalid Public Key", http.MethodPut, "/admin/v1.0/clients/" + created.ClientKey + "/public-key", adminToken, `{"publicKey":"not a key"}`, http.StatusBadRequest, "4009001"},
+		{"Failed. Missing Signature Method", http.MethodPut, "/admin/v1.0/clients/" + created.ClientKey + "/signature-method", adminToken, `{}`, http.StatusBadRequest, "4009002"},
+		{"Failed. Disable Unknown Client", http.MethodPost, "/admin/v1.0/clients/unknown-" + uuid.NewString() + "/disable", adminToken, "", http.StatusNotFound, "4049000"},
+		{"Failed. Rotate Secret Unknown Client", http.MethodPost, "/admin/v1.0/clients/unknown-" + uuid.NewString() + "/rotate-secret", adminToken, "", http.StatusNotFound, "4049000"},
+		{"Failed. Unlock Without Client Key Nor IP", http.MethodPost, "/admin/v1.0/lockouts/unlock", adminToken, `{}`, http.StatusBadRequest, "4009002"},
+		{"Success. List", http.MethodGet, "/admin/v1.0/clients", adminToken, "", http.StatusOK, "2009000"},
+		{"Success. Disable", http.MethodPost, "/admin/v1.0/clients/" + created.ClientKey + "/disable", adminToken, "", http.StatusOK, "2009000"},
+		{"Success. Enable", http.MethodPost, "/admin/v1.0/clients/" + created.ClientKey + "/enable", adminToken, "", http.StatusOK, "2009000"},
+	} {
+		t.Run(ts.name, func(t *testing.T) {
+			resp := adminRequest(ts.method, ts.target, ts.token, ts.body)
+			if resp.Code != ts.statusCode {
+				t.Errorf("Expected status code %d, not HTTP %d %s", ts.statusCode, resp.Code, resp.Body.String())
+				return
+			}
+
+			var result response.Message
+			json.Unmarshal(resp.Body.Bytes(), &result)
+			if result.ResponseCode != ts.responseCode {
+				t.Errorf("Expected response code %s, got %s", ts.responseCode, result.ResponseCode)
+			}
+		})
+	}
+
+	// admin API is not served without admin token on config
+	srv = handlers.NewHandlers(db, cfg)
+	router, _ = srv.BuildRouter()
+	if resp := adminRequest(http.MethodGet, "/admin/v1.0/clients", adminToken, ""); resp.Code != http.StatusNotFound {
+		t.Errorf("Expected admin API disabled, got HTTP %d", resp.Code)
+	}
+}
+
+func tokenRequest(srv *handlers.Handlers, payload *auth.TokenRequest, ts string, signature string) (*auth.TokenResponse, int) {
+	var buff bytes.Buffer
+	_ = json.NewEncoder(&buff).Encode(payload)
+
+	request := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", &buff)
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+	request.Header.Add("X-TIMESTAMP", ts)
+	request.Header.Add("X-SIGNATURE", signature)
+	request.Header.Add("X-EXTERNAL-ID", externalID())
+	responseRecorder := httptest.NewRecorder()
+
+	srv.GetAccessToken(responseRecorder, request)
+
+	var tokenResp auth.TokenResponse
+	json.Unmarshal(responseRecorder.Body.Bytes(), &tokenResp)
+	return &tokenResp, responseRecorder.Code
+}
+
+// tokenActionRequest build signed request of revoke or introspect endpoint
+func tokenActionRequest(endpoint string, accessToken string, ts string) (*http.Request, error) {
+	var buff bytes.Buffer
+	_ = json.NewEncoder(&buff).Encode(&auth.TokenActionRequest{Token: accessToken})
+
+	signature, err := generateSignature(strings.Join([]string{
+		cfg.Client.Key, ts,
+	}, "|"))
+	if err != nil {
+		return nil, err
+	}
+
+	request := httptest.NewRequest(http.MethodPost, endpoint, &buff)
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+	request.Header.Add("X-TIMESTAMP", ts)
+	request.Header.Add("X-SIGNATURE", signature)
+	request.Header.Add("X-EXTERNAL-ID", externalID())
+	return request, nil
+}
+
+func getToken(srv *handlers.Handlers, ts string) (string, error) {
+	payload := &auth.TokenRequest{
+		GrantType: "client_credentials",
+	}
+	var buff bytes.Buffer
+	_ = json.NewEncoder(&buff).Encode(payload)
+
+	signature, err := generateSignature(strings.Join([]string{
+		cfg.Client.Key, ts,
+	}, "|"))
+	if err != nil {
+		return "", err
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/v1.0/access-token", &buff)
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+	request.Header.Add("X-TIMESTAMP", ts)
+	request.Header.Add("X-SIGNATURE", signature)
+	request.Header.Add("X-EXTERNAL-ID", externalID())
+	responseRecorder := httptest.NewRecorder()
+
+	srv.GetAccessToken(responseRecorder, request)
+
+	var tokenResp auth.TokenResponse
+	json.Unmarshal(responseRecorder.Body.Bytes(), &tokenResp)
+	return tokenResp.AccessToken, nil
+}
+
+// externalID return request ID, it is not signed and not used as nonce
+func externalID() string {
+	return uuid.New().String()
+}
+
+// timestamp return X-Timestamp of now, signed request is only accepted once
+// so every request need its own timestamp
+func timestamp() string {
+	return time.Now().Format(TSLayout)
+}
+
+// todoRequest serve signed todo request of access token
+func todoRequest(router http.Handler, method string, target string, accessToken string, body []byte, ts string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, bytes.NewReader(body))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", "Bearer "+accessToken)
+	request.Header.Add("X-CLIENT-KEY", cfg.Client.Key)
+	request.Header.Add("X-TIMESTAMP", ts)
+	request.Header.Add("X-SIGNATURE", todoSignature(method, target, accessToken, body, ts))
+	request.Header.Add("X-EXTERNAL-ID", externalID())
+	responseRecorder := httptest.NewRecorder()
+
+	router.ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// todoSignature sign todo request with client secret, target is path with canonical query
+func todoSignature(method string, target string, accessToken string, body []byte, ts string) string {
+	h := sha256.Sum256(body)
+	strToSign := strings.Join([]string{
+		method,
+		target,
+		accessToken,
+		hex.EncodeToString(h[:]),
+		ts,
+	}, ":")
+
+	mac := hmac.New(sha512.New, []byte(cfg.Client.Secret))
+	mac.Write([]byte(strToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
 
 func generateSignature(strToSign string) (string, error) {